@@ -0,0 +1,188 @@
+// Command backfill summarises and tags again the stored articles processed
+// by an older version of the algorithms, after models.AlgorithmVersion has
+// been incremented:
+//
+//	go run ./cmd/backfill -workers 4 -batch 100
+//
+// Each article is marked with the current version once updated, so the
+// command can be interrupted (Ctrl-C finishes the articles in progress) and
+// run again to resume where it stopped.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/canonical"
+	"github.com/vitsensei/infogrid/pkg/config"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/textrank"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 100, "number of articles read from the database at once")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of articles processed in parallel")
+	dryRun := flag.Bool("dry-run", false, "only count the articles to process")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	must(err)
+
+	if *batchSize < 1 || *workers < 1 {
+		must(fmt.Errorf("-batch and -workers must be at least 1"))
+	}
+
+	if cfg.Summariser.TagConfig != "" {
+		c, err := canonical.Load(cfg.Summariser.TagConfig)
+		must(err)
+		extractor.SetCanonicaliser(c)
+	}
+	extractor.SetLimits(cfg.Summariser.NumberOfEntities, cfg.Summariser.NumberOfTags)
+
+	lemmaDict, err := textrank.ParseLemmatizationFile(cfg.Summariser.LemmatizationFile)
+	must(err)
+
+	adb := models.NewDB()
+	err = adb.Init(context.Background(), cfg.Storage.MongoURI, cfg.Storage.Database)
+	must(err)
+	defer adb.Close(context.Background())
+
+	// On SIGINT or SIGTERM, stop reading new articles and let the workers
+	// finish the ones they have.
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Fprintln(os.Stderr, "Received", sig, "- finishing the articles in progress")
+		cancel()
+	}()
+
+	total, err := adb.CountOutdated(ctx, models.AlgorithmVersion)
+	must(err)
+	fmt.Printf("%d articles to process with algorithm version %d\n", total, models.AlgorithmVersion)
+	if *dryRun || total == 0 {
+		return
+	}
+
+	b := backfill{
+		adb:       adb,
+		lemmaDict: lemmaDict,
+		ratio:     cfg.Summariser.Ratio,
+	}
+
+	start := time.Now()
+	articles := make(chan models.Article, *batchSize)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range articles {
+				if ctx.Err() == nil {
+					b.process(a)
+				}
+			}
+		}()
+	}
+
+	// Articles are read by increasing ID, so that those failing are not read
+	// again in the same run.
+	after := primitive.NilObjectID
+	queued := 0
+	for ctx.Err() == nil {
+		batch, err := adb.Outdated(ctx, models.AlgorithmVersion, after, *batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintln(os.Stderr, "[ERROR] Fail to read articles:", err)
+			}
+			break
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, a := range batch {
+			select {
+			case articles <- a:
+			case <-ctx.Done():
+			}
+		}
+		after = batch[len(batch)-1].ID
+		queued += len(batch)
+
+		fmt.Printf("%d/%d articles queued, %d updated, %d failed\n",
+			queued, total, atomic.LoadInt64(&b.updated), atomic.LoadInt64(&b.failed))
+	}
+
+	close(articles)
+	wg.Wait()
+
+	fmt.Printf("%d articles updated, %d failed in %s\n", b.updated, b.failed, time.Since(start).Round(time.Second))
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted; run the command again to resume.")
+	}
+	if ctx.Err() != nil || b.failed > 0 {
+		adb.Close(context.Background())
+		os.Exit(1)
+	}
+}
+
+type backfill struct {
+	adb       *models.ArticleDB
+	lemmaDict map[string]string
+	ratio     float64
+
+	// Counters, accessed atomically
+	updated int64
+	failed  int64
+}
+
+// process summarises and tags a again. It is not cancelled by Ctrl-C, so
+// that an article is never left half updated.
+func (b *backfill) process(a models.Article) {
+	err := b.recompute(&a)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = b.adb.UpdateProcessed(ctx, a)
+		cancel()
+	}
+
+	if err != nil {
+		atomic.AddInt64(&b.failed, 1)
+		fmt.Fprintln(os.Stderr, "[ERROR]", a.URL, err)
+		return
+	}
+
+	atomic.AddInt64(&b.updated, 1)
+}
+
+func (b *backfill) recompute(a *models.Article) error {
+	t, err := textrank.NewText(a.Text, b.lemmaDict)
+	if err != nil {
+		return err
+	}
+	a.SummarisedText = t.Summarise(b.ratio)
+
+	err = extractor.TagArticle(a)
+	if err != nil {
+		return err
+	}
+
+	a.AlgorithmVersion = models.AlgorithmVersion
+	return nil
+}
+
+func must(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
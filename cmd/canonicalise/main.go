@@ -0,0 +1,67 @@
+// Command canonicalise applies the current tag configuration to the tags of
+// the articles already stored, for example after adding aliases:
+//
+//	go run ./cmd/canonicalise -tags configs/tags.json -dry-run
+//
+// It only rewrites the stored tags; the articles are not tagged again.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/canonical"
+	"github.com/vitsensei/infogrid/pkg/config"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"os"
+	"reflect"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "print the changes without writing them")
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	must(err)
+
+	c := canonical.Default()
+	if cfg.Summariser.TagConfig != "" {
+		c, err = canonical.Load(cfg.Summariser.TagConfig)
+		must(err)
+	}
+
+	adb := models.NewDB()
+	ctx := context.Background()
+	err = adb.Init(ctx, cfg.Storage.MongoURI, cfg.Storage.Database)
+	must(err)
+	defer adb.Close(ctx)
+
+	as, err := adb.AllArticles(ctx)
+	must(err)
+
+	changed := 0
+	for _, a := range as {
+		tags := c.Canonicalise(a.Tags)
+		if reflect.DeepEqual(tags, a.Tags) || (len(tags) == 0 && len(a.Tags) == 0) {
+			continue
+		}
+
+		changed++
+		fmt.Printf("%s\n\t%q -> %q\n", a.URL, a.Tags, tags)
+		if *dryRun {
+			continue
+		}
+
+		err = adb.UpdateTags(ctx, a.URL, tags)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR] Fail to update", a.URL, err)
+		}
+	}
+
+	fmt.Printf("%d of %d articles changed\n", changed, len(as))
+}
+
+func must(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,539 @@
+// Command infogrid uses the summariser, the tagger and the sources outside
+// of the server:
+//
+//	infogrid summarise [-ratio 0.2] [file | url | -]
+//	infogrid tags [-n 5] [-entities] [file | url | -]
+//	infogrid keywords [-n 10] [file | url | -]
+//	infogrid capture -source nytimes [-dry-run]
+//	infogrid export [-o articles.jsonl] [-format jsonl | csv] [-section s] [-tag t] [-from date] [-to date]
+//	infogrid import [-format jsonl | csv] [file | -]
+//	infogrid clean [-dry-run]
+//
+// export writes the articles, text included, as JSON Lines or CSV, and import
+// stores them again, replacing the articles with the same URL. clean applies
+// the retention rules of the configuration and prints its report, then
+// deletes the old snapshots.
+//
+// Text is read from the standard input when no file or URL is given; the text
+// of a URL is extracted from its <p> elements. Every subcommand also accepts
+// the configuration flags of the server, see infogrid <command> -h.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/canonical"
+	"github.com/vitsensei/infogrid/pkg/config"
+	"github.com/vitsensei/infogrid/pkg/controller"
+	"github.com/vitsensei/infogrid/pkg/export"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/sources"
+	"github.com/vitsensei/infogrid/pkg/textrank"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"summarise": {"summarise [-ratio 0.2] [file | url | -]", summarise},
+	"tags":      {"tags [-n 5] [-entities] [file | url | -]", tags},
+	"keywords":  {"keywords [-n 10] [file | url | -]", keywords},
+	"capture":   {"capture -source nytimes [-dry-run]", capture},
+	"export":    {"export [-o articles.jsonl] [-format jsonl | csv] [-section s] [-tag t] [-from date] [-to date]", exportArticles},
+	"import":    {"import [-format jsonl | csv] [file | -]", importArticles},
+	"clean":     {"clean [-dry-run]", clean},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "\tinfogrid", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	// Ctrl-C cancels the requests and the capture in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	err := cmd.run(ctx, os.Args[2:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// load parses the arguments of the subcommand, whose flags are registered
+// on fs, together with the configuration flags.
+func load(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Summariser.TagConfig != "" {
+		c, err := canonical.Load(cfg.Summariser.TagConfig)
+		if err != nil {
+			return nil, err
+		}
+		extractor.SetCanonicaliser(c)
+	}
+	extractor.SetLimits(cfg.Summariser.NumberOfEntities, cfg.Summariser.NumberOfTags)
+	extractor.SetFetcher(fetcher.New(cfg.FetcherConfig()))
+
+	return cfg, nil
+}
+
+// lemmatization returns the lemmatization list of the configuration, or nil
+// (no lemmatization) with a warning if it cannot be read.
+func lemmatization(cfg *config.Config) map[string]string {
+	lemmaDict, err := textrank.ParseLemmatizationFile(cfg.Summariser.LemmatizationFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[WARNING] Summarising without lemmatization:", err)
+		return nil
+	}
+
+	return lemmaDict
+}
+
+// readText reads the text of the file or URL given as the only argument, or
+// of the standard input.
+func readText(ctx context.Context, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", errors.New("expected a single file or URL")
+	}
+
+	if len(args) == 0 || args[0] == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		return string(b), err
+	}
+
+	if strings.HasPrefix(args[0], "http://") || strings.HasPrefix(args[0], "https://") {
+		page, err := extractor.ExtractTextFromURL(ctx, args[0])
+		if err != nil {
+			return "", err
+		}
+		return extractor.ExtractText(page)
+	}
+
+	b, err := ioutil.ReadFile(args[0])
+	return string(b), err
+}
+
+func newText(cfg *config.Config, text string) (*textrank.Text, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("the text is empty")
+	}
+
+	return textrank.NewText(text, lemmatization(cfg))
+}
+
+func summarise(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("summarise", flag.ExitOnError)
+	ratio := fs.Float64("ratio", 0, "share of the words kept in the summary (default summariser.ratio)")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	if *ratio == 0 {
+		*ratio = cfg.Summariser.Ratio
+	}
+
+	text, err := readText(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	t, err := newText(cfg, text)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(t.Summarise(*ratio))
+	return nil
+}
+
+func tags(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	n := fs.Int("n", 0, "number of tags (default summariser.number_of_tags)")
+	entities := fs.Bool("entities", false, "print the entities with their type, count and salience as JSON")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	if *n == 0 {
+		*n = cfg.Summariser.NumberOfTags
+		if *entities {
+			*n = cfg.Summariser.NumberOfEntities
+		}
+	}
+
+	text, err := readText(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	if *entities {
+		es, err := extractor.ExtractEntities(text, *n)
+		if err != nil {
+			return err
+		}
+		return printJSON(os.Stdout, es)
+	}
+
+	ts, err := extractor.ExtractTags(text, *n)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range ts {
+		fmt.Println(tag)
+	}
+	return nil
+}
+
+func keywords(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("keywords", flag.ExitOnError)
+	n := fs.Int("n", 10, "number of keywords")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+
+	text, err := readText(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	t, err := newText(cfg, text)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range t.Keywords(*n) {
+		fmt.Printf("%s\t%.3f\n", k.Word, k.Score)
+	}
+	return nil
+}
+
+func capture(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	source := fs.String("source", "", "source to capture: "+strings.Join(config.SourceNames, " or "))
+	dryRun := fs.Bool("dry-run", false, "print the summarised articles as JSON instead of storing them")
+	within := fs.Duration("since", 0, "only capture the articles published within this duration, e.g. 24h, if the source gives their date")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+
+	src, err := sources.New(*source, cfg.Sources[*source])
+	if err != nil {
+		return err
+	}
+	lemmaDict := lemmatization(cfg)
+
+	var since time.Time
+	if *within > 0 {
+		since = time.Now().Add(-*within)
+	}
+
+	if *dryRun {
+		return preview(ctx, src, since, cfg.Summariser.Ratio, lemmaDict)
+	}
+
+	adb := models.NewDB()
+	err = adb.Init(ctx, cfg.Storage.MongoURI, cfg.Storage.Database)
+	if err != nil {
+		return err
+	}
+	defer adb.Close(context.Background())
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	ac := controller.NewArticleController(adb, nil, cfg.Storage.MaxArticles, logger, src)
+	ac.SetSummariser(cfg.Summariser.Ratio, lemmaDict)
+	ac.SetHealth(cfg.HealthMonitor(), cfg.Health.WebhookURL)
+	ac.SetRetries(cfg.Retry.MaxAttempts, time.Duration(cfg.Retry.Backoff))
+	ac.SetPipeline(cfg.Pipeline.ExtractWorkers, cfg.Pipeline.SummariseWorkers, cfg.Pipeline.StoreWorkers,
+		time.Duration(cfg.Pipeline.ArticleTimeout))
+
+	result := ac.CaptureArticles(ctx, since, src)
+	fmt.Printf("%d articles found, %d new, %d failed, %d disallowed by robots.txt\n",
+		result.Found, result.New, result.Failed, result.Skipped)
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("capture failed: %s", strings.Join(result.Errors, "; "))
+	}
+	return nil
+}
+
+// preview prints as JSON the articles of s published since the given time,
+// summarised, without storing them. The articles read are printed even if
+// others could not be read; the errors go to the standard error.
+func preview(ctx context.Context, s controller.Source, since time.Time, ratio float64, lemmaDict map[string]string) error {
+	r, canFetch := s.(controller.Refetcher)
+	listed, errs := s.Fetch(ctx, since)
+
+	// Only the errors preventing articles from being listed fail the command
+	var listErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+
+			var ae *controller.ArticleError
+			if !errors.As(err, &ae) {
+				listErr = err
+			}
+		}
+	}()
+
+	articles := make([]models.Article, 0)
+	for article := range listed {
+		if article.Text == "" && canFetch {
+			err := r.FetchArticle(ctx, &article)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", article.URL, err)
+				continue
+			}
+			_ = extractor.TagArticle(&article)
+		}
+
+		t, err := textrank.NewText(article.Text, lemmaDict)
+		if err == nil {
+			article.SummarisedText = t.Summarise(ratio)
+		}
+		articles = append(articles, article)
+	}
+	<-done
+
+	err := printJSON(os.Stdout, articles)
+	if err != nil {
+		return err
+	}
+
+	return listErr
+}
+
+func exportArticles(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "", "file to write, the standard output by default")
+	format := fs.String("format", "", "jsonl or csv (default from the extension of -o, or jsonl)")
+	section := fs.String("section", "", "comma separated sections; articles from any of them")
+	tag := fs.String("tag", "", "comma separated tags; articles having all of them")
+	from := fs.String("from", "", "articles captured from this date (2021-01-30) or RFC 3339 time")
+	to := fs.String("to", "", "articles captured before this date or RFC 3339 time")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = export.FormatOf(*output)
+	}
+
+	filter, err := export.ParseFilter(*section, *tag, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	adb := models.NewDB()
+	err = adb.Init(ctx, cfg.Storage.MongoURI, cfg.Storage.Database)
+	if err != nil {
+		return err
+	}
+	defer adb.Close(context.Background())
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ew, err := export.NewWriter(w, *format)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	err = adb.EachArticle(ctx, filter, func(a models.Article) error {
+		n++
+		return ew.Write(a)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ew.Flush()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d articles exported\n", n)
+	return nil
+}
+
+func importArticles(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "jsonl or csv (default from the extension of the file, or jsonl)")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return errors.New("expected a single file")
+	}
+
+	var r io.Reader = os.Stdin
+	path := fs.Arg(0)
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if *format == "" {
+		*format = export.FormatOf(path)
+	}
+
+	er, err := export.NewReader(r, *format)
+	if err != nil {
+		return err
+	}
+
+	adb := models.NewDB()
+	err = adb.Init(ctx, cfg.Storage.MongoURI, cfg.Storage.Database)
+	if err != nil {
+		return err
+	}
+	defer adb.Close(context.Background())
+
+	// A malformed article is reported and skipped, but a malformed file stops
+	// the import, since the next articles cannot be found reliably.
+	inserted, replaced, failed := 0, 0, 0
+	for ctx.Err() == nil {
+		a, err := er.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "[ERROR]", err)
+			failed++
+			continue
+		}
+
+		isNew, err := adb.UpsertByURL(ctx, a)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ERROR]", a.URL+":", err)
+			failed++
+			continue
+		}
+		if isNew {
+			inserted++
+		} else {
+			replaced++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d articles inserted, %d replaced, %d failed\n", inserted, replaced, failed)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d articles could not be imported", failed)
+	}
+	return nil
+}
+
+func clean(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	cfg, err := load(fs, args)
+	if err != nil {
+		return err
+	}
+
+	adb := models.NewDB()
+	err = adb.Init(ctx, cfg.Storage.MongoURI, cfg.Storage.Database)
+	if err != nil {
+		return err
+	}
+	defer adb.Close(context.Background())
+
+	var archive models.Archiver
+	if !*dryRun {
+		archive = cfg.NewArchiver(adb)
+	}
+
+	report, err := adb.ApplyRetention(ctx, cfg.RetentionRules(), archive, *dryRun)
+	if archive != nil {
+		if cerr := archive.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if perr := printJSON(os.Stdout, report); perr != nil && err == nil {
+		err = perr
+	}
+	if err != nil || *dryRun || cfg.Snapshots.MaxAge == 0 {
+		return err
+	}
+
+	n, err := adb.CleanSnapshots(ctx, time.Duration(cfg.Snapshots.MaxAge))
+	fmt.Fprintf(os.Stderr, "%d snapshots deleted\n", n)
+	return err
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
@@ -1,40 +1,57 @@
 package main
 
 import (
-	"github.com/gorilla/mux"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/canonical"
+	"github.com/vitsensei/infogrid/pkg/config"
 	"github.com/vitsensei/infogrid/pkg/controller"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
 	"github.com/vitsensei/infogrid/pkg/models"
-	"github.com/vitsensei/infogrid/pkg/nytimes"
-	"github.com/vitsensei/infogrid/pkg/reuters"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"github.com/vitsensei/infogrid/pkg/sources"
+	"github.com/vitsensei/infogrid/pkg/textrank"
 	"github.com/vitsensei/infogrid/pkg/views/articles"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-var (
-	mongoURI = "mongodb://" + os.Getenv("MONGO_HST") + ":" + os.Getenv("MONGO_PRT") + "/"
-)
-
 func main() {
+	// Read the configuration (defaults < file < environment < flags)
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err == nil {
+		err = cfg.ValidateSources()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	// Create Database
 	adb := models.NewDB()
-	err := adb.Init(mongoURI)
-	//adb.DestructiveReset()
-	defer adb.Close()
-	must(err)
-
-	// Create API and controller
-	nytimesAPI := nytimes.NewAPI()
+	err = adb.Init(context.Background(), cfg.Storage.MongoURI, cfg.Storage.Database)
+	//adb.DestructiveReset(context.Background())
 	must(err)
 
-	reuterAPI := reuters.NewAPI()
+	// Load the tag aliases and stoplist, if configured
+	if cfg.Summariser.TagConfig != "" {
+		c, err := canonical.Load(cfg.Summariser.TagConfig)
+		must(err)
+		extractor.SetCanonicaliser(c)
+	}
+	extractor.SetLimits(cfg.Summariser.NumberOfEntities, cfg.Summariser.NumberOfTags)
+	extractor.SetFetcher(fetcher.New(cfg.FetcherConfig()))
 
 	views := articles.NewView("display", "articles/simple_display")
 
-	_ = os.Remove("infogrid_log")
-	logFile, err := os.OpenFile("infogrid_log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	_ = os.Remove(cfg.LogFile)
+	logFile, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err == nil {
 		defer logFile.Close()
 	} else {
@@ -44,29 +61,113 @@ func main() {
 	logger := log.New(nil, "logger: ", log.LstdFlags)
 	logger.SetOutput(logFile)
 
-	ac := controller.NewArticleController(adb, views, 25, logger, nytimesAPI, reuterAPI)
+	// Create API and controller
+	var srcs []controller.Source
+	for _, name := range cfg.EnabledSources() {
+		api, err := sources.New(name, cfg.Sources[name])
+		must(err)
+		srcs = append(srcs, api)
+	}
+
+	ac := controller.NewArticleController(adb, views, cfg.Storage.MaxArticles, logger, srcs...)
+
+	lemmaDict, err := textrank.ParseLemmatizationFile(cfg.Summariser.LemmatizationFile)
+	if err != nil {
+		logger.Println("[WARNING] Summarising without lemmatization:", err)
+	}
+	ac.SetSummariser(cfg.Summariser.Ratio, lemmaDict)
+	ac.SetSnapshots(cfg.Snapshots.Enabled, time.Duration(cfg.Snapshots.MaxAge))
+	ac.SetRetention(cfg.RetentionRules(), func() models.Archiver {
+		return cfg.NewArchiver(adb)
+	})
+	ac.SetHealth(cfg.HealthMonitor(), cfg.Health.WebhookURL)
+	ac.SetRetries(cfg.Retry.MaxAttempts, time.Duration(cfg.Retry.Backoff))
+	ac.SetPipeline(cfg.Pipeline.ExtractWorkers, cfg.Pipeline.SummariseWorkers, cfg.Pipeline.StoreWorkers,
+		time.Duration(cfg.Pipeline.ArticleTimeout))
+	ac.SetTrendBucket(time.Duration(cfg.Scheduler.Interval))
+
+	// Schedule one capture job per source
+	sched := scheduler.New(adb, logger)
+	for i, name := range cfg.EnabledSources() {
+		schedule, err := cfg.Schedule(name)
+		must(err)
+		sched.Add("capture:"+name, schedule, time.Duration(cfg.Scheduler.Jitter), ac.CaptureJob(srcs[i]))
+	}
+
+	// And one job fetching again the recent articles of each source
+	if cfg.Refresh.Schedule != "" {
+		schedule, err := scheduler.Parse(cfg.Refresh.Schedule)
+		must(err)
+		for i, name := range cfg.EnabledSources() {
+			job := ac.RefreshJob(srcs[i], time.Duration(cfg.Refresh.Window))
+			sched.Add("refresh:"+name, schedule, time.Duration(cfg.Scheduler.Jitter), job)
+		}
+	}
 
-	go ac.RunPeriodicCapture(4)
+	// And one job capturing again the articles which could not be captured
+	if cfg.Retry.Schedule != "" {
+		schedule, err := scheduler.Parse(cfg.Retry.Schedule)
+		must(err)
+		for i, name := range cfg.EnabledSources() {
+			sched.Add("retry:"+name, schedule, time.Duration(cfg.Scheduler.Jitter), ac.RetryJob(srcs[i]))
+		}
+	}
+	ac.SetScheduler(sched)
+	sched.Start()
 
 	// Create router
-	r := mux.NewRouter()
-	r.HandleFunc("/", ac.ShowArticles)
-	r.HandleFunc("/tags", ac.GetTags)
-	r.HandleFunc("/sections", ac.GetSections)
-	r.HandleFunc("/articles", ac.GetArticles)
-	r.Path("/articles").Queries("section", "{section}").HandlerFunc(ac.GetArticles)
+	r := newRouter(ac, logger, cfg.Admin.Token)
 
 	http.Handle("/", r)
 
 	srv := &http.Server{
 		Handler:      r,
-		Addr:         ":8000",
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		Addr:         cfg.Server.Addr,
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
 	}
 
-	err = srv.ListenAndServe()
-	must(err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	// Wait for a signal, then stop accepting requests and captures, give the
+	// ones in progress some time to finish, and disconnect from the database.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-signals:
+		logger.Println("[INFO] Received", sig, "- shutting down")
+	case err := <-serverErr:
+		logger.Println("[ERROR] HTTP server stopped:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		logger.Println("[ERROR] HTTP server did not shut down cleanly:", err)
+	}
+
+	err = sched.Shutdown(ctx)
+	if err != nil {
+		logger.Println("[ERROR] Capture in progress cancelled:", err)
+	}
+
+	// The database gets its own timeout, so that it is disconnected
+	// properly even if the capture used all of ctx.
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelClose()
+
+	err = adb.Close(closeCtx)
+	if err != nil {
+		logger.Println("[ERROR] Fail to disconnect from the database:", err)
+	}
+
+	logger.Println("[INFO] Shut down")
 }
 
 func must(err error) {
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/vitsensei/infogrid/pkg/controller"
+	"github.com/vitsensei/infogrid/pkg/openapi"
+	"log"
+	"net/http"
+)
+
+// Every route registered here must be described in openapi.Spec,
+// which is checked by routes_test.go.
+// The /admin routes require adminToken, and are disabled if it is empty.
+func newRouter(ac *controller.Articles, logger *log.Logger, adminToken string) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(controller.RequestID, controller.Recover(logger))
+	r.NotFoundHandler = controller.RequestID(http.HandlerFunc(controller.NotFound))
+	r.MethodNotAllowedHandler = controller.RequestID(http.HandlerFunc(controller.MethodNotAllowed))
+
+	r.HandleFunc("/", ac.ShowArticles).Methods(http.MethodGet)
+	r.HandleFunc("/tags", ac.GetTags).Methods(http.MethodGet)
+	r.HandleFunc("/tags/stats", ac.GetTagStats).Methods(http.MethodGet)
+	r.HandleFunc("/sections", ac.GetSections).Methods(http.MethodGet)
+	r.HandleFunc("/sections/stats", ac.GetSectionStats).Methods(http.MethodGet)
+	r.HandleFunc("/articles", ac.GetArticles).Methods(http.MethodGet)
+	r.HandleFunc("/entities", ac.GetEntities).Methods(http.MethodGet)
+	r.HandleFunc("/trending", ac.GetTrending).Methods(http.MethodGet)
+	r.HandleFunc("/articles/{id}/snapshot", ac.GetSnapshot).Methods(http.MethodGet)
+	r.HandleFunc("/articles/{id}/versions", ac.GetVersions).Methods(http.MethodGet)
+	r.HandleFunc("/export", ac.ExportArticles).Methods(http.MethodGet)
+
+	admin := controller.AdminOnly(adminToken)
+	r.Handle("/admin/jobs", admin(http.HandlerFunc(ac.GetJobs))).Methods(http.MethodGet)
+	r.Handle("/admin/jobs/{id}", admin(http.HandlerFunc(ac.GetJob))).Methods(http.MethodGet)
+	r.Handle("/admin/sources", admin(http.HandlerFunc(ac.GetSources))).Methods(http.MethodGet)
+	r.Handle("/admin/failures", admin(http.HandlerFunc(ac.GetFailures))).Methods(http.MethodGet)
+	r.Handle("/admin/capture", admin(http.HandlerFunc(ac.TriggerCapture))).Methods(http.MethodPost)
+	r.Handle("/admin/resummarise", admin(http.HandlerFunc(ac.Resummarise))).Methods(http.MethodPost)
+	r.Handle("/admin/retag", admin(http.HandlerFunc(ac.Retag))).Methods(http.MethodPost)
+	r.Handle("/admin/clean", admin(http.HandlerFunc(ac.CleanArticles))).Methods(http.MethodPost)
+	r.Handle("/admin/articles/{id}/bookmark", admin(http.HandlerFunc(ac.BookmarkArticle))).Methods(http.MethodPut)
+	r.Handle("/admin/articles/{id}/bookmark", admin(http.HandlerFunc(ac.UnbookmarkArticle))).Methods(http.MethodDelete)
+	r.Handle("/admin/reset", admin(http.HandlerFunc(ac.ResetDatabase))).Methods(http.MethodPost)
+
+	r.HandleFunc("/openapi.json", openapi.ServeSpec).Methods(http.MethodGet)
+	r.HandleFunc("/docs", openapi.ServeDocs).Methods(http.MethodGet)
+
+	return r
+}
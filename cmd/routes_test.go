@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/vitsensei/infogrid/pkg/controller"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/openapi"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func registeredRoutes(t *testing.T) map[string][]string {
+	r := newRouter(&controller.Articles{}, log.New(ioutil.Discard, "", 0), "")
+
+	routes := make(map[string][]string)
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // Routes without a path (e.g. prefix-less matchers) cannot be documented
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s does not restrict its methods", path)
+			return nil
+		}
+
+		routes[path] = append(routes[path], methods...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return routes
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	spec := openapi.Spec()
+
+	for path, methods := range registeredRoutes(t) {
+		item, ok := spec.Paths[path]
+		if !ok {
+			t.Errorf("route %s is missing from openapi.Spec", path)
+			continue
+		}
+
+		for _, method := range methods {
+			if _, ok := item[strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is missing from openapi.Spec", method, path)
+			}
+		}
+	}
+}
+
+func TestEveryDocumentedRouteExists(t *testing.T) {
+	routes := registeredRoutes(t)
+
+	for path, item := range openapi.Spec().Paths {
+		methods, ok := routes[path]
+		if !ok {
+			t.Errorf("openapi.Spec documents %s but no route is registered", path)
+			continue
+		}
+
+		for method := range item {
+			found := false
+			for _, m := range methods {
+				if strings.EqualFold(m, method) {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("openapi.Spec documents %s %s but no route is registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOperationIDsAreUnique(t *testing.T) {
+	seen := make(map[string]string)
+
+	for path, item := range openapi.Spec().Paths {
+		for method, op := range item {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			}
+
+			if other, ok := seen[op.OperationID]; ok {
+				t.Errorf("operationId %s is used by both %s and %s %s", op.OperationID, other, method, path)
+			}
+			seen[op.OperationID] = method + " " + path
+		}
+	}
+}
+
+// jsonFields returns the names encoding/json uses for the exported fields of v.
+func jsonFields(v interface{}) []string {
+	var fields []string
+
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+
+		fields = append(fields, name)
+	}
+
+	sort.Strings(fields)
+	return fields
+}
+
+func TestArticleSchemaMatchesModel(t *testing.T) {
+	schema := openapi.Spec().Components.Schemas["Article"]
+
+	var documented []string
+	for name := range schema.Properties {
+		documented = append(documented, name)
+	}
+	sort.Strings(documented)
+
+	if actual := jsonFields(models.Article{}); !reflect.DeepEqual(documented, actual) {
+		t.Errorf("Article schema documents %v but models.Article encodes %v", documented, actual)
+	}
+}
@@ -0,0 +1,223 @@
+package canonical
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+var (
+	defaultTitles = []string{ // Removed from the beginning of the tags
+		"mr.",
+		"ms.",
+		"mrs.",
+		"dr.",
+		"sen.",
+		"rep.",
+		"gov.",
+		"president",
+	}
+
+	defaultStoplist = []string{ // Used to filter out the common tags
+		"congress",
+		"state",
+		"department",
+		"north",
+		"south",
+		"east",
+		"west",
+	}
+
+	trimmedCharacters = " !@#$%^&*(),./<>?;':{}[]|\\\"-=_+~`"
+)
+
+// Config is the content of the tag configuration file, for example:
+//
+//	{
+//		"aliases": {"joe biden": ["biden", "joseph biden", "president-elect biden"]},
+//		"stoplist": ["congress", "state"],
+//		"titles": ["mr.", "ms.", "president"]
+//	}
+//
+// A nil Stoplist or Titles keeps the default list, an empty one disables it.
+type Config struct {
+	Aliases  map[string][]string `json:"aliases"` // canonical tag -> its aliases
+	Stoplist []string            `json:"stoplist"`
+	Titles   []string            `json:"titles"`
+}
+
+type Canonicaliser struct {
+	aliases  map[string]string // alias -> canonical tag
+	stoplist map[string]struct{}
+	titles   []string
+}
+
+// Default returns a Canonicaliser without aliases, using the default
+// stoplist and titles.
+func Default() *Canonicaliser {
+	return New(Config{})
+}
+
+func New(cfg Config) *Canonicaliser {
+	c := Canonicaliser{
+		aliases:  make(map[string]string),
+		stoplist: make(map[string]struct{}),
+		titles:   defaultTitles,
+	}
+
+	if cfg.Titles != nil {
+		c.titles = nil
+		for _, title := range cfg.Titles {
+			c.titles = append(c.titles, strings.ToLower(title))
+		}
+	}
+
+	stoplist := defaultStoplist
+	if cfg.Stoplist != nil {
+		stoplist = cfg.Stoplist
+	}
+	for _, s := range stoplist {
+		c.stoplist[c.normalise(s)] = struct{}{}
+	}
+
+	for tag, aliases := range cfg.Aliases {
+		tag = c.normalise(tag)
+		for _, alias := range aliases {
+			c.aliases[c.normalise(alias)] = tag
+		}
+	}
+
+	return &c
+}
+
+// Load reads a Config from a JSON file.
+func Load(path string) (*Canonicaliser, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg), nil
+}
+
+// normalise a single tag:
+//  1. lowercase everything
+//  2. Remove the titles at the beginning (Mr., Ms., ...)
+//  3. Trim trailing white space and some random punctuation
+//  4. Collapse repeated white space
+func (c *Canonicaliser) normalise(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+
+	for _, title := range c.titles {
+		if strings.HasPrefix(tag, title+" ") {
+			tag = tag[len(title)+1:]
+		}
+	}
+
+	tag = strings.Trim(tag, trimmedCharacters)
+
+	return strings.Join(strings.Fields(tag), " ")
+}
+
+// Map returns the canonical form of each tag, in the same order. The
+// canonical form of a dropped tag (empty or in the stoplist) is "".
+//
+// Tags are merged in two ways:
+//  1. A tag listed as an alias in the Config is replaced by its canonical tag.
+//  2. A tag whose words appear in exactly one longer tag of the same list is
+//     a partial name of it ("biden" and "joe biden"), and is replaced by it.
+//     When several longer tags match ("smith" with "john smith" and
+//     "jane smith"), the tag is ambiguous and kept as is.
+func (c *Canonicaliser) Map(tags []string) []string {
+	mapped := make([]string, len(tags))
+	for i, tag := range tags {
+		tag = c.normalise(tag)
+		if canonicalTag, ok := c.aliases[tag]; ok {
+			tag = canonicalTag
+		}
+
+		if _, ok := c.stoplist[tag]; ok {
+			tag = ""
+		}
+
+		mapped[i] = tag
+	}
+
+	unique := make(map[string]struct{})
+	for _, tag := range mapped {
+		if tag != "" {
+			unique[tag] = struct{}{}
+		}
+	}
+
+	for i, tag := range mapped {
+		if tag == "" {
+			continue
+		}
+
+		var longer []string
+		for other := range unique {
+			if other != tag && isPartialName(tag, other) {
+				longer = append(longer, other)
+			}
+		}
+
+		if len(longer) == 1 {
+			mapped[i] = longer[0]
+		}
+	}
+
+	return mapped
+}
+
+// Canonicalise returns the unique canonical tags, keeping the order in which
+// they first appear in tags.
+func (c *Canonicaliser) Canonicalise(tags []string) []string {
+	var canonicalTags []string
+
+	seen := make(map[string]struct{})
+	for _, tag := range c.Map(tags) {
+		if tag == "" {
+			continue
+		}
+
+		if _, ok := seen[tag]; !ok {
+			seen[tag] = struct{}{}
+			canonicalTags = append(canonicalTags, tag)
+		}
+	}
+
+	return canonicalTags
+}
+
+// isPartialName is true if the words of short are a contiguous run of the
+// words of long, such as "biden" in "joe biden" or "new york" in "new york city".
+func isPartialName(short string, long string) bool {
+	shortWords := strings.Fields(short)
+	longWords := strings.Fields(long)
+	if len(shortWords) >= len(longWords) {
+		return false
+	}
+
+	for i := 0; i+len(shortWords) <= len(longWords); i++ {
+		match := true
+		for j := range shortWords {
+			if longWords[i+j] != shortWords[j] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,806 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/export"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/health"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the server. Values are resolved in this
+// order, each one overriding the previous:
+//  1. Default()
+//  2. the JSON configuration file given by -config or INFOGRID_CONFIG
+//  3. environment variables
+//  4. command line flags
+type Config struct {
+	Server     Server            `json:"server"`
+	Storage    Storage           `json:"storage"`
+	Retention  Retention         `json:"retention"`
+	Snapshots  Snapshots         `json:"snapshots"`
+	Scheduler  Scheduler         `json:"scheduler"`
+	Refresh    Refresh           `json:"refresh"`
+	Retry      Retry             `json:"retry"`
+	Pipeline   Pipeline          `json:"pipeline"`
+	Sources    map[string]Source `json:"sources"` // Keyed by source name, see SourceNames
+	Fetcher    Fetcher           `json:"fetcher"`
+	Health     Health            `json:"health"`
+	Summariser Summariser        `json:"summariser"`
+	Admin      Admin             `json:"admin"`
+	LogFile    string            `json:"log_file"`
+}
+
+type Server struct {
+	Addr         string   `json:"addr"`
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+
+	// On SIGINT or SIGTERM, time given to the requests and to the capture
+	// in progress to finish before they are cancelled.
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+}
+
+type Storage struct {
+	MongoURI    string `json:"mongo_uri"`
+	Database    string `json:"database"`
+	MaxArticles int    `json:"max_articles"` // The retention rules are only applied after a capture above this number
+}
+
+// Retention tells which articles are removed after every capture. Removed
+// articles are deleted, or archived in ArchiveCollection or in a new file of
+// ArchiveDir if one of them is set.
+type Retention struct {
+	Rules             []RetentionRule `json:"rules"` // The first rule matching an article applies; unmatched articles are kept
+	ArchiveCollection string          `json:"archive_collection,omitempty"`
+	ArchiveDir        string          `json:"archive_dir,omitempty"`
+	ArchiveFormat     string          `json:"archive_format,omitempty"` // jsonl (default) or csv
+}
+
+// Snapshots keep the HTML of the page of every new article, compressed, with
+// its fetch time and HTTP headers.
+type Snapshots struct {
+	Enabled bool     `json:"enabled"`
+	MaxAge  Duration `json:"max_age"` // Independent of the retention of the articles; 0 keeps them forever
+}
+
+// RetentionRule is the JSON form of models.RetentionRule.
+type RetentionRule struct {
+	Source         string   `json:"source,omitempty"`  // Empty for every source
+	Section        string   `json:"section,omitempty"` // Empty for every section
+	MaxAge         Duration `json:"max_age,omitempty"`
+	MaxCount       int      `json:"max_count,omitempty"`
+	KeepTags       []string `json:"keep_tags,omitempty"`
+	KeepBookmarked bool     `json:"keep_bookmarked,omitempty"`
+}
+
+type Scheduler struct {
+	Interval Duration `json:"interval"` // Time between two captures of a source without its own schedule
+	Jitter   Duration `json:"jitter"`   // Maximum random delay added to every scheduled capture
+}
+
+// Refresh tells when the recent articles of every source are fetched again,
+// to store the new version of the edited ones.
+type Refresh struct {
+	Schedule string   `json:"schedule"` // See scheduler.Parse; empty to never fetch articles again
+	Window   Duration `json:"window"`   // Articles captured less than this ago are fetched again
+}
+
+// Retry tells when the articles which could not be captured are captured
+// again. Pages without text, and pages the server refuses for good, are not
+// retried.
+type Retry struct {
+	Schedule    string   `json:"schedule"`     // See scheduler.Parse; empty to never retry them
+	MaxAttempts int      `json:"max_attempts"` // Including the first capture
+	Backoff     Duration `json:"backoff"`      // Before the first retry, doubled for every attempt up to a day
+}
+
+// Pipeline tells how the articles of a capture are processed: by how many
+// workers at every stage, and for how long at most.
+type Pipeline struct {
+	ExtractWorkers   int      `json:"extract_workers"`   // Fetching and extracting the pages
+	SummariseWorkers int      `json:"summarise_workers"` // 0 for one per CPU
+	StoreWorkers     int      `json:"store_workers"`
+	ArticleTimeout   Duration `json:"article_timeout"` // Given to fetching, then to storing, an article; 0 for no timeout
+}
+
+type Source struct {
+	Enabled  bool     `json:"enabled"`
+	Sections []string `json:"sections,omitempty"` // Empty for the default sections of the source
+	Interval Duration `json:"interval,omitempty"` // 0 to use Scheduler.Interval
+	Schedule string   `json:"schedule,omitempty"` // Cron expression such as "0 */4 * * *", overrides Interval; see scheduler.Parse
+	APIKey   string   `json:"api_key,omitempty"`
+}
+
+// Fetcher tells how the pages of the sources are fetched, see fetcher.Config.
+type Fetcher struct {
+	Timeout            Duration `json:"timeout"`
+	UserAgent          string   `json:"user_agent"`
+	Retries            int      `json:"retries"`       // For network errors, 429 and 5xx
+	RetryBackoff       Duration `json:"retry_backoff"` // Doubled for every retry
+	MaxRetryWait       Duration `json:"max_retry_wait"`
+	RatePerHost        float64  `json:"rate_per_host"` // Requests per second, 0 for no limit
+	BurstPerHost       int      `json:"burst_per_host"`
+	ConcurrencyPerHost int      `json:"concurrency_per_host"`
+	Robots             bool     `json:"robots"`    // Obey robots.txt
+	CacheDir           string   `json:"cache_dir"` // Empty to disable the cache
+	CacheMaxAge        Duration `json:"cache_max_age"`
+}
+
+// Health tells when a source is reported as broken, see health.Monitor.
+type Health struct {
+	Window     int     `json:"window"`   // Previous captures forming the baseline of every metric
+	MinRuns    int     `json:"min_runs"` // Captures needed before any alert
+	Threshold  float64 `json:"threshold"`
+	WebhookURL string  `json:"webhook_url,omitempty"` // POSTed the alerts of a source as JSON; empty to only log them
+}
+
+type Summariser struct {
+	Ratio             float64 `json:"ratio"` // Share of the words of the text kept in the summary
+	NumberOfTags      int     `json:"number_of_tags"`
+	NumberOfEntities  int     `json:"number_of_entities"`
+	TagConfig         string  `json:"tag_config,omitempty"` // See canonical.Config
+	LemmatizationFile string  `json:"lemmatization_file"`
+}
+
+type Admin struct {
+	// Sent as "Authorization: Bearer <token>" to the /admin endpoints.
+	// Empty to disable them.
+	Token string `json:"token,omitempty"`
+}
+
+// SourceNames lists the sources known by sources.New.
+var SourceNames = []string{"nytimes", "reuters"}
+
+func Default() *Config {
+	fd := fetcher.DefaultConfig()
+	hd := health.NewMonitor()
+
+	return &Config{
+		Server: Server{
+			Addr:            ":8000",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(15 * time.Second),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Storage: Storage{
+			MongoURI:    "mongodb://localhost:27017/",
+			Database:    "info_grid",
+			MaxArticles: 25,
+		},
+		Retention: Retention{
+			Rules: []RetentionRule{
+				{MaxAge: Duration(72 * time.Hour), KeepBookmarked: true},
+			},
+		},
+		Snapshots: Snapshots{
+			MaxAge: Duration(90 * 24 * time.Hour),
+		},
+		Scheduler: Scheduler{
+			Interval: Duration(4 * time.Hour),
+			Jitter:   Duration(time.Minute),
+		},
+		Refresh: Refresh{
+			Schedule: "30 */2 * * *",
+			Window:   Duration(24 * time.Hour),
+		},
+		Retry: Retry{
+			Schedule:    "45 * * * *",
+			MaxAttempts: 5,
+			Backoff:     Duration(time.Hour),
+		},
+		Pipeline: Pipeline{
+			ExtractWorkers: 4,
+			StoreWorkers:   2,
+			ArticleTimeout: Duration(5 * time.Minute),
+		},
+		Sources: map[string]Source{
+			"nytimes": {Enabled: true},
+			"reuters": {Enabled: true},
+		},
+		Fetcher: Fetcher{
+			Timeout:            Duration(fd.Timeout),
+			UserAgent:          fd.UserAgent,
+			Retries:            fd.Retries,
+			RetryBackoff:       Duration(fd.RetryBackoff),
+			MaxRetryWait:       Duration(fd.MaxRetryWait),
+			RatePerHost:        fd.RatePerHost,
+			BurstPerHost:       fd.BurstPerHost,
+			ConcurrencyPerHost: fd.ConcurrencyPerHost,
+			Robots:             fd.Robots,
+			CacheDir:           "cache",
+			CacheMaxAge:        Duration(7 * 24 * time.Hour),
+		},
+		Health: Health{
+			Window:    hd.Window,
+			MinRuns:   hd.MinRuns,
+			Threshold: hd.Threshold,
+		},
+		Summariser: Summariser{
+			Ratio:             0.1,
+			NumberOfTags:      3,
+			NumberOfEntities:  10,
+			LemmatizationFile: "./pkg/textrank/lemmatization_list",
+		},
+		LogFile: "infogrid_log",
+	}
+}
+
+// flags holds the values of the command line flags. Only the flags actually
+// set are applied, so that an unset flag does not override the file or the
+// environment with its default value.
+type flags struct {
+	set map[string]bool
+
+	config      string
+	addr        string
+	mongoURI    string
+	database    string
+	maxArticles int
+	interval    time.Duration
+	sources     string
+	logFile     string
+	tagConfig   string
+}
+
+func registerFlags(fs *flag.FlagSet) *flags {
+	f := flags{}
+	fs.StringVar(&f.config, "config", "", "path of the JSON configuration file (env INFOGRID_CONFIG)")
+	fs.StringVar(&f.addr, "addr", "", "address the HTTP server listens on, e.g. :8000 (env INFOGRID_ADDR)")
+	fs.StringVar(&f.mongoURI, "mongo-uri", "", "MongoDB connection string (env INFOGRID_MONGO_URI, or MONGO_HST and MONGO_PRT)")
+	fs.StringVar(&f.database, "database", "", "MongoDB database name (env INFOGRID_DATABASE)")
+	fs.IntVar(&f.maxArticles, "max-articles", 0, "number of stored articles above which old articles are deleted (env INFOGRID_MAX_ARTICLES)")
+	fs.DurationVar(&f.interval, "interval", 0, "time between two captures, e.g. 4h (env INFOGRID_INTERVAL)")
+	fs.StringVar(&f.sources, "sources", "", "comma separated list of the enabled sources, e.g. nytimes,reuters (env INFOGRID_SOURCES)")
+	fs.StringVar(&f.logFile, "log", "", "path of the log file (env INFOGRID_LOG)")
+	fs.StringVar(&f.tagConfig, "tags", "", "path of the tag configuration file (env TAG_CONFIG)")
+
+	return &f
+}
+
+// Load parses args with fs, on which the configuration flags are registered
+// first (callers can register their own flags before), then resolves the
+// configuration and validates it.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	f := registerFlags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	f.set = make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) {
+		f.set[fl.Name] = true
+	})
+
+	cfg := Default()
+
+	path := os.Getenv("INFOGRID_CONFIG")
+	if f.set["config"] {
+		path = f.config
+	}
+	if path != "" {
+		err = cfg.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = cfg.loadEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.applyFlags(f)
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	// Sources are merged one by one, so that the file only needs to
+	// mention the sources it changes.
+	var file struct {
+		Config
+		Sources map[string]*json.RawMessage `json:"sources"`
+	}
+	file.Config = *c
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&file)
+	if err != nil {
+		return fmt.Errorf("config: cannot parse %s: %w", path, err)
+	}
+
+	sources := c.Sources
+	*c = file.Config
+	c.Sources = sources
+	for name, raw := range file.Sources {
+		s := c.Sources[name]
+		if raw != nil {
+			err = json.Unmarshal(*raw, &s)
+			if err != nil {
+				return fmt.Errorf("config: cannot parse sources.%s in %s: %w", name, path, err)
+			}
+		}
+		c.Sources[name] = s
+	}
+
+	return nil
+}
+
+func (c *Config) loadEnv(getenv func(string) string) error {
+	if host := getenv("MONGO_HST"); host != "" {
+		c.Storage.MongoURI = "mongodb://" + host + ":" + getenv("MONGO_PRT") + "/"
+	}
+
+	if v := getenv("INFOGRID_MONGO_URI"); v != "" {
+		c.Storage.MongoURI = v
+	}
+
+	if v := getenv("INFOGRID_DATABASE"); v != "" {
+		c.Storage.Database = v
+	}
+
+	if v := getenv("INFOGRID_ADDR"); v != "" {
+		c.Server.Addr = v
+	}
+
+	if v := getenv("INFOGRID_LOG"); v != "" {
+		c.LogFile = v
+	}
+
+	if v := getenv("TAG_CONFIG"); v != "" {
+		c.Summariser.TagConfig = v
+	}
+
+	if v := getenv("INFOGRID_ADMIN_TOKEN"); v != "" {
+		c.Admin.Token = v
+	}
+
+	if v := getenv("INFOGRID_HEALTH_WEBHOOK"); v != "" {
+		c.Health.WebhookURL = v
+	}
+
+	if v := getenv("NYTIMES_KEY"); v != "" {
+		s := c.Sources["nytimes"]
+		s.APIKey = v
+		c.Sources["nytimes"] = s
+	}
+
+	if v := getenv("INFOGRID_MAX_ARTICLES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: INFOGRID_MAX_ARTICLES=%q is not an integer", v)
+		}
+		c.Storage.MaxArticles = n
+	}
+
+	if v := getenv("INFOGRID_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("config: INFOGRID_INTERVAL=%q is not a duration such as 4h", v)
+		}
+		c.Scheduler.Interval = Duration(d)
+	}
+
+	if v := getenv("INFOGRID_SOURCES"); v != "" {
+		c.enableOnly(v)
+	}
+
+	return nil
+}
+
+func (c *Config) applyFlags(f *flags) {
+	if f.set["addr"] {
+		c.Server.Addr = f.addr
+	}
+
+	if f.set["mongo-uri"] {
+		c.Storage.MongoURI = f.mongoURI
+	}
+
+	if f.set["database"] {
+		c.Storage.Database = f.database
+	}
+
+	if f.set["max-articles"] {
+		c.Storage.MaxArticles = f.maxArticles
+	}
+
+	if f.set["interval"] {
+		c.Scheduler.Interval = Duration(f.interval)
+	}
+
+	if f.set["sources"] {
+		c.enableOnly(f.sources)
+	}
+
+	if f.set["log"] {
+		c.LogFile = f.logFile
+	}
+
+	if f.set["tags"] {
+		c.Summariser.TagConfig = f.tagConfig
+	}
+}
+
+// enableOnly enables the sources of the comma separated list and disables
+// the others. Unknown names are added, so that Validate reports them.
+func (c *Config) enableOnly(list string) {
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enabled[name] = true
+		}
+	}
+
+	for name, s := range c.Sources {
+		s.Enabled = enabled[name]
+		c.Sources[name] = s
+	}
+
+	for name := range enabled {
+		if _, ok := c.Sources[name]; !ok {
+			c.Sources[name] = Source{Enabled: true}
+		}
+	}
+}
+
+// Validate reports every invalid setting at once, except those checked by
+// ValidateSources.
+func (c *Config) Validate() error {
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if c.Server.Addr == "" {
+		report("server.addr is empty; use for example \":8000\"")
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.ShutdownTimeout <= 0 {
+		report("server.read_timeout, server.write_timeout and server.shutdown_timeout must be positive durations such as \"15s\"")
+	}
+
+	if !strings.HasPrefix(c.Storage.MongoURI, "mongodb://") && !strings.HasPrefix(c.Storage.MongoURI, "mongodb+srv://") {
+		report("storage.mongo_uri %q must start with mongodb:// or mongodb+srv://", c.Storage.MongoURI)
+	}
+	if c.Storage.Database == "" {
+		report("storage.database is empty")
+	}
+	if c.Storage.MaxArticles < 1 {
+		report("storage.max_articles must be at least 1, got %d", c.Storage.MaxArticles)
+	}
+
+	for i, r := range c.Retention.Rules {
+		if r.MaxAge < 0 || r.MaxCount < 0 {
+			report("retention.rules[%d]: max_age and max_count must not be negative", i)
+		}
+		if r.MaxAge == 0 && r.MaxCount == 0 {
+			report("retention.rules[%d] has neither max_age nor max_count; remove it to keep the articles", i)
+		}
+		if r.Source != "" && !isKnownSource(r.Source) {
+			report("retention.rules[%d].source %q is not a known source; known sources are %s", i, r.Source, strings.Join(SourceNames, ", "))
+		}
+		for j, previous := range c.Retention.Rules[:i] {
+			if previous.rule().Covers(r.rule()) {
+				report("retention.rules[%d] is never used, since retention.rules[%d] matches the same articles first", i, j)
+				break
+			}
+		}
+	}
+	if c.Retention.ArchiveCollection != "" && c.Retention.ArchiveDir != "" {
+		report("retention.archive_collection and retention.archive_dir cannot both be set")
+	}
+	switch c.Retention.ArchiveCollection {
+	case "articles", "article_versions", "trends", "jobs", "snapshots", "snapshot_blobs", "source_runs", "failed_articles", "tag_counts":
+		report("retention.archive_collection %q is used by infogrid itself", c.Retention.ArchiveCollection)
+	}
+	if f := c.Retention.ArchiveFormat; f != "" && f != export.JSONL && f != export.CSV {
+		report("retention.archive_format must be %s or %s, got %q", export.JSONL, export.CSV, f)
+	}
+
+	if c.Snapshots.MaxAge < 0 {
+		report("snapshots.max_age must not be negative, got %s", c.Snapshots.MaxAge)
+	}
+
+	for name := range c.Sources {
+		if !isKnownSource(name) {
+			report("sources.%s is not a known source; known sources are %s", name, strings.Join(SourceNames, ", "))
+		}
+	}
+
+	if c.Fetcher.Timeout <= 0 {
+		report("fetcher.timeout must be a positive duration such as \"30s\", got %s", c.Fetcher.Timeout)
+	}
+	if c.Fetcher.UserAgent == "" {
+		report("fetcher.user_agent is empty")
+	}
+	if c.Fetcher.Retries < 0 || c.Fetcher.RetryBackoff < 0 || c.Fetcher.MaxRetryWait < 0 {
+		report("fetcher.retries, fetcher.retry_backoff and fetcher.max_retry_wait must not be negative")
+	}
+	if c.Fetcher.RatePerHost < 0 {
+		report("fetcher.rate_per_host must not be negative, got %g", c.Fetcher.RatePerHost)
+	}
+	if c.Fetcher.BurstPerHost < 1 || c.Fetcher.ConcurrencyPerHost < 1 {
+		report("fetcher.burst_per_host and fetcher.concurrency_per_host must be at least 1")
+	}
+	if c.Fetcher.CacheMaxAge < 0 {
+		report("fetcher.cache_max_age must not be negative, got %s", c.Fetcher.CacheMaxAge)
+	}
+
+	if c.Retry.MaxAttempts < 1 {
+		report("retry.max_attempts must be at least 1, got %d", c.Retry.MaxAttempts)
+	}
+	if c.Retry.Backoff <= 0 {
+		report("retry.backoff must be a positive duration such as \"1h\", got %s", c.Retry.Backoff)
+	}
+
+	if c.Pipeline.ExtractWorkers < 1 || c.Pipeline.StoreWorkers < 1 {
+		report("pipeline.extract_workers and pipeline.store_workers must be at least 1")
+	}
+	if c.Pipeline.SummariseWorkers < 0 {
+		report("pipeline.summarise_workers must not be negative, got %d", c.Pipeline.SummariseWorkers)
+	}
+	if c.Pipeline.ArticleTimeout < 0 {
+		report("pipeline.article_timeout must not be negative, got %s", c.Pipeline.ArticleTimeout)
+	}
+
+	if c.Health.Window < 1 {
+		report("health.window must be at least 1, got %d", c.Health.Window)
+	}
+	if c.Health.MinRuns < 1 || c.Health.MinRuns > c.Health.Window {
+		report("health.min_runs must be between 1 and health.window (%d), got %d", c.Health.Window, c.Health.MinRuns)
+	}
+	if c.Health.Threshold <= 0 || c.Health.Threshold > 1 {
+		report("health.threshold must be in (0, 1], got %g", c.Health.Threshold)
+	}
+	if c.Health.WebhookURL != "" {
+		u, err := url.Parse(c.Health.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report("health.webhook_url %q must be an http:// or https:// URL", c.Health.WebhookURL)
+		}
+	}
+
+	if c.Summariser.Ratio <= 0 || c.Summariser.Ratio > 1 {
+		report("summariser.ratio must be in (0, 1], got %g", c.Summariser.Ratio)
+	}
+	if c.Summariser.NumberOfTags < 1 {
+		report("summariser.number_of_tags must be at least 1, got %d", c.Summariser.NumberOfTags)
+	}
+	if c.Summariser.NumberOfEntities < c.Summariser.NumberOfTags {
+		report("summariser.number_of_entities (%d) must be at least summariser.number_of_tags (%d)",
+			c.Summariser.NumberOfEntities, c.Summariser.NumberOfTags)
+	}
+	if c.Summariser.TagConfig != "" {
+		if _, err := os.Stat(c.Summariser.TagConfig); err != nil {
+			report("summariser.tag_config: %v", err)
+		}
+	}
+
+	if c.Admin.Token != "" && len(c.Admin.Token) < 16 {
+		report("admin.token must be at least 16 characters long")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
+
+// ValidateSources checks the settings only needed to capture articles, so
+// that tools which only read the database do not require an API key.
+func (c *Config) ValidateSources() error {
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if c.Scheduler.Interval < Duration(time.Minute) {
+		report("scheduler.interval must be at least 1m, got %s", c.Scheduler.Interval)
+	}
+	if c.Scheduler.Jitter < 0 {
+		report("scheduler.jitter must not be negative, got %s", c.Scheduler.Jitter)
+	}
+
+	if c.Refresh.Schedule != "" {
+		sched, err := scheduler.Parse(c.Refresh.Schedule)
+		if err != nil {
+			report("refresh.schedule: %v", err)
+		} else if sched.Next(time.Now()).IsZero() {
+			report("refresh.schedule %q never matches", c.Refresh.Schedule)
+		}
+		if c.Refresh.Window <= 0 {
+			report("refresh.window must be a positive duration such as \"24h\", got %s", c.Refresh.Window)
+		}
+	}
+
+	if c.Retry.Schedule != "" {
+		sched, err := scheduler.Parse(c.Retry.Schedule)
+		if err != nil {
+			report("retry.schedule: %v", err)
+		} else if sched.Next(time.Now()).IsZero() {
+			report("retry.schedule %q never matches", c.Retry.Schedule)
+		}
+	}
+
+	for _, name := range c.EnabledSources() {
+		s := c.Sources[name]
+		if s.Interval != 0 && s.Interval < Duration(time.Minute) {
+			report("sources.%s.interval must be 0 (scheduler.interval) or at least 1m, got %s", name, s.Interval)
+		}
+		if s.Schedule != "" {
+			sched, err := scheduler.Parse(s.Schedule)
+			if err != nil {
+				report("sources.%s.schedule: %v", name, err)
+			} else if every, ok := sched.(scheduler.Every); ok && every < scheduler.Every(time.Minute) {
+				report("sources.%s.schedule must be at least 1m apart, got %s", name, s.Schedule)
+			} else if sched.Next(time.Now()).IsZero() {
+				report("sources.%s.schedule %q never matches", name, s.Schedule)
+			}
+		}
+		if name == "nytimes" && s.APIKey == "" {
+			report("sources.nytimes.api_key is empty; set NYTIMES_KEY or disable the source with -sources reuters")
+		}
+	}
+
+	if len(c.EnabledSources()) == 0 {
+		report("no source is enabled; known sources are %s", strings.Join(SourceNames, ", "))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
+
+func isKnownSource(name string) bool {
+	for _, n := range SourceNames {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Schedule returns the capture schedule of the named source: its cron
+// expression if it has one, or else its interval or Scheduler.Interval.
+func (c *Config) Schedule(name string) (scheduler.Schedule, error) {
+	s := c.Sources[name]
+	if s.Schedule != "" {
+		return scheduler.Parse(s.Schedule)
+	}
+
+	if s.Interval != 0 {
+		return scheduler.Every(s.Interval), nil
+	}
+
+	return scheduler.Every(c.Scheduler.Interval), nil
+}
+
+func (r RetentionRule) rule() models.RetentionRule {
+	return models.RetentionRule{
+		Source:         r.Source,
+		Section:        r.Section,
+		MaxAge:         time.Duration(r.MaxAge),
+		MaxCount:       r.MaxCount,
+		KeepTags:       r.KeepTags,
+		KeepBookmarked: r.KeepBookmarked,
+	}
+}
+
+// RetentionRules returns the rules of the retention policy.
+func (c *Config) RetentionRules() []models.RetentionRule {
+	rules := make([]models.RetentionRule, len(c.Retention.Rules))
+	for i, r := range c.Retention.Rules {
+		rules[i] = r.rule()
+	}
+
+	return rules
+}
+
+// NewArchiver returns where to archive the articles removed by one clean up,
+// or nil if they are deleted.
+func (c *Config) NewArchiver(adb *models.ArticleDB) models.Archiver {
+	switch {
+	case c.Retention.ArchiveCollection != "":
+		return adb.CollectionArchiver(c.Retention.ArchiveCollection)
+	case c.Retention.ArchiveDir != "":
+		format := c.Retention.ArchiveFormat
+		if format == "" {
+			format = export.JSONL
+		}
+		return export.NewFileArchiver(c.Retention.ArchiveDir, format)
+	default:
+		return nil
+	}
+}
+
+// FetcherConfig returns the settings of the fetcher of the sources.
+func (c *Config) FetcherConfig() fetcher.Config {
+	fc := fetcher.DefaultConfig()
+	fc.Timeout = time.Duration(c.Fetcher.Timeout)
+	fc.UserAgent = c.Fetcher.UserAgent
+	fc.Retries = c.Fetcher.Retries
+	fc.RetryBackoff = time.Duration(c.Fetcher.RetryBackoff)
+	fc.MaxRetryWait = time.Duration(c.Fetcher.MaxRetryWait)
+	fc.RatePerHost = c.Fetcher.RatePerHost
+	fc.BurstPerHost = c.Fetcher.BurstPerHost
+	fc.ConcurrencyPerHost = c.Fetcher.ConcurrencyPerHost
+	fc.Robots = c.Fetcher.Robots
+	fc.CacheDir = c.Fetcher.CacheDir
+	fc.CacheMaxAge = time.Duration(c.Fetcher.CacheMaxAge)
+
+	return fc
+}
+
+// HealthMonitor returns the monitor of the captures of the sources.
+func (c *Config) HealthMonitor() *health.Monitor {
+	return &health.Monitor{
+		Window:    c.Health.Window,
+		MinRuns:   c.Health.MinRuns,
+		Threshold: c.Health.Threshold,
+	}
+}
+
+// EnabledSources returns the names of the enabled sources, in the order of SourceNames.
+func (c *Config) EnabledSources() []string {
+	var names []string
+	for _, name := range SourceNames {
+		if c.Sources[name].Enabled {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Duration is a time.Duration written as "4h" or "15s" in the JSON file.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"4h\", got %s", b)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,326 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variable key until the end of the test.
+func setenv(t *testing.T, key string, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// writeFile writes a configuration file in the temporary directory of the test.
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "infogrid.json")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		file string // Server address in the file, if not empty
+		env  string // In INFOGRID_ADDR
+		flag string // Given to -addr
+		want string
+	}{
+		{"default", "", "", "", ":8000"},
+		{"file", ":1", "", "", ":1"},
+		{"env", "", ":2", "", ":2"},
+		{"flag", "", "", ":3", ":3"},
+		{"env over file", ":1", ":2", "", ":2"},
+		{"flag over file", ":1", "", ":3", ":3"},
+		{"flag over env", "", ":2", ":3", ":3"},
+		{"flag over everything", ":1", ":2", ":3", ":3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setenv(t, "INFOGRID_CONFIG", "")
+			if test.file != "" {
+				setenv(t, "INFOGRID_CONFIG", writeFile(t, `{"server": {"addr": "`+test.file+`"}}`))
+			}
+			setenv(t, "INFOGRID_ADDR", test.env)
+
+			var args []string
+			if test.flag != "" {
+				args = []string{"-addr", test.flag}
+			}
+
+			cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != test.want {
+				t.Errorf("got addr %q, want %q", cfg.Server.Addr, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadMerge(t *testing.T) {
+	path := writeFile(t, `{
+		"storage": {"max_articles": 50},
+		"scheduler": {"interval": "2h"},
+		"sources": {"reuters": {"sections": ["world"]}}
+	}`)
+	setenv(t, "INFOGRID_CONFIG", "")
+	setenv(t, "INFOGRID_INTERVAL", "3h")
+	setenv(t, "INFOGRID_SOURCES", "")
+	setenv(t, "NYTIMES_KEY", "key")
+
+	cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path, "-sources", "reuters"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Set in the file only, and not reset by the unset -max-articles flag
+	if cfg.Storage.MaxArticles != 50 {
+		t.Errorf("got max_articles %d, want 50", cfg.Storage.MaxArticles)
+	}
+	if cfg.Scheduler.Interval != Duration(3*time.Hour) {
+		t.Errorf("got interval %s, want 3h", cfg.Scheduler.Interval)
+	}
+	// Untouched by the file
+	if cfg.Storage.Database != "info_grid" {
+		t.Errorf("got database %q, want the default", cfg.Storage.Database)
+	}
+
+	// The file only changes the sections of reuters, and -sources
+	// disables nytimes, keeping the API key of the environment
+	reuters, nytimes := cfg.Sources["reuters"], cfg.Sources["nytimes"]
+	if !reuters.Enabled || len(reuters.Sections) != 1 || reuters.Sections[0] != "world" {
+		t.Errorf("got reuters %+v, want it enabled with the world section", reuters)
+	}
+	if nytimes.Enabled || nytimes.APIKey != "key" {
+		t.Errorf("got nytimes %+v, want it disabled with its key", nytimes)
+	}
+	if names := cfg.EnabledSources(); len(names) != 1 || names[0] != "reuters" {
+		t.Errorf("got enabled sources %v, want reuters", names)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string // In the error
+	}{
+		{"unknown field", `{"server": {"adress": ":1"}}`, nil, nil, "unknown field"},
+		{"invalid duration", `{"scheduler": {"interval": 4}}`, nil, nil, "duration must be a string"},
+		{"invalid source", `{"sources": {"reuters": {"enabled": "yes"}}}`, nil, nil, "sources.reuters"},
+		{"env not an integer", "", map[string]string{"INFOGRID_MAX_ARTICLES": "many"}, nil, "INFOGRID_MAX_ARTICLES"},
+		{"env not a duration", "", map[string]string{"INFOGRID_INTERVAL": "4"}, nil, "INFOGRID_INTERVAL"},
+		{"unknown flag", "", nil, []string{"-verbose"}, "-verbose"},
+		{"invalid setting", `{"storage": {"max_articles": 0}}`, nil, nil, "storage.max_articles"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setenv(t, "INFOGRID_CONFIG", "")
+			if test.file != "" {
+				setenv(t, "INFOGRID_CONFIG", writeFile(t, test.file))
+			}
+			for k, v := range test.env {
+				setenv(t, k, v)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(ioutil.Discard)
+			_, err := Load(fs, test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error about %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	setenv(t, "INFOGRID_CONFIG", "")
+
+	// The paths of the example are relative to the root of the repository
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	_, err = Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", "configs/infogrid.json"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string // In the error, none if the configuration is valid
+	}{
+		{"default", func(c *Config) {}, nil},
+		{"no address", func(c *Config) { c.Server.Addr = "" }, []string{"server.addr"}},
+		{"mongo uri", func(c *Config) { c.Storage.MongoURI = "localhost:27017" }, []string{"storage.mongo_uri"}},
+		{"mongo srv uri", func(c *Config) { c.Storage.MongoURI = "mongodb+srv://cluster.example.com" }, nil},
+		{"retention rule without limit", func(c *Config) {
+			c.Retention.Rules = []RetentionRule{{Source: "reuters"}}
+		}, []string{"retention.rules[0] has neither"}},
+		{"retention rule never used", func(c *Config) {
+			c.Retention.Rules = append(c.Retention.Rules, RetentionRule{Source: "reuters", MaxAge: Duration(time.Hour)})
+		}, []string{"retention.rules[1] is never used"}},
+		{"retention rule of an unknown source", func(c *Config) {
+			c.Retention.Rules = []RetentionRule{{Source: "bbc", MaxCount: 10}}
+		}, []string{"retention.rules[0].source"}},
+		{"archive in a collection of infogrid", func(c *Config) { c.Retention.ArchiveCollection = "tag_counts" }, []string{"retention.archive_collection"}},
+		{"two archives", func(c *Config) {
+			c.Retention.ArchiveCollection = "archive"
+			c.Retention.ArchiveDir = "archive"
+		}, []string{"cannot both be set"}},
+		{"archive format", func(c *Config) { c.Retention.ArchiveFormat = "xml" }, []string{"retention.archive_format"}},
+		{"unknown source", func(c *Config) { c.Sources["bbc"] = Source{} }, []string{"sources.bbc"}},
+		{"health", func(c *Config) { c.Health.MinRuns = c.Health.Window + 1 }, []string{"health.min_runs"}},
+		{"webhook", func(c *Config) { c.Health.WebhookURL = "example.com/hook" }, []string{"health.webhook_url"}},
+		{"entities", func(c *Config) { c.Summariser.NumberOfEntities = 2 }, []string{"summariser.number_of_entities"}},
+		{"missing tag config", func(c *Config) { c.Summariser.TagConfig = "missing.json" }, []string{"summariser.tag_config"}},
+		{"short admin token", func(c *Config) { c.Admin.Token = "secret" }, []string{"admin.token"}},
+
+		// Every problem is reported at once
+		{"several", func(c *Config) {
+			c.Storage.MaxArticles = 0
+			c.Fetcher.Timeout = 0
+			c.Summariser.Ratio = 2
+		}, []string{"storage.max_articles", "fetcher.timeout", "summariser.ratio"}},
+	}
+
+	for _, test := range tests {
+		c := Default()
+		test.change(c)
+
+		err := c.Validate()
+		if len(test.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: got no error, want %v", test.name, test.want)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want an error about %s", test.name, err, want)
+			}
+		}
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string // In the error, none if the configuration is valid
+	}{
+		{"default", func(c *Config) {}, nil},
+		{"no API key", func(c *Config) {
+			s := c.Sources["nytimes"]
+			s.APIKey = ""
+			c.Sources["nytimes"] = s
+		}, []string{"sources.nytimes.api_key"}},
+		{"no API key but disabled", func(c *Config) {
+			c.Sources["nytimes"] = Source{}
+		}, nil},
+		{"no source", func(c *Config) { c.enableOnly("") }, []string{"no source is enabled"}},
+		{"interval", func(c *Config) { c.Scheduler.Interval = Duration(time.Second) }, []string{"scheduler.interval"}},
+		{"refresh schedule", func(c *Config) { c.Refresh.Schedule = "61 * * * *" }, []string{"refresh.schedule"}},
+		{"refresh never", func(c *Config) { c.Refresh.Schedule = "0 0 31 2 *" }, []string{"never matches"}},
+		{"no retry", func(c *Config) { c.Retry.Schedule = "" }, nil},
+		{"source interval", func(c *Config) {
+			s := c.Sources["reuters"]
+			s.Interval = Duration(time.Second)
+			c.Sources["reuters"] = s
+		}, []string{"sources.reuters.interval"}},
+		{"source schedule", func(c *Config) {
+			s := c.Sources["reuters"]
+			s.Schedule = "@every 10s"
+			c.Sources["reuters"] = s
+		}, []string{"sources.reuters.schedule must be at least 1m apart"}},
+		{"schedule of a disabled source", func(c *Config) {
+			c.Sources["reuters"] = Source{Schedule: "bad"}
+		}, nil},
+	}
+
+	for _, test := range tests {
+		c := Default()
+		s := c.Sources["nytimes"]
+		s.APIKey = "key"
+		c.Sources["nytimes"] = s
+		test.change(c)
+
+		err := c.ValidateSources()
+		if len(test.want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: got no error, want %v", test.name, test.want)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %v, want an error about %s", test.name, err, want)
+			}
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	c := Default()
+	c.Sources["reuters"] = Source{Enabled: true, Interval: Duration(time.Hour)}
+	c.Sources["nytimes"] = Source{Enabled: true, Interval: Duration(time.Hour), Schedule: "0 * * * *"}
+	c.Sources["other"] = Source{}
+
+	tests := map[string]string{
+		"reuters": "@every 1h0m0s",
+		"nytimes": "0 * * * *",
+		"other":   "@every 4h0m0s",
+	}
+
+	for name, want := range tests {
+		s, err := c.Schedule(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := s.(interface{ String() string }).String(); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"github.com/vitsensei/infogrid/pkg/textrank"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+// Most admin endpoints start a job and answer 202 with its run, which can
+// then be polled at /admin/jobs/{id}.
+
+const resetTokenLifetime = 5 * time.Minute
+
+// ResetConfirmation is returned by ResetDatabase when called without a
+// confirmation token.
+type ResetConfirmation struct {
+	Confirm   string    `json:"confirm"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Message   string    `json:"message"`
+}
+
+// writeJobStarted answers with the run returned by scheduler.Trigger or
+// scheduler.Submit.
+func (a *Articles) writeJobStarted(w http.ResponseWriter, r *http.Request, run *models.JobRun, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrStopped):
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "The server is shutting down.")
+		return
+	case err != nil:
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal error. If you can tell me about this, it would be great!")
+		return
+	case run.Status == models.JobSkipped:
+		writeError(w, r, http.StatusConflict, CodeConflict, "The job "+run.Job+" is already running.")
+		return
+	}
+
+	a.logger.Println("[INFO]", RequestIDFromContext(r.Context()), "Admin started job", run.Job, run.ID.Hex())
+	w.Header().Set("Location", "/admin/jobs/"+run.ID.Hex())
+	writeJSON(w, r, http.StatusAccepted, run)
+}
+
+// TriggerCapture captures the source given by the "source" query parameter,
+// or every source.
+func (a *Articles) TriggerCapture(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		run, err := a.scheduler.Submit("capture", a.CaptureJob())
+		a.writeJobStarted(w, r, run, err)
+		return
+	}
+
+	run, err := a.scheduler.Trigger("capture:" + source)
+	if errors.Is(err, scheduler.ErrUnknownJob) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "The source "+source+" does not exist or is not enabled.")
+		return
+	}
+	a.writeJobStarted(w, r, run, err)
+}
+
+// articleSelection is either one article, or the articles captured in a
+// time range.
+type articleSelection struct {
+	id       primitive.ObjectID
+	from, to time.Time
+}
+
+// parseArticleSelection reads the "id" query parameter, or the "from" and
+// "to" ones (RFC 3339 times, to defaults to now). ok is false if an error
+// has been written to w.
+func (a *Articles) parseArticleSelection(w http.ResponseWriter, r *http.Request) (sel articleSelection, ok bool) {
+	q := r.URL.Query()
+
+	if v := q.Get("id"); v != "" {
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "id must be the id of an article.")
+			return sel, false
+		}
+
+		// Checked now rather than in the job, so that a typo is reported
+		// to the caller.
+		_, err = a.db.ByID(r.Context(), id)
+		if err != nil {
+			a.writeDBError(w, r, err)
+			return sel, false
+		}
+
+		sel.id = id
+		return sel, true
+	}
+
+	if q.Get("from") == "" {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Either id, or from (and optionally to) is required.")
+		return sel, false
+	}
+
+	var err error
+	sel.from, err = time.Parse(time.RFC3339, q.Get("from"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "from must be an RFC 3339 time, for example 2021-01-30T00:00:00Z.")
+		return sel, false
+	}
+
+	sel.to = time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		sel.to, err = time.Parse(time.RFC3339, v)
+		if err != nil || !sel.to.After(sel.from) {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "to must be an RFC 3339 time after from.")
+			return sel, false
+		}
+	}
+
+	return sel, true
+}
+
+func (a *Articles) selectArticles(ctx context.Context, sel articleSelection) ([]models.Article, error) {
+	if sel.id.IsZero() {
+		return a.db.CapturedBetween(ctx, sel.from, sel.to)
+	}
+
+	article, err := a.db.ByID(ctx, sel.id)
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.Article{*article}, nil
+}
+
+// reprocessJob returns a job applying update to the selected articles. It
+// does not overlap the captures, which may be storing the same articles.
+func (a *Articles) reprocessJob(sel articleSelection, update func(context.Context, *models.Article) error) scheduler.Func {
+	return func(ctx context.Context, run *models.JobRun) error {
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		as, err := a.selectArticles(ctx, sel)
+		if err != nil {
+			return err
+		}
+
+		run.Found = len(as)
+		for i := range as {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			err = update(ctx, &as[i])
+			if err != nil {
+				run.Failed++
+				if len(run.Errors) < maxRunErrors {
+					run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", as[i].URL, err))
+				}
+				continue
+			}
+			run.Updated++
+		}
+
+		return nil
+	}
+}
+
+// Resummarise summarises the selected articles again, for example after
+// changing the summary ratio.
+func (a *Articles) Resummarise(w http.ResponseWriter, r *http.Request) {
+	sel, ok := a.parseArticleSelection(w, r)
+	if !ok {
+		return
+	}
+
+	run, err := a.scheduler.Submit("resummarise", a.reprocessJob(sel, func(ctx context.Context, article *models.Article) error {
+		t, err := textrank.NewText(article.Text, a.lemmaDict)
+		if err != nil {
+			return err
+		}
+
+		return a.db.UpdateSummary(ctx, article.ID, t.Summarise(a.summaryRatio))
+	}))
+	a.writeJobStarted(w, r, run, err)
+}
+
+// Retag extracts the entities and tags of the selected articles again, for
+// example after changing the tag configuration.
+func (a *Articles) Retag(w http.ResponseWriter, r *http.Request) {
+	sel, ok := a.parseArticleSelection(w, r)
+	if !ok {
+		return
+	}
+
+	job := a.reprocessJob(sel, func(ctx context.Context, article *models.Article) error {
+		err := extractor.TagArticle(article)
+		if err != nil {
+			return err
+		}
+
+		return a.db.UpdateEntities(ctx, article.ID, article.Entities, article.Tags)
+	})
+
+	run, err := a.scheduler.Submit("retag", func(ctx context.Context, run *models.JobRun) error {
+		err := job(ctx, run)
+		a.CaptureTags(ctx)
+		return err
+	})
+	a.writeJobStarted(w, r, run, err)
+}
+
+// ResetDatabase deletes every article, with everything recorded about them
+// and the health of the sources. It must be called twice: the first
+// call returns a confirmation token, valid for a few minutes, to send back in
+// the "confirm" query parameter of the second call.
+func (a *Articles) ResetDatabase(w http.ResponseWriter, r *http.Request) {
+	confirm := r.URL.Query().Get("confirm")
+
+	a.resetMu.Lock()
+	if confirm == "" {
+		a.resetToken = newRequestID()
+		a.resetExpiry = time.Now().Add(resetTokenLifetime).UTC()
+		c := ResetConfirmation{
+			Confirm:   a.resetToken,
+			ExpiresAt: a.resetExpiry,
+			Message:   "This deletes every article. To proceed, POST /admin/reset?confirm=" + a.resetToken + " before expires_at.",
+		}
+		a.resetMu.Unlock()
+
+		writeJSON(w, r, http.StatusOK, c)
+		return
+	}
+
+	valid := a.resetToken != "" && confirm == a.resetToken && time.Now().Before(a.resetExpiry)
+	a.resetToken = "" // Single use, also after a wrong guess
+	a.resetMu.Unlock()
+
+	if !valid {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest,
+			"The confirmation token is invalid or has expired. POST /admin/reset without confirm to get a new one.")
+		return
+	}
+
+	run, err := a.scheduler.Submit("reset", func(ctx context.Context, run *models.JobRun) error {
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		err := a.db.DestructiveReset(ctx)
+		if err != nil {
+			return err
+		}
+
+		a.setTags(nil)
+		a.lastTrendRun = time.Time{}
+		return nil
+	})
+	a.writeJobStarted(w, r, run, err)
+}
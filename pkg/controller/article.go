@@ -1,96 +1,240 @@
 package controller
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
+	"github.com/vitsensei/infogrid/pkg/health"
 	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
 	"github.com/vitsensei/infogrid/pkg/textrank"
+	"github.com/vitsensei/infogrid/pkg/trending"
 	"github.com/vitsensei/infogrid/pkg/views/articles"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
+	"runtime"
 	"sync"
 	"time"
 )
 
-var (
-	dbMu sync.Mutex
-	wg   sync.WaitGroup
-)
+// Articles captured before this are removed after every capture, unless
+// SetRetention is given other rules.
+const maxArticleAge = 72 * time.Hour
 
+// API is implemented by the sources reading all their articles at once,
+// which Adapt makes Sources of.
 type API interface {
-	GenerateArticles() error
-	GetArticles() []models.Article
+	Name() string // Recorded in the articles and the health of the source
+
+	// Capture lists the articles of the source and fetches the page of
+	// those which are not stored yet. Nothing is kept from one call to
+	// the next. Every article is returned with the error which prevented
+	// its page from being read, if any; err tells why some or all of the
+	// articles could not be listed, and does not invalidate results.
+	Capture(ctx context.Context) (results []models.ArticleResult, err error)
 }
 
-func NewArticleController(db *models.ArticleDB, v *articles.View, numberOfArticles int, logger *log.Logger, api ...API) Articles {
-	return Articles{
-		apis:             api,
+func NewArticleController(db *models.ArticleDB, v *articles.View, numberOfArticles int, logger *log.Logger, sources ...Source) *Articles {
+	return &Articles{
+		sources:          sources,
 		db:               db,
+		captures:         db,
 		ArticleView:      v,
 		numberOfArticles: numberOfArticles,
 		logger:           logger,
+		summaryRatio:     0.1,
+		trendDetector:    trending.NewDetector(),
+		healthMonitor:    health.NewMonitor(),
+		maxAttempts:      5,
+		retryBackoff:     time.Hour,
+		extractWorkers:   defaultExtractWorkers,
+		summariseWorkers: runtime.NumCPU(),
+		storeWorkers:     defaultStoreWorkers,
+		articleTimeout:   defaultArticleTimeout,
+		retention:        []models.RetentionRule{{MaxAge: maxArticleAge, KeepBookmarked: true}},
 	}
 }
 
 type Articles struct {
-	apis             []API
+	sources          []Source
+	tagsMu           sync.RWMutex // Guards tags, replaced by the jobs while pages are served
 	tags             []string
 	db               *models.ArticleDB
-	numberOfArticles int // maximum number of articles in the database
+	captures         captureStore // db, but for the tests of the captures
+	numberOfArticles int          // The retention rules are applied after a capture once the database holds that many articles
 
 	ArticleView *articles.View
 
 	logger *log.Logger
+
+	summaryRatio float64           // Share of the words of the text kept in the summary
+	lemmaDict    map[string]string // nil to let textrank read its default lemmatization list
+
+	scheduler *scheduler.Scheduler
+	captureMu sync.Mutex // Held by the jobs writing articles (captures, clean ups, reprocessing, resets), so that they never overlap
+
+	snapshots      bool          // Store the page of every new article
+	snapshotMaxAge time.Duration // 0 to keep the snapshots forever
+
+	retention   []models.RetentionRule
+	newArchiver func() models.Archiver // nil, or returning nil, to delete the removed articles
+
+	resetMu     sync.Mutex
+	resetToken  string // Confirmation token expected by ResetDatabase
+	resetExpiry time.Time
+
+	trendDetector *trending.Detector
+	lastTrendRun  time.Time // Buckets before this one have already been checked for trends
+
+	healthMonitor *health.Monitor
+	webhookURL    string // Called when a source starts alerting, if not empty
+
+	maxAttempts  int           // To capture an article, after which its failure is given up on
+	retryBackoff time.Duration // Before the first retry of a failed article
+
+	// Workers of every stage of a capture, see captureSource
+	extractWorkers, summariseWorkers, storeWorkers int
+	articleTimeout                                 time.Duration // Given to fetching, then to storing, every article; 0 for none
 }
 
-func (a *Articles) SummariseArticle(article models.Article) {
-	defer wg.Done()
+// CaptureResult counts the articles of a capture.
+type CaptureResult struct {
+	Found   int
+	New     int
+	Failed  int
+	Skipped int      // Disallowed by robots.txt
+	Errors  []string // At most maxRunErrors
+}
 
-	dbMu.Lock()
-	_, err := a.db.ByURL(article.URL) // Check if the article is already in the DB
-	dbMu.Unlock()
+// Only the first errors of a run are kept, so that a failing source does not
+// produce huge job records.
+const maxRunErrors = 20
 
-	if err == mongo.ErrNoDocuments { // If true, the article is not in DB
-		if article.SummarisedText == "" { // Only summarise the text if it has not been summarised
-			t, err := textrank.NewText(article.Text, nil)
-			if err == nil {
-				summarisedText := t.Summarise(0.1)
-				article.SummarisedText = summarisedText
-			}
+func (r *CaptureResult) addError(err error) {
+	if len(r.Errors) < maxRunErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// add counts the articles of o in r.
+func (r *CaptureResult) add(o CaptureResult) {
+	r.Found += o.Found
+	r.New += o.New
+	r.Failed += o.Failed
+	r.Skipped += o.Skipped
+
+	for _, err := range o.Errors {
+		if len(r.Errors) == maxRunErrors {
+			break
 		}
-	} else {
-		return
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+// SummariseArticle stores the article, summarised, unless it is already
+// stored. isNew is true if it has been inserted.
+func (a *Articles) SummariseArticle(ctx context.Context, article models.Article) (isNew bool, err error) {
+	_, err = a.db.ByURL(ctx, article.URL) // Check if the article is already in the DB
+
+	if err != mongo.ErrNoDocuments { // The article is stored, or the DB cannot be read
+		return false, err
+	}
+
+	// Stored even without its summary, which cmd/backfill computes later
+	err = a.summarise(&article)
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to summarise", article.URL, err)
 	}
 
-	dbMu.Lock()
-	_ = a.db.InsertArticle(article)
-	dbMu.Unlock()
+	err = a.store(ctx, article)
+	if errors.Is(err, models.ErrDuplicate) {
+		return false, nil // Stored meanwhile
+	}
+
+	return err == nil, err
 }
 
-// CaptureArticles will be called by RunPeriodicCapture at every constant
-// time period. This is exported for debugging purposes in main.go
-func (a *Articles) CaptureArticles() {
-	// Get the articles from selected sections
-	// and then get the summarised version of the text
-	for _, api := range a.apis {
-		err := api.GenerateArticles()
-		if err == nil {
-			for _, article := range api.GetArticles() {
-				a.logger.Println("[INFO] Captured article with title", article.Title)
-				wg.Add(1)
-				go a.SummariseArticle(article)
-			}
-		} else {
-			a.logger.Println("[ERROR]", err)
+// summarise summarises the text of article, unless it has been summarised,
+// and records the version of the algorithms which processed it. If the text
+// cannot be summarised, the version is left as is, so that cmd/backfill
+// processes the article again.
+func (a *Articles) summarise(article *models.Article) error {
+	if article.SummarisedText == "" {
+		t, err := textrank.NewText(article.Text, a.lemmaDict)
+		if err != nil {
+			return err
+		}
+		article.SummarisedText = t.Summarise(a.summaryRatio)
+	}
+	article.AlgorithmVersion = models.AlgorithmVersion
+
+	return nil
+}
+
+// store inserts article, with its snapshot if they are enabled. It returns
+// models.ErrDuplicate if the article is already stored.
+func (a *Articles) store(ctx context.Context, article models.Article) error {
+	// The ID is chosen now, so that the snapshot can refer to the article
+	snapshot := a.snapshots && article.Page != nil
+	if snapshot {
+		article.ID = primitive.NewObjectID()
+	}
+
+	err := a.captures.InsertArticle(ctx, article)
+	if err != nil {
+		return err
+	}
+
+	// The article is stored even without its snapshot
+	if snapshot {
+		_, err = a.captures.SaveSnapshot(ctx, article.ID, article.Page)
+		if err != nil {
+			a.logger.Println("[ERROR] Fail to store the snapshot of", article.URL, err)
 		}
 	}
 
-	wg.Wait()
+	return nil
+}
+
+// SetSummariser changes the share of words kept in summaries, and the
+// lemmatization list used to compare sentences (parsed once, instead of
+// for every article).
+func (a *Articles) SetSummariser(ratio float64, lemmaDict map[string]string) {
+	a.summaryRatio = ratio
+	a.lemmaDict = lemmaDict
+}
+
+// SetScheduler gives the scheduler running the capture jobs, whose jobs and
+// history are shown by GetJobs.
+func (a *Articles) SetScheduler(s *scheduler.Scheduler) {
+	a.scheduler = s
 }
 
-func (a *Articles) CaptureTags() {
-	as, err := a.db.AllArticles()
+// CaptureArticles fetches and stores the new articles of the given sources,
+// or of all of them if none is given, published since the given time (zero
+// for every article they list). It is run by the jobs of CaptureJob. The
+// articles which cannot be read or stored are recorded to be retried by
+// RetryJob, without preventing the others from being stored.
+func (a *Articles) CaptureArticles(ctx context.Context, since time.Time, sources ...Source) CaptureResult {
+	if len(sources) == 0 {
+		sources = a.sources
+	}
+
+	var result CaptureResult
+	for _, s := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result.add(a.captureSource(ctx, s, since))
+	}
+
+	return result
+}
+
+func (a *Articles) CaptureTags(ctx context.Context) {
+	as, err := a.db.AllArticles(ctx)
 	if err != nil {
 		return
 	}
@@ -107,93 +251,201 @@ func (a *Articles) CaptureTags() {
 		tags = append(tags, key)
 	}
 
+	a.setTags(tags)
+}
+
+// setTags replaces the tags shown on the home page.
+func (a *Articles) setTags(tags []string) {
+	a.tagsMu.Lock()
+	defer a.tagsMu.Unlock()
+
 	a.tags = tags
+}
+
+// getTags returns the tags shown on the home page.
+func (a *Articles) getTags() []string {
+	a.tagsMu.RLock()
+	defer a.tagsMu.RUnlock()
 
+	return a.tags
 }
 
-// Continuously running until the program exits.
-func (a *Articles) RunPeriodicCapture(interval int) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Hour)
-	start := time.Now()
-	a.CaptureArticles()
-	a.CaptureTags()
-	fmt.Println("New articles captured after", time.Since(start))
-	a.db.CleanOldArticles(a.numberOfArticles, a.logger)
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				start := time.Now()
-				a.CaptureArticles()
-				a.CaptureTags()
-				fmt.Println("New articles captured after", time.Since(start))
-				a.db.CleanOldArticles(a.numberOfArticles, a.logger)
+// CaptureJob returns the scheduler job capturing the given sources (all of
+// them if none is given), and then updating the tags and trends and deleting old
+// articles. The job fails if no article could be read, but not if only some
+// of them cannot be stored.
+func (a *Articles) CaptureJob(sources ...Source) scheduler.Func {
+	return func(ctx context.Context, run *models.JobRun) error {
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		result := a.CaptureArticles(ctx, time.Time{}, sources...)
+		run.Found, run.New, run.Failed, run.Skipped = result.Found, result.New, result.Failed, result.Skipped
+		run.Errors = result.Errors
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		a.CaptureTags(ctx)
+		a.DetectTrends(ctx)
+
+		n, err := a.db.CountArticles(ctx)
+		if err != nil {
+			a.logger.Println("[ERROR] Cannot count the articles:", err)
+		} else if n >= int64(a.numberOfArticles) {
+			report, err := a.clean(ctx, a.retention, false)
+			run.Deleted = report.Removed
+			if err != nil {
+				run.Errors = append(run.Errors, err.Error())
+			}
+		}
+
+		if a.snapshotMaxAge > 0 {
+			n, err := a.db.CleanSnapshots(ctx, a.snapshotMaxAge)
+			if err != nil {
+				a.logger.Println("[ERROR] Fail to delete old snapshots:", err)
+				run.Errors = append(run.Errors, err.Error())
+			} else if n > 0 {
+				a.logger.Println("[INFO] Deleted", n, "snapshots")
 			}
 		}
-	}()
 
-	select {}
+		if result.Found == 0 && len(result.Errors) > 0 {
+			return errors.New("no source could be read")
+		}
+
+		return nil
+	}
+}
+
+// SetSnapshots enables or disables the snapshots of the pages of new
+// articles. Snapshots fetched more than maxAge ago are deleted after every
+// capture, whatever happened to their article; 0 keeps them forever.
+func (a *Articles) SetSnapshots(enabled bool, maxAge time.Duration) {
+	a.snapshots = enabled
+	a.snapshotMaxAge = maxAge
+}
+
+// SetRetention changes the rules removing old articles. newArchiver is
+// called for every clean up, and returns where to archive the removed
+// articles, or nil to delete them.
+func (a *Articles) SetRetention(rules []models.RetentionRule, newArchiver func() models.Archiver) {
+	a.retention = rules
+	a.newArchiver = newArchiver
 }
 
-func (a *Articles) ShowArticles(w http.ResponseWriter, _ *http.Request) {
-	as, err := a.db.AllArticles()
-	must(err)
+// clean applies the retention rules. The caller holds captureMu.
+func (a *Articles) clean(ctx context.Context, rules []models.RetentionRule, dryRun bool) (models.RetentionReport, error) {
+	var archive models.Archiver
+	if a.newArchiver != nil && !dryRun {
+		archive = a.newArchiver()
+	}
+
+	report, err := a.db.ApplyRetention(ctx, rules, archive, dryRun)
+	if archive != nil {
+		if cerr := archive.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		a.logger.Println("[ERROR] Clean up:", err)
+	}
+
+	for _, rr := range report.Rules {
+		if rr.Removed > 0 || dryRun {
+			a.logger.Printf("[INFO] Retention rule %s: %d articles, %d kept, %d expired, %d removed (dry run: %t, archived: %t)",
+				rr.Rule, rr.Matched, rr.Kept, rr.Expired, rr.Removed, dryRun, report.Archived)
+		}
+	}
+
+	return report, err
+}
+
+func (a *Articles) ShowArticles(w http.ResponseWriter, r *http.Request) {
+	as, err := a.db.AllArticles(r.Context())
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
 
 	type Data struct {
 		Tags     []string
 		Articles []models.Article
 	}
 
-	data := Data{a.tags, as}
+	data := Data{a.getTags(), as}
 
 	err = a.ArticleView.Render(w, data)
-	must(err)
+	if err != nil {
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to render the page.")
+	}
 }
 
 func (a *Articles) GetArticles(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		allArticles, err := a.db.AllArticles()
-		must(err)
-
-		section := r.FormValue("section")
-		tag := r.FormValue("tag")
-
-		var filteredArticles []models.Article
-		for i := range allArticles {
-			if section != allArticles[i].Section && section != "" {
-				continue
-			}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Malformed query string.")
+		return
+	}
 
-			if tag != "" {
-				for j := range allArticles[i].Tags {
-					if tag == allArticles[i].Tags[j] {
-						filteredArticles = append(filteredArticles, allArticles[i])
-						break
-					}
-				}
-			} else {
-				filteredArticles = append(filteredArticles, allArticles[i])
-			}
+	allArticles, err := a.db.AllArticles(r.Context())
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	section := r.FormValue("section")
+	tag := r.FormValue("tag")
+
+	// Filters on typed entities, such as ?person=joe biden
+	entityFilters := make(map[string]string) // parameter name -> entity
+	for name := range entityTypes {
+		if v := r.FormValue(name); v != "" {
+			entityFilters[name] = v
 		}
+	}
 
-		encoder := json.NewEncoder(w)
-		encoder.SetIndent("", "    ")
-		err = encoder.Encode(&filteredArticles)
-		if err != nil {
-			_, _ = fmt.Fprintf(w, "Sorry! Internal error. If you can tell me about this, it would be great!")
+	filteredArticles := make([]models.Article, 0)
+	for i := range allArticles {
+		if section != allArticles[i].Section && section != "" {
+			continue
 		}
 
-	default:
-		_, _ = fmt.Fprintf(w, "The request is not supported.")
+		matchEntities := true
+		for name, entity := range entityFilters {
+			if !hasEntity(allArticles[i], entityTypes[name], entity) {
+				matchEntities = false
+				break
+			}
+		}
+		if !matchEntities {
+			continue
+		}
+
+		if tag != "" {
+			for j := range allArticles[i].Tags {
+				if tag == allArticles[i].Tags[j] {
+					filteredArticles = append(filteredArticles, allArticles[i])
+					break
+				}
+			}
+		} else {
+			filteredArticles = append(filteredArticles, allArticles[i])
+		}
 	}
+
+	writeJSON(w, r, http.StatusOK, &filteredArticles)
 }
 
-func (a *Articles) GetTags(w http.ResponseWriter, _ *http.Request) {
+func (a *Articles) GetTags(w http.ResponseWriter, r *http.Request) {
 	uniqueTags := make(map[string]struct{})
 
-	allArticles, err := a.db.AllArticles()
-	must(err)
+	allArticles, err := a.db.AllArticles(r.Context())
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
 
 	for i := range allArticles {
 		for j := range allArticles[i].Tags {
@@ -206,17 +458,17 @@ func (a *Articles) GetTags(w http.ResponseWriter, _ *http.Request) {
 		tags = append(tags, tag)
 	}
 
-	err = json.NewEncoder(w).Encode(&tags)
-	if err != nil {
-		_, _ = fmt.Fprintf(w, "Sorry! Internal error. If you can tell me about this, it would be great!")
-	}
+	writeJSON(w, r, http.StatusOK, &tags)
 }
 
-func (a *Articles) GetSections(w http.ResponseWriter, _ *http.Request) {
+func (a *Articles) GetSections(w http.ResponseWriter, r *http.Request) {
 	uniqueSections := make(map[string]struct{})
 
-	allArticles, err := a.db.AllArticles()
-	must(err)
+	allArticles, err := a.db.AllArticles(r.Context())
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
 
 	for i := range allArticles {
 		uniqueSections[allArticles[i].Section] = struct{}{}
@@ -227,14 +479,5 @@ func (a *Articles) GetSections(w http.ResponseWriter, _ *http.Request) {
 		sections = append(sections, section)
 	}
 
-	err = json.NewEncoder(w).Encode(&sections)
-	if err != nil {
-		_, _ = fmt.Fprintf(w, "Sorry! Internal error. If you can tell me about this, it would be great!")
-	}
-}
-
-func must(err error) {
-	if err != nil {
-		panic(err)
-	}
+	writeJSON(w, r, http.StatusOK, &sections)
 }
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"github.com/vitsensei/infogrid/pkg/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// entityTypes maps the names accepted in query strings to prose labels.
+var entityTypes = map[string][]string{
+	"person":       {models.EntityPerson},
+	"place":        {models.EntityPlace, "LOC"},
+	"organisation": {models.EntityOrganisation},
+	"organization": {models.EntityOrganisation},
+	"org":          {models.EntityOrganisation},
+}
+
+// parseEntityTypes turns "person,GPE" into the labels stored in the database.
+// Unknown names are assumed to be prose labels.
+func parseEntityTypes(v string) []string {
+	var types []string
+	for _, t := range strings.Split(v, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		if labels, ok := entityTypes[strings.ToLower(t)]; ok {
+			types = append(types, labels...)
+		} else {
+			types = append(types, strings.ToUpper(t))
+		}
+	}
+
+	return types
+}
+
+// hasEntity is true if the article mentions an entity called name with one
+// of the given types.
+func hasEntity(article models.Article, types []string, name string) bool {
+	for _, e := range article.Entities {
+		if !strings.EqualFold(e.Text, name) {
+			continue
+		}
+
+		for _, t := range types {
+			if e.Type == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (a *Articles) GetEntities(w http.ResponseWriter, r *http.Request) {
+	types := parseEntityTypes(r.URL.Query().Get("type"))
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a non-negative integer.")
+			return
+		}
+		limit = n
+	}
+
+	stats, err := a.db.EntityStats(r.Context(), types, limit)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, &stats)
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+	"net/http"
+	"strings"
+)
+
+// Error codes used in the "code" field of ErrorResponse.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+)
+
+// ErrorResponse is the JSON envelope written for every failed request.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Encode v before writing anything so that an encoding failure can still
+// be reported with the correct status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	body, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode the response.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(body, '\n'))
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	body, _ := json.Marshal(ErrorResponse{
+		Error: ErrorBody{
+			Code:      code,
+			Message:   message,
+			RequestID: RequestIDFromContext(r.Context()),
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(body, '\n'))
+}
+
+// writeDBError maps an error returned by models.ArticleDB to a status code.
+// The underlying error is logged, never sent to the client.
+func (a *Articles) writeDBError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "The requested resource does not exist.")
+	case isUnavailable(err):
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), err)
+		writeError(w, r, http.StatusServiceUnavailable, CodeUnavailable, "The database is currently unavailable. Please try again later.")
+	default:
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal error. If you can tell me about this, it would be great!")
+	}
+}
+
+// The driver formats server selection failures with %v, so they can only be
+// recognised by their message.
+func isUnavailable(err error) bool {
+	var connErr topology.ConnectionError
+
+	return errors.Is(err, mongo.ErrClientDisconnected) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &connErr) ||
+		strings.Contains(err.Error(), "server selection error")
+}
+
+// NotFound is used as the router's NotFoundHandler.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "No route matches "+r.URL.Path+".")
+}
+
+// MethodNotAllowed is used as the router's MethodNotAllowedHandler.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "The method "+r.Method+" is not supported on "+r.URL.Path+".")
+}
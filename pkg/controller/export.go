@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"github.com/vitsensei/infogrid/pkg/export"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"net/http"
+	"time"
+)
+
+// ExportArticles streams the articles selected by the "section", "tag",
+// "from" and "to" query parameters as JSON Lines, or as CSV with
+// "format=csv". The response can be imported with "infogrid import".
+func (a *Articles) ExportArticles(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = export.JSONL
+	}
+	if format != export.JSONL && format != export.CSV {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "format must be jsonl or csv.")
+		return
+	}
+
+	filter, err := export.ParseFilter(q.Get("section"), q.Get("tag"), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "Invalid filter: "+err.Error()+".")
+		return
+	}
+
+	// Once the first article is written, the status can no longer change, so
+	// a failure only truncates the response. The database is queried before
+	// that, so that it being unavailable is still reported.
+	ew, err := export.NewWriter(w, format)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode the response.")
+		return
+	}
+
+	name := "infogrid-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	started := false
+	n := 0
+	err = a.db.EachArticle(r.Context(), filter, func(article models.Article) error {
+		if !started {
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		n++
+		return ew.Write(article)
+	})
+	if err != nil && !started {
+		w.Header().Del("Content-Disposition")
+		a.writeDBError(w, r, err)
+		return
+	}
+	if err == nil {
+		err = ew.Flush()
+	}
+	if err != nil {
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), "Export truncated after", n, "articles:", err)
+		return
+	}
+
+	a.logger.Println("[INFO]", RequestIDFromContext(r.Context()), "Exported", n, "articles")
+}
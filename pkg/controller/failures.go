@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// A failed article is retried after the backoff given to SetRetries,
+	// doubled for every attempt up to maxRetryBackoff.
+	maxRetryBackoff = 24 * time.Hour
+
+	// Failures given up on are deleted once they are this old.
+	failureMaxAge = 30 * 24 * time.Hour
+)
+
+// SetRetries changes how the articles which could not be captured are
+// retried: up to maxAttempts attempts in total, after backoff doubled for
+// every attempt. 1 attempt records the failures without retrying them.
+func (a *Articles) SetRetries(maxAttempts int, backoff time.Duration) {
+	a.maxAttempts = maxAttempts
+	a.retryBackoff = backoff
+}
+
+// retryable tells if capturing the article again may succeed: the pages
+// without text, and those the server refuses for good, are not retried.
+func retryable(err error) bool {
+	if errors.Is(err, extractor.ErrNoText) {
+		return false
+	}
+
+	var se *fetcher.StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+
+	return true
+}
+
+// recordFailure records that article could not be captured because of
+// captureErr, and when to retry it.
+func (a *Articles) recordFailure(ctx context.Context, article models.Article, captureErr error) {
+	now := time.Now().UTC()
+
+	f, err := a.captures.FailedArticle(ctx, article.URL)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		f = models.FailedArticle{URL: article.URL, FirstFailure: now}
+	} else if err != nil {
+		a.logger.Println("[ERROR] Fail to read the failures of", article.URL, err)
+		return
+	}
+
+	f.Source = article.Source
+	f.Section = article.Section
+	f.Title = article.Title
+	f.PublishedDate = article.PublishedDate
+	f.Error = captureErr.Error()
+	f.Attempts++
+	f.LastFailure = now
+	f.NextRetry = nil
+
+	if retryable(captureErr) && f.Attempts < a.maxAttempts {
+		backoff := a.retryBackoff
+		for i := 1; i < f.Attempts && backoff < maxRetryBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+
+		next := now.Add(backoff)
+		f.NextRetry = &next
+	}
+
+	err = a.captures.SaveFailure(ctx, f)
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to record the failure of", article.URL, err)
+	}
+}
+
+// forgetFailure deletes the failure of the article at url, once stored.
+func (a *Articles) forgetFailure(ctx context.Context, url string) {
+	err := a.captures.DeleteFailure(ctx, url)
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to delete the failure of", url, err)
+	}
+}
+
+// RetryJob returns the scheduler job capturing again the failed articles of
+// s whose retry is due, and deleting the failures given up on long ago.
+func (a *Articles) RetryJob(s Source) scheduler.Func {
+	return func(ctx context.Context, run *models.JobRun) error {
+		r, ok := refetcherOf(s)
+		if !ok {
+			return fmt.Errorf("the source %s cannot fetch its articles again", s.Name())
+		}
+
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		now := time.Now().UTC()
+		failures, err := a.db.DueFailures(ctx, s.Name(), now)
+		if err != nil {
+			return err
+		}
+
+		run.Found = len(failures)
+		for _, f := range failures {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			article := f.Article()
+			err := r.FetchArticle(ctx, &article)
+			if errors.Is(err, fetcher.ErrDisallowed) {
+				a.logger.Println("[WARNING] Skipped article", article.URL, "disallowed by robots.txt")
+				run.Skipped++
+				a.forgetFailure(ctx, article.URL)
+				continue
+			}
+
+			isNew := false
+			if err == nil {
+				err = tag(&article)
+			}
+			if err == nil {
+				isNew, err = a.SummariseArticle(ctx, article)
+			}
+			if err != nil {
+				a.logger.Println("[ERROR] Fail to capture again", article.URL, err)
+				run.Failed++
+				if len(run.Errors) < maxRunErrors {
+					run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", article.URL, err))
+				}
+				a.recordFailure(ctx, article, err)
+				continue
+			}
+
+			a.forgetFailure(ctx, article.URL)
+			if isNew {
+				a.logger.Println("[INFO] Captured article with title", article.Title, "after", f.Attempts, "failures")
+				run.New++
+			}
+		}
+
+		if run.New > 0 {
+			a.CaptureTags(ctx)
+		}
+
+		n, err := a.db.CleanFailures(ctx, now.Add(-failureMaxAge))
+		if err != nil {
+			a.logger.Println("[ERROR] Fail to delete old failures:", err)
+			run.Errors = append(run.Errors, err.Error())
+		} else if n > 0 {
+			a.logger.Println("[INFO] Deleted", n, "failures given up on")
+		}
+
+		if run.Found > 0 && run.Failed == run.Found {
+			return errors.New("no failed article could be captured")
+		}
+
+		return nil
+	}
+}
+
+// FailuresResponse lists the articles which could not be captured.
+type FailuresResponse struct {
+	Failures []models.FailedArticle `json:"failures"`
+}
+
+func (a *Articles) GetFailures(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a positive integer.")
+			return
+		}
+		limit = n
+	}
+
+	failures, err := a.db.Failures(r.Context(), r.URL.Query().Get("source"), limit)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, FailuresResponse{Failures: failures})
+}
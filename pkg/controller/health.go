@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/health"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetHealth changes the monitor checking the captures of every source. The
+// alerts are POSTed as JSON to webhookURL, unless it is empty.
+func (a *Articles) SetHealth(m *health.Monitor, webhookURL string) {
+	a.healthMonitor = m
+	a.webhookURL = webhookURL
+}
+
+// checkHealth compares the capture of the named source with its previous
+// ones, stores it, and reports its alerts. captureErr is the error which
+// prevented the source from being read, if any.
+func (a *Articles) checkHealth(ctx context.Context, source string, metrics models.SourceMetrics, captureErr error) {
+	previous, err := a.captures.SourceRuns(ctx, source, a.healthMonitor.Window)
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to read the health of", source, err)
+		return
+	}
+
+	run := models.SourceRun{
+		Source:        source,
+		Time:          time.Now().UTC(),
+		SourceMetrics: metrics,
+	}
+	if captureErr != nil {
+		run.Error = captureErr.Error()
+	}
+	run.Baseline, run.Alerts = a.healthMonitor.Check(metrics, previous)
+
+	err = a.captures.InsertSourceRun(ctx, run)
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to store the health of", source, err)
+	}
+
+	for _, alert := range run.Alerts {
+		a.logger.Printf("[WARNING] Source %s may be broken: %s is %.2f, below its baseline of %.2f",
+			source, alert.Metric, alert.Value, alert.Baseline)
+	}
+
+	// The webhook is only called when a metric starts alerting, not for as
+	// long as the source is broken
+	var alerted []models.SourceAlert
+	if len(previous) > 0 {
+		alerted = previous[0].Alerts
+	}
+	if a.webhookURL != "" && hasNewAlert(run.Alerts, alerted) {
+		err = a.notify(ctx, run)
+		if err != nil {
+			a.logger.Println("[ERROR] Fail to call the health webhook for", source, err)
+		}
+	}
+}
+
+// hasNewAlert tells if a metric of alerts is not in previous.
+func hasNewAlert(alerts []models.SourceAlert, previous []models.SourceAlert) bool {
+	for _, alert := range alerts {
+		found := false
+		for _, p := range previous {
+			if p.Metric == alert.Metric {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webhookPayload is the SourceRun with a text summing it up, shown by the
+// chat services accepting incoming webhooks.
+type webhookPayload struct {
+	Text string `json:"text"`
+	models.SourceRun
+}
+
+// Time given to the webhook to answer.
+const webhookTimeout = 10 * time.Second
+
+// notify POSTs the alerting run to the webhook.
+func (a *Articles) notify(ctx context.Context, run models.SourceRun) error {
+	var metrics []string
+	for _, alert := range run.Alerts {
+		metrics = append(metrics, fmt.Sprintf("%s %.2f (baseline %.2f)", alert.Metric, alert.Value, alert.Baseline))
+	}
+	text := fmt.Sprintf("infogrid: source %s may be broken: %s", run.Source, strings.Join(metrics, ", "))
+
+	body, err := json.Marshal(webhookPayload{Text: text, SourceRun: run})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// SourceStatus is the health of a source, as of its last captures.
+type SourceStatus struct {
+	Source string `json:"source"`
+
+	// "ok", "alerting" if a metric of the last capture is below its
+	// baseline, "failing" if the last capture could not read the source, or
+	// "unknown" before the first capture with a baseline
+	Status string             `json:"status"`
+	Runs   []models.SourceRun `json:"runs"` // Newest first
+}
+
+// SourcesResponse lists the health of the enabled sources.
+type SourcesResponse struct {
+	Sources []SourceStatus `json:"sources"`
+}
+
+func (a *Articles) GetSources(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a positive integer.")
+			return
+		}
+		limit = n
+	}
+
+	sources := make([]SourceStatus, 0, len(a.sources))
+	for _, s := range a.sources {
+		runs, err := a.db.SourceRuns(r.Context(), s.Name(), limit)
+		if err != nil {
+			a.writeDBError(w, r, err)
+			return
+		}
+
+		sources = append(sources, SourceStatus{Source: s.Name(), Status: status(runs), Runs: runs})
+	}
+
+	writeJSON(w, r, http.StatusOK, SourcesResponse{Sources: sources})
+}
+
+// status returns the Status of a source whose last runs are runs.
+func status(runs []models.SourceRun) string {
+	switch {
+	case len(runs) == 0:
+		return "unknown"
+	case runs[0].Error != "":
+		return "failing"
+	case len(runs[0].Alerts) > 0:
+		return "alerting"
+	case runs[0].Baseline == nil:
+		return "unknown"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"strconv"
+)
+
+// JobsResponse lists the scheduled jobs and their last runs.
+type JobsResponse struct {
+	Jobs []scheduler.JobStatus `json:"jobs"`
+	Runs []models.JobRun       `json:"runs"`
+}
+
+func (a *Articles) GetJobs(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a positive integer.")
+			return
+		}
+		limit = n
+	}
+
+	runs, err := a.db.JobRuns(r.Context(), r.URL.Query().Get("job"), limit)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	jobs := make([]scheduler.JobStatus, 0)
+	if a.scheduler != nil {
+		jobs = a.scheduler.Jobs()
+	}
+
+	writeJSON(w, r, http.StatusOK, JobsResponse{Jobs: jobs, Runs: runs})
+}
+
+// GetJob returns the run with the ID given in the path, to poll the status of
+// the jobs started by the other admin endpoints.
+func (a *Articles) GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No job run has the ID "+mux.Vars(r)["id"]+".")
+		return
+	}
+
+	run, err := a.db.JobRunByID(r.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No job run has the ID "+id.Hex()+".")
+		return
+	}
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, run)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// RequestIDFromContext returns the ID assigned by RequestID, or "" when the
+// request did not go through the middleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// RequestID tags every request with an ID, reusing the one sent by a proxy
+// in X-Request-ID if present. The ID is echoed back in the response header
+// and in error bodies so that a failed request can be found in the log.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Recover converts a panic in a handler into a 500 response instead of
+// letting net/http drop the connection.
+func Recover(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+
+					logger.Printf("[ERROR] %s panic serving %s %s: %v\n%s",
+						RequestIDFromContext(r.Context()), r.Method, r.URL.Path, rec, debug.Stack())
+					writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal error. If you can tell me about this, it would be great!")
+				}
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdminOnly restricts a handler to the requests sending the admin token in
+// an "Authorization: Bearer <token>" header. With an empty token, the admin
+// endpoints are disabled.
+func AdminOnly(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeError(w, r, http.StatusForbidden, CodeForbidden, "Admin endpoints are disabled. Set INFOGRID_ADMIN_TOKEN to enable them.")
+				return
+			}
+
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="infogrid admin"`)
+				writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "A valid admin token is required in the Authorization header.")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/health"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source streams the articles of a news source.
+type Source interface {
+	Name() string // Recorded in the articles and the health of the source
+
+	// Fetch lists the articles of the source published since the given
+	// time; sources which do not know the publication dates list them all.
+	// Articles are sent without their text, which is then fetched with
+	// FetchArticle (see Refetcher), unless the source reads it itself.
+	// The errors preventing articles from being listed are sent on errs,
+	// and those of a single article as an *ArticleError. Both channels are
+	// closed once the source is done or ctx is done, and must be read
+	// concurrently.
+	Fetch(ctx context.Context, since time.Time) (articles <-chan models.Article, errs <-chan error)
+}
+
+// captureStore holds what a capture reads and writes: the articles, the
+// failed ones and the health of the sources. It is implemented by
+// models.ArticleDB.
+type captureStore interface {
+	HasURL(ctx context.Context, url string) (bool, error)
+	InsertArticle(ctx context.Context, a models.Article) error
+	SaveSnapshot(ctx context.Context, articleID primitive.ObjectID, page *models.Page) (*models.Snapshot, error)
+
+	FailedArticle(ctx context.Context, url string) (models.FailedArticle, error)
+	SaveFailure(ctx context.Context, f models.FailedArticle) error
+	DeleteFailure(ctx context.Context, url string) error
+
+	SourceRuns(ctx context.Context, source string, limit int) ([]models.SourceRun, error)
+	InsertSourceRun(ctx context.Context, run models.SourceRun) error
+}
+
+// ArticleError is sent by a Source for an article it listed but could not
+// read.
+type ArticleError struct {
+	Article models.Article
+	Err     error
+}
+
+func (e *ArticleError) Error() string {
+	return e.Article.URL + ": " + e.Err.Error()
+}
+
+func (e *ArticleError) Unwrap() error {
+	return e.Err
+}
+
+// Adapt makes a Source of api. Its Capture reads every article, pages
+// included, before the first one is sent.
+func Adapt(api API) Source {
+	return apiSource{api}
+}
+
+type apiSource struct {
+	API
+}
+
+func (s apiSource) Fetch(ctx context.Context, since time.Time) (<-chan models.Article, <-chan error) {
+	articles := make(chan models.Article)
+	errs := make(chan error)
+
+	go func() {
+		defer close(articles)
+		defer close(errs)
+
+		results, err := s.Capture(ctx)
+		for _, r := range results {
+			if r.Article.PublishedBefore(since) {
+				continue
+			}
+
+			if r.Err != nil {
+				select {
+				case errs <- &ArticleError{Article: r.Article, Err: r.Err}:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			select {
+			case articles <- r.Article:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err != nil {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return articles, errs
+}
+
+// refetcherOf returns the Refetcher of s, or of the API it adapts.
+func refetcherOf(s Source) (Refetcher, bool) {
+	if as, ok := s.(apiSource); ok {
+		r, ok := as.API.(Refetcher)
+		return r, ok
+	}
+
+	r, ok := s.(Refetcher)
+	return r, ok
+}
+
+// captureRun counts what happened to the articles of a capture of one
+// source. Its methods are called by the workers of every stage.
+type captureRun struct {
+	mu     sync.Mutex
+	result CaptureResult
+
+	fetched, extracted, length int // See models.SourceMetrics
+	sourceErrors               []string
+}
+
+// read counts an article whose page has been read.
+func (c *captureRun) read(article *models.Article) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if article.Page != nil {
+		c.fetched++
+		c.extracted++
+		c.length += len(article.Text)
+	}
+}
+
+// Defaults of SetPipeline. Extracting is bound by the fetcher, summarising
+// by the CPU, which gets one worker per core.
+const (
+	defaultExtractWorkers = 4
+	defaultStoreWorkers   = 2
+	defaultArticleTimeout = 5 * time.Minute
+)
+
+// SetPipeline changes the number of workers of every stage of a capture, and
+// the time given to fetching, then to storing, an article before it fails.
+// Worker counts below 1 give the defaults (one worker per CPU to summarise),
+// and a negative articleTimeout the default timeout; 0 means no timeout.
+func (a *Articles) SetPipeline(extractWorkers, summariseWorkers, storeWorkers int, articleTimeout time.Duration) {
+	if extractWorkers < 1 {
+		extractWorkers = defaultExtractWorkers
+	}
+	if summariseWorkers < 1 {
+		summariseWorkers = runtime.NumCPU()
+	}
+	if storeWorkers < 1 {
+		storeWorkers = defaultStoreWorkers
+	}
+	if articleTimeout < 0 {
+		articleTimeout = defaultArticleTimeout
+	}
+
+	a.extractWorkers = extractWorkers
+	a.summariseWorkers = summariseWorkers
+	a.storeWorkers = storeWorkers
+	a.articleTimeout = articleTimeout
+}
+
+// articleContext returns the context of one stage of an article, which
+// times out after articleTimeout.
+func (a *Articles) articleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.articleTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, a.articleTimeout)
+}
+
+// captureSource fetches the articles of s published since the given time,
+// and extracts, summarises and stores the new ones. Each stage is run by
+// its own workers, connected by unbuffered channels, so that a slow stage
+// holds back the previous ones.
+func (a *Articles) captureSource(ctx context.Context, s Source, since time.Time) CaptureResult {
+	run := &captureRun{}
+	articles, errs := s.Fetch(ctx, since)
+
+	var errsDone sync.WaitGroup
+	errsDone.Add(1)
+	go func() {
+		defer errsDone.Done()
+
+		for err := range errs {
+			var ae *ArticleError
+			if errors.As(err, &ae) {
+				run.mu.Lock()
+				run.result.Found++
+				run.mu.Unlock()
+
+				a.captureFailed(ctx, run, ae.Article, ae.Err)
+				continue
+			}
+
+			a.logger.Println("[ERROR]", s.Name()+":", err)
+			run.mu.Lock()
+			run.result.addError(fmt.Errorf("%s: %w", s.Name(), err))
+			run.sourceErrors = append(run.sourceErrors, err.Error())
+			run.mu.Unlock()
+		}
+	}()
+
+	extracted := a.extractStage(ctx, s, run, articles)
+	summarised := a.summariseStage(ctx, extracted)
+	a.storeStage(ctx, run, summarised)
+	errsDone.Wait()
+
+	// A cancelled capture says nothing about the health of the source
+	if ctx.Err() == nil {
+		var err error
+		if len(run.sourceErrors) > 0 {
+			err = errors.New(strings.Join(run.sourceErrors, "; "))
+		}
+
+		metrics := health.Measure(run.result.Found, run.fetched, run.extracted, run.length)
+		a.checkHealth(ctx, s.Name(), metrics, err)
+	}
+
+	return run.result
+}
+
+// extractStage fetches the page of the articles of s which are not stored
+// yet, unless s has read it, and tags them.
+func (a *Articles) extractStage(ctx context.Context, s Source, run *captureRun, in <-chan models.Article) <-chan models.Article {
+	out := make(chan models.Article)
+	r, canFetch := refetcherOf(s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.extractWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Once ctx is done, the articles are dropped until the source
+			// closes in
+			for article := range in {
+				run.mu.Lock()
+				run.result.Found++
+				run.mu.Unlock()
+
+				if ctx.Err() != nil {
+					continue
+				}
+
+				stored, err := a.extract(ctx, s, r, canFetch, &article)
+				if err != nil {
+					a.captureFailed(ctx, run, article, err)
+					continue
+				}
+				if stored {
+					continue
+				}
+				run.read(&article)
+
+				select {
+				case out <- article:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// extract fetches the page of article, unless it is already stored or s has
+// read it, and tags it. The articles which cannot be tagged fail, rather
+// than being stored without tags.
+func (a *Articles) extract(ctx context.Context, s Source, r Refetcher, canFetch bool, article *models.Article) (stored bool, err error) {
+	ctx, cancel := a.articleContext(ctx)
+	defer cancel()
+
+	stored, err = a.captures.HasURL(ctx, article.URL)
+	if err != nil || stored {
+		return stored, err
+	}
+
+	if article.Text == "" {
+		if !canFetch {
+			return false, fmt.Errorf("the source %s cannot fetch its articles", s.Name())
+		}
+
+		err = r.FetchArticle(ctx, article)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, tag(article)
+}
+
+// tag extracts the entities and the tags of article, unless its source has
+// given both, whoever read its text.
+func tag(article *models.Article) error {
+	if len(article.Entities) > 0 && len(article.Tags) > 0 {
+		return nil
+	}
+
+	err := extractor.TagArticle(article)
+	if err != nil {
+		return fmt.Errorf("fail to tag the article: %w", err)
+	}
+
+	return nil
+}
+
+// summariseStage summarises the text of the articles.
+func (a *Articles) summariseStage(ctx context.Context, in <-chan models.Article) <-chan models.Article {
+	out := make(chan models.Article)
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.summariseWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for article := range in {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				// Stored even without its summary, which cmd/backfill
+				// computes later
+				err := a.summarise(&article)
+				if err != nil {
+					a.logger.Println("[ERROR] Fail to summarise", article.URL, err)
+				}
+
+				select {
+				case out <- article:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// storeStage stores the articles, and returns once in is closed.
+func (a *Articles) storeStage(ctx context.Context, run *captureRun, in <-chan models.Article) {
+	var wg sync.WaitGroup
+	for i := 0; i < a.storeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for article := range in {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				sctx, cancel := a.articleContext(ctx)
+				err := a.store(sctx, article)
+				cancel()
+				if errors.Is(err, models.ErrDuplicate) {
+					continue // Stored meanwhile, listed twice or by another capture
+				}
+				if err != nil {
+					a.captureFailed(ctx, run, article, err)
+					continue
+				}
+				a.forgetFailure(ctx, article.URL)
+
+				a.logger.Println("[INFO] Captured article with title", article.Title)
+				run.mu.Lock()
+				run.result.New++
+				run.mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// captureFailed counts the article which could not be read or stored, and
+// records it to be retried by RetryJob. Nothing is recorded for the
+// articles of a cancelled capture.
+func (a *Articles) captureFailed(ctx context.Context, run *captureRun, article models.Article, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	run.mu.Lock()
+	if errors.Is(err, fetcher.ErrDisallowed) {
+		run.result.Skipped++
+		run.mu.Unlock()
+
+		a.logger.Println("[WARNING] Skipped article", article.URL, "disallowed by robots.txt")
+		return
+	}
+	if errors.Is(err, extractor.ErrNoText) {
+		run.fetched++ // But without text
+	}
+	run.result.Failed++
+	run.result.addError(fmt.Errorf("%s: %w", article.URL, err))
+	run.mu.Unlock()
+
+	a.logger.Println("[ERROR] Fail to capture", article.URL, err)
+	a.recordFailure(ctx, article, err)
+}
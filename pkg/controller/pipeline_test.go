@@ -0,0 +1,462 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memStore is a captureStore keeping everything in memory.
+type memStore struct {
+	mu         sync.Mutex
+	articles   map[string]models.Article
+	failures   map[string]models.FailedArticle
+	sourceRuns []models.SourceRun
+
+	delay                   time.Duration // Taken by InsertArticle
+	inserting, maxInserting int32         // Concurrent calls of InsertArticle
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		articles: make(map[string]models.Article),
+		failures: make(map[string]models.FailedArticle),
+	}
+}
+
+func (s *memStore) HasURL(ctx context.Context, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.articles[url]
+	return ok, nil
+}
+
+func (s *memStore) InsertArticle(ctx context.Context, a models.Article) error {
+	defer track(&s.inserting, &s.maxInserting)()
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[a.URL]; ok {
+		return models.ErrDuplicate
+	}
+	s.articles[a.URL] = a
+	return nil
+}
+
+func (s *memStore) SaveSnapshot(ctx context.Context, articleID primitive.ObjectID, page *models.Page) (*models.Snapshot, error) {
+	return &models.Snapshot{}, nil
+}
+
+func (s *memStore) FailedArticle(ctx context.Context, url string) (models.FailedArticle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[url]
+	if !ok {
+		return f, mongo.ErrNoDocuments
+	}
+	return f, nil
+}
+
+func (s *memStore) SaveFailure(ctx context.Context, f models.FailedArticle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[f.URL] = f
+	return nil
+}
+
+func (s *memStore) DeleteFailure(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, url)
+	return nil
+}
+
+func (s *memStore) SourceRuns(ctx context.Context, source string, limit int) ([]models.SourceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []models.SourceRun
+	for i := len(s.sourceRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		if s.sourceRuns[i].Source == source {
+			runs = append(runs, s.sourceRuns[i])
+		}
+	}
+	return runs, nil
+}
+
+func (s *memStore) InsertSourceRun(ctx context.Context, run models.SourceRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sourceRuns = append(s.sourceRuns, run)
+	return nil
+}
+
+// stored counts the stored articles.
+func (s *memStore) stored() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.articles)
+}
+
+// urls returns the URLs of the stored articles, sorted.
+func (s *memStore) urls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var urls []string
+	for url := range s.articles {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// testController returns an Articles capturing to store, which neither
+// logs nor reads the lemmatization list.
+func testController(store captureStore) *Articles {
+	a := NewArticleController(nil, nil, 0, log.New(ioutil.Discard, "", 0))
+	a.captures = store
+	a.SetSummariser(0.5, map[string]string{})
+	return a
+}
+
+const testText = "The council met on Monday in Geneva. It approved the budget of the city. " +
+	"The mayor said that the vote was close. The budget will be published next week."
+
+// fakeAPI is an API returning results, then err, and reading the text of
+// the articles in texts.
+type fakeAPI struct {
+	results []models.ArticleResult
+	err     error
+	texts   map[string]string
+}
+
+func (api *fakeAPI) Name() string {
+	return "fake"
+}
+
+func (api *fakeAPI) Capture(ctx context.Context) ([]models.ArticleResult, error) {
+	return api.results, api.err
+}
+
+func (api *fakeAPI) FetchArticle(ctx context.Context, article *models.Article) error {
+	text, ok := api.texts[article.URL]
+	if !ok {
+		return errors.New("no such page")
+	}
+	article.Text = text
+	article.Page = &models.Page{URL: article.URL, Status: 200}
+	return nil
+}
+
+// drain reads the channels of Source.Fetch until they are closed.
+func drain(articles <-chan models.Article, errs <-chan error) ([]models.Article, []error) {
+	var sent []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			sent = append(sent, err)
+		}
+	}()
+
+	var listed []models.Article
+	for article := range articles {
+		listed = append(listed, article)
+	}
+	<-done
+
+	return listed, sent
+}
+
+func TestAdapt(t *testing.T) {
+	since := time.Date(2021, 1, 20, 0, 0, 0, 0, time.UTC)
+	api := &fakeAPI{
+		results: []models.ArticleResult{
+			{Article: models.Article{URL: "https://example.com/read", Source: "fake", Text: testText, PublishedDate: "2021-01-20T12:00:00Z"}},
+			{Article: models.Article{URL: "https://example.com/old", Source: "fake", Text: testText, PublishedDate: "2021-01-19T12:00:00Z"}},
+			{Article: models.Article{URL: "https://example.com/failed", Source: "fake"}, Err: errors.New("server error")},
+			{Article: models.Article{URL: "https://example.com/listed", Source: "fake"}},
+		},
+		err:   errors.New("page 2 unavailable"),
+		texts: map[string]string{"https://example.com/listed": testText},
+	}
+
+	articles, errs := drain(Adapt(api).Fetch(context.Background(), since))
+	if len(articles) != 2 || articles[0].URL != "https://example.com/read" || articles[1].URL != "https://example.com/listed" {
+		t.Errorf("got articles %+v", articles)
+	}
+	var ae *ArticleError
+	if len(errs) != 2 || !errors.As(errs[0], &ae) || ae.Article.URL != "https://example.com/failed" || errs[1] != api.err {
+		t.Errorf("got errors %v", errs)
+	}
+
+	// The adapted source goes through every stage, and is fetched by the
+	// API it adapts
+	store := newMemStore()
+	a := testController(store)
+	result := a.CaptureArticles(context.Background(), since, Adapt(api))
+	if result.Found != 3 || result.New != 2 || result.Failed != 1 || len(result.Errors) != 2 {
+		t.Errorf("got %+v, want 3 articles found, 2 new and 1 failed", result)
+	}
+
+	want := []string{"https://example.com/listed", "https://example.com/read"}
+	if urls := store.urls(); len(urls) != 2 || urls[0] != want[0] || urls[1] != want[1] {
+		t.Fatalf("stored %v, want %v", urls, want)
+	}
+	for _, url := range want {
+		article := store.articles[url]
+		if article.SummarisedText == "" || article.AlgorithmVersion != models.AlgorithmVersion {
+			t.Errorf("%s stored without its summary: %+v", url, article)
+		}
+		// Whether the source or the pipeline read the text
+		if len(article.Tags) == 0 || len(article.Entities) == 0 {
+			t.Errorf("%s stored without tags: %+v", url, article)
+		}
+	}
+	if _, ok := store.failures["https://example.com/failed"]; !ok || len(store.failures) != 1 {
+		t.Errorf("got failures %+v", store.failures)
+	}
+	if len(store.sourceRuns) != 1 || store.sourceRuns[0].Source != "fake" || store.sourceRuns[0].Found != 3 {
+		t.Errorf("got source runs %+v", store.sourceRuns)
+	}
+}
+
+// track counts a call in progress in n, and its maximum in max, until the
+// returned function is called.
+func track(n *int32, max *int32) func() {
+	v := atomic.AddInt32(n, 1)
+	for {
+		m := atomic.LoadInt32(max)
+		if v <= m || atomic.CompareAndSwapInt32(max, m, v) {
+			break
+		}
+	}
+
+	return func() { atomic.AddInt32(n, -1) }
+}
+
+// fakeSource is a Source listing count articles without their text, or
+// as many as read until ctx is done if count is negative, and reading them
+// after delay. The article at slow is read once its context is done.
+type fakeSource struct {
+	name  string
+	count int
+	delay time.Duration
+	slow  string
+
+	listed                func(i int) // Called before the ith article is sent, if not nil
+	fetching, maxFetching int32       // Concurrent calls of FetchArticle
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) url(i int) string {
+	return fmt.Sprintf("https://%s.example.com/%d", s.name, i)
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, since time.Time) (<-chan models.Article, <-chan error) {
+	articles := make(chan models.Article)
+	errs := make(chan error)
+
+	go func() {
+		defer close(articles)
+		defer close(errs)
+
+		for i := 0; s.count < 0 || i < s.count; i++ {
+			if s.listed != nil {
+				s.listed(i)
+			}
+
+			select {
+			case articles <- models.Article{URL: s.url(i), Source: s.name}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return articles, errs
+}
+
+func (s *fakeSource) FetchArticle(ctx context.Context, article *models.Article) error {
+	defer track(&s.fetching, &s.maxFetching)()
+
+	if article.URL == s.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Given processed, so that the tests do not wait for textrank and prose
+	article.Text = testText
+	article.SummarisedText = testText
+	article.Entities = []models.Entity{{Text: "Geneva", Type: models.EntityPlace, Count: 1}}
+	article.Tags = []string{"Geneva"}
+	article.Page = &models.Page{URL: article.URL, Status: 200}
+	return nil
+}
+
+func TestPipelineWorkers(t *testing.T) {
+	const (
+		extractWorkers   = 2
+		summariseWorkers = 1
+		storeWorkers     = 3
+	)
+
+	store := newMemStore()
+	store.delay = 20 * time.Millisecond
+	a := testController(store)
+	a.SetPipeline(extractWorkers, summariseWorkers, storeWorkers, 0)
+
+	// A worker of every stage holds an article, and one more may be waiting
+	// to be sent to each of them
+	src := &fakeSource{name: "workers", count: 30, delay: 5 * time.Millisecond}
+	maxAhead := 0
+	src.listed = func(i int) {
+		if ahead := i - store.stored(); ahead > maxAhead {
+			maxAhead = ahead
+		}
+	}
+
+	result := a.CaptureArticles(context.Background(), time.Time{}, src)
+	if result.Found != 30 || result.New != 30 || result.Failed != 0 {
+		t.Fatalf("got %+v, want 30 new articles", result)
+	}
+
+	if src.maxFetching != extractWorkers {
+		t.Errorf("got %d articles fetched at once, want %d", src.maxFetching, extractWorkers)
+	}
+	if store.maxInserting != storeWorkers {
+		t.Errorf("got %d articles stored at once, want %d", store.maxInserting, storeWorkers)
+	}
+	if limit := 2 * (extractWorkers + summariseWorkers + storeWorkers); maxAhead > limit {
+		t.Errorf("the source listed %d articles ahead of the stored ones, want at most %d", maxAhead, limit)
+	}
+}
+
+func TestPipelineArticleTimeout(t *testing.T) {
+	store := newMemStore()
+	a := testController(store)
+	a.SetPipeline(2, 1, 1, 50*time.Millisecond)
+
+	src := &fakeSource{name: "timeout", count: 4}
+	src.slow = src.url(1)
+
+	start := time.Now()
+	result := a.CaptureArticles(context.Background(), time.Time{}, src)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("capture took %s", d)
+	}
+
+	if result.Found != 4 || result.New != 3 || result.Failed != 1 {
+		t.Errorf("got %+v, want 3 new articles and 1 failed", result)
+	}
+	f, ok := store.failures[src.slow]
+	if !ok || !strings.Contains(f.Error, "deadline exceeded") || f.NextRetry == nil {
+		t.Errorf("got failure %+v, want the slow article to be retried", f)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	store := newMemStore()
+	a := testController(store)
+	a.SetPipeline(4, 2, 2, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &fakeSource{name: "endless", count: -1}
+	src.listed = func(i int) {
+		if store.stored() >= 3 {
+			cancel()
+		}
+	}
+
+	done := make(chan CaptureResult)
+	go func() {
+		done <- a.CaptureArticles(ctx, time.Time{}, src)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the cancelled capture did not return")
+	}
+
+	// Nothing is recorded about a cancelled capture
+	if len(store.failures) != 0 || len(store.sourceRuns) != 0 {
+		t.Errorf("got failures %+v and source runs %+v", store.failures, store.sourceRuns)
+	}
+
+	// Every worker has returned
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left running after the capture", n-goroutines)
+	}
+}
+
+func TestPipelineControllers(t *testing.T) {
+	stores := []*memStore{newMemStore(), newMemStore()}
+	sources := []*fakeSource{{name: "first", count: 10}, {name: "second", count: 15}}
+
+	var wg sync.WaitGroup
+	results := make([]CaptureResult, 2)
+	for i := range stores {
+		a := testController(stores[i])
+		a.SetPipeline(2, 2, 2, time.Minute)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = a.CaptureArticles(context.Background(), time.Time{}, sources[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, s := range sources {
+		if results[i].New != s.count {
+			t.Errorf("%s: got %+v, want %d new articles", s.name, results[i], s.count)
+		}
+
+		urls := stores[i].urls()
+		if len(urls) != s.count {
+			t.Errorf("%s: got %d articles stored, want %d", s.name, len(urls), s.count)
+		}
+		for _, url := range urls {
+			if !strings.HasPrefix(url, "https://"+s.name+".") {
+				t.Errorf("%s: got %s stored", s.name, url)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CleanArticles applies the retention rules, whatever the number of stored
+// articles. With "max_age", a single rule removes every article captured
+// before, except the bookmarked ones. With "dry_run=true", nothing is
+// removed, and the report of what would be is returned at once.
+func (a *Articles) CleanArticles(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	rules := a.retention
+	if v := q.Get("max_age"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "max_age must be a positive duration, for example 72h.")
+			return
+		}
+		rules = []models.RetentionRule{{MaxAge: d, KeepBookmarked: true}}
+	}
+
+	dryRun := false
+	if v := q.Get("dry_run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "dry_run must be true or false.")
+			return
+		}
+	}
+
+	if dryRun {
+		// Nothing is removed, so there is no need to wait for a capture
+		report, err := a.clean(r.Context(), rules, true)
+		if err != nil {
+			a.writeDBError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, report)
+		return
+	}
+
+	run, err := a.scheduler.Submit("clean", func(ctx context.Context, run *models.JobRun) error {
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		report, err := a.clean(ctx, rules, false)
+		run.Deleted = report.Removed
+		a.CaptureTags(ctx)
+		return err
+	})
+	a.writeJobStarted(w, r, run, err)
+}
+
+// BookmarkArticle bookmarks the article with the ID given in the path, so
+// that the retention rules with keep_bookmarked keep it.
+func (a *Articles) BookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	a.setBookmarked(w, r, true)
+}
+
+// UnbookmarkArticle removes the bookmark of the article with the ID given in
+// the path.
+func (a *Articles) UnbookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	a.setBookmarked(w, r, false)
+}
+
+func (a *Articles) setBookmarked(w http.ResponseWriter, r *http.Request, bookmarked bool) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No article has the ID "+mux.Vars(r)["id"]+".")
+		return
+	}
+
+	err = a.db.SetBookmarked(r.Context(), id, bookmarked)
+	if err == nil {
+		var article *models.Article
+		article, err = a.db.ByID(r.Context(), id)
+		if err == nil {
+			writeJSON(w, r, http.StatusOK, article)
+			return
+		}
+	}
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No article has the ID "+id.Hex()+".")
+		return
+	}
+	a.writeDBError(w, r, err)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GetSnapshot returns the HTML of the article with the ID given in the path,
+// as it was fetched, or with "format=json" the record of the snapshot: fetch
+// time, HTTP status and headers, and SHA-256 of the HTML.
+func (a *Articles) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "html" && format != "json" {
+		writeError(w, r, http.StatusBadRequest, CodeBadRequest, "format must be html or json.")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No article has the ID "+mux.Vars(r)["id"]+".")
+		return
+	}
+
+	s, data, err := a.db.LatestSnapshot(r.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "The article "+id.Hex()+" has no snapshot.")
+		return
+	}
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	if format == "json" {
+		writeJSON(w, r, http.StatusOK, s)
+		return
+	}
+
+	contentType := s.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	// The page is served from our origin, so its scripts must not run
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Security-Policy", "sandbox")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("ETag", `"`+s.Hash+`"`)
+	h.Set("X-Snapshot-URL", s.URL)
+	h.Set("X-Snapshot-Fetched-At", s.FetchedAt.UTC().Format(time.RFC3339))
+	h.Set("Vary", "Accept-Encoding")
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		h.Set("Content-Encoding", "gzip")
+		_, _ = w.Write(data)
+		return
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err == nil {
+		_, err = io.Copy(w, zr)
+	}
+	if err != nil {
+		a.logger.Println("[ERROR]", RequestIDFromContext(r.Context()), "Snapshot", s.Hash, err)
+	}
+}
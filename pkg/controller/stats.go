@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultStatsWindow = 24 * time.Hour
+	maxStatsWindow     = 90 * 24 * time.Hour
+)
+
+type StatsResponse struct {
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	PreviousFrom time.Time     `json:"previous_from"`
+	Stats        []models.Stat `json:"stats"`
+}
+
+// parseStatsQuery reads the "window" (a Go duration such as "24h") and
+// "limit" query parameters. ok is false if an error has been written to w.
+func parseStatsQuery(w http.ResponseWriter, r *http.Request) (window time.Duration, limit int, ok bool) {
+	window = defaultStatsWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxStatsWindow {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest,
+				"window must be a positive duration of at most "+maxStatsWindow.String()+", for example 24h.")
+			return 0, 0, false
+		}
+		window = d
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a non-negative integer.")
+			return 0, 0, false
+		}
+		limit = n
+	}
+
+	return window, limit, true
+}
+
+func (a *Articles) writeStats(w http.ResponseWriter, r *http.Request,
+	compute func(context.Context, time.Time, time.Duration) ([]models.Stat, error)) {
+	window, limit, ok := parseStatsQuery(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	stats, err := compute(r.Context(), now, window)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+
+	writeJSON(w, r, http.StatusOK, StatsResponse{
+		From:         now.Add(-window),
+		To:           now,
+		PreviousFrom: now.Add(-2 * window),
+		Stats:        stats,
+	})
+}
+
+func (a *Articles) GetTagStats(w http.ResponseWriter, r *http.Request) {
+	a.writeStats(w, r, a.db.TagStats)
+}
+
+func (a *Articles) GetSectionStats(w http.ResponseWriter, r *http.Request) {
+	a.writeStats(w, r, a.db.SectionStats)
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetTrendBucket changes the width of the buckets of time in which the tags
+// are counted to look for trends. It should be the interval between two
+// captures, and is rounded to whole hours.
+func (a *Articles) SetTrendBucket(d time.Duration) {
+	a.trendDetector.Bucket = d
+}
+
+// DetectTrends looks for bursts of tags in the buckets captured since the
+// last call (or in the last 24 hours on the first call) and stores them. It
+// runs after every capture, before old articles are cleaned, so that the
+// articles causing a burst are still there. The counts of the tags are
+// stored too, to compare the next buckets with once their articles are gone.
+func (a *Articles) DetectTrends(ctx context.Context) {
+	now := time.Now().UTC()
+	from := a.lastTrendRun
+	if from.IsZero() {
+		from = now.Add(-24 * time.Hour)
+	}
+	since := a.trendDetector.Since(from)
+
+	counts, err := a.db.TagHourlyCounts(ctx, since)
+	if err == nil {
+		err = a.db.SaveTagCounts(ctx, counts)
+	}
+	if err == nil {
+		counts, err = a.db.TagCounts(ctx, since)
+	}
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to count tags for trend detection:", err)
+		return
+	}
+
+	for _, event := range a.trendDetector.Detect(counts, from, now) {
+		err = a.db.UpsertTrendEvent(ctx, event)
+		if err != nil {
+			a.logger.Println("[ERROR] Fail to store trend event for tag", event.Tag, err)
+			continue
+		}
+
+		a.logger.Printf("[INFO] Trending tag %q: %d articles at %s (z-score %.1f)",
+			event.Tag, event.Count, event.Hour.Format(time.RFC3339), event.ZScore)
+	}
+
+	_, err = a.db.CleanTagCounts(ctx, a.trendDetector.Since(now))
+	if err != nil {
+		a.logger.Println("[ERROR] Fail to delete old tag counts:", err)
+	}
+
+	a.lastTrendRun = now
+}
+
+// Trend is a stored event together with the articles that caused it.
+type Trend struct {
+	models.TrendEvent
+	Articles []models.Article `json:"articles"`
+}
+
+func (a *Articles) GetTrending(w http.ResponseWriter, r *http.Request) {
+	since := 24 * time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "since must be a positive duration, for example 24h.")
+			return
+		}
+		since = d
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, CodeBadRequest, "limit must be a positive integer.")
+			return
+		}
+		limit = n
+	}
+
+	events, err := a.db.TrendEvents(r.Context(), time.Now().UTC().Add(-since).Truncate(time.Hour), limit)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	trends := make([]Trend, 0, len(events))
+	for _, event := range events {
+		articles, err := a.db.ByURLs(r.Context(), event.ArticleURLs)
+		if err != nil {
+			a.writeDBError(w, r, err)
+			return
+		}
+
+		trends = append(trends, Trend{TrendEvent: event, Articles: articles})
+	}
+
+	writeJSON(w, r, http.StatusOK, &trends)
+}
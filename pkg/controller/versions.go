@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/vitsensei/infogrid/pkg/diff"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/scheduler"
+	"github.com/vitsensei/infogrid/pkg/textrank"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"time"
+)
+
+// Refetcher is implemented by the sources, or the adapted APIs, that can
+// fetch one of their articles again, setting its Text and Page.
+type Refetcher interface {
+	FetchArticle(ctx context.Context, article *models.Article) error
+}
+
+// RefreshJob returns the scheduler job fetching again the articles of s
+// captured less than window ago. The edited articles are summarised and
+// tagged again, and their previous version is kept.
+func (a *Articles) RefreshJob(s Source, window time.Duration) scheduler.Func {
+	return func(ctx context.Context, run *models.JobRun) error {
+		r, ok := refetcherOf(s)
+		if !ok {
+			return fmt.Errorf("the source %s cannot fetch its articles again", s.Name())
+		}
+
+		a.captureMu.Lock()
+		defer a.captureMu.Unlock()
+
+		// An edit is only recorded if the page has been seen now, not if
+		// it was still fresh in the cache
+		ctx = fetcher.NoCache(ctx)
+
+		as, err := a.db.RecentArticles(ctx, s.Name(), time.Now().UTC().Add(-window))
+		if err != nil {
+			return err
+		}
+
+		run.Found = len(as)
+		for i := range as {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			edited, err := a.refreshArticle(ctx, r, &as[i])
+			if errors.Is(err, fetcher.ErrDisallowed) {
+				a.logger.Println("[WARNING] Skipped article", as[i].URL, "disallowed by robots.txt")
+				run.Skipped++
+				continue
+			}
+			if err != nil {
+				a.logger.Println("[ERROR] Fail to fetch again", as[i].URL, err)
+				run.Failed++
+				if len(run.Errors) < maxRunErrors {
+					run.Errors = append(run.Errors, fmt.Sprintf("%s: %v", as[i].URL, err))
+				}
+				continue
+			}
+			if edited {
+				run.Updated++
+			}
+		}
+
+		if run.Updated > 0 {
+			a.CaptureTags(ctx)
+		}
+
+		if run.Found > 0 && run.Failed == run.Found {
+			return errors.New("no article could be fetched again")
+		}
+
+		return nil
+	}
+}
+
+// refreshArticle fetches old again and, if its text has changed, stores the
+// new version. edited is false if the text is the same.
+func (a *Articles) refreshArticle(ctx context.Context, r Refetcher, old *models.Article) (edited bool, err error) {
+	updated := *old
+	err = r.FetchArticle(ctx, &updated)
+	if err != nil {
+		return false, err
+	}
+
+	hash := old.TextHash
+	if hash == "" {
+		hash = models.HashText(old.Text)
+	}
+	if models.HashText(updated.Text) == hash {
+		return false, nil
+	}
+
+	t, err := textrank.NewText(updated.Text, a.lemmaDict)
+	if err != nil {
+		return false, err
+	}
+	updated.SummarisedText = t.Summarise(a.summaryRatio)
+
+	err = extractor.TagArticle(&updated)
+	if err != nil {
+		return false, err
+	}
+	updated.AlgorithmVersion = models.AlgorithmVersion
+
+	err = a.db.UpdateVersion(ctx, old, &updated)
+	if err != nil {
+		return false, err
+	}
+	a.logger.Println("[INFO] Article", old.URL, "has been edited, now version", updated.Version)
+
+	if a.snapshots && updated.Page != nil {
+		_, err = a.db.SaveSnapshot(ctx, old.ID, updated.Page)
+		if err != nil {
+			a.logger.Println("[ERROR] Fail to store the snapshot of", old.URL, err)
+		}
+	}
+
+	return true, nil
+}
+
+// ArticleVersions lists the versions of an article, oldest first. The last
+// one is the current version of the article.
+type ArticleVersions struct {
+	ArticleID string    `json:"article_id"`
+	URL       string    `json:"url"`
+	Versions  []Version `json:"versions"`
+}
+
+type Version struct {
+	Version        int        `json:"version"`
+	Title          string     `json:"title"`
+	TextHash       string     `json:"text_hash"`
+	SummarisedText string     `json:"summarised_text"`
+	Tags           []string   `json:"tags"`
+	FetchedAt      time.Time  `json:"fetched_at"`
+	ReplacedAt     *time.Time `json:"replaced_at,omitempty"` // nil for the current version
+
+	// Unified diff of the text from the previous version, whose paragraphs
+	// are the lines. Empty for the first version.
+	Diff string `json:"diff,omitempty"`
+}
+
+// diffContext is the number of unchanged paragraphs shown around changes.
+const diffContext = 1
+
+// GetVersions returns the versions of the article with the ID given in the
+// path, with the diff of their text.
+func (a *Articles) GetVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No article has the ID "+mux.Vars(r)["id"]+".")
+		return
+	}
+
+	article, err := a.db.ByID(r.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "No article has the ID "+id.Hex()+".")
+		return
+	}
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+
+	previous, err := a.db.ArticleVersions(r.Context(), id)
+	if err != nil {
+		a.writeDBError(w, r, err)
+		return
+	}
+	versions := append(previous, models.VersionOf(article))
+
+	res := ArticleVersions{ArticleID: id.Hex(), URL: article.URL}
+	for i, v := range versions {
+		rv := Version{
+			Version:        v.Version,
+			Title:          v.Title,
+			TextHash:       v.TextHash,
+			SummarisedText: v.SummarisedText,
+			Tags:           v.Tags,
+			FetchedAt:      v.FetchedAt,
+		}
+		if i < len(previous) {
+			replacedAt := v.ReplacedAt
+			rv.ReplacedAt = &replacedAt
+		}
+		if i > 0 {
+			rv.Diff = diff.Unified(versions[i-1].Text, v.Text, diffContext)
+		}
+		res.Versions = append(res.Versions, rv)
+	}
+
+	writeJSON(w, r, http.StatusOK, res)
+}
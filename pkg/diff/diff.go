@@ -0,0 +1,180 @@
+// Package diff compares two versions of the text of an article line by line,
+// which for articles means paragraph by paragraph.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is a line of a diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Above this number of line pairs, texts are not compared but replaced as a
+// whole, to bound the memory used.
+const maxPairs = 10000000
+
+// Lines returns the edits turning a into b, keeping the longest common
+// sequence of lines.
+func Lines(a string, b string) []Line {
+	as, bs := split(a), split(b)
+	n, m := len(as), len(bs)
+
+	if n*m > maxPairs {
+		var lines []Line
+		for _, l := range as {
+			lines = append(lines, Line{Delete, l})
+		}
+		for _, l := range bs {
+			lines = append(lines, Line{Insert, l})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common sequence of as[i:] and bs[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case as[i] == bs[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []Line
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case as[i] == bs[j]:
+			lines = append(lines, Line{Equal, as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, as[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, bs[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, Line{Delete, as[i]})
+	}
+	for ; j < m; j++ {
+		lines = append(lines, Line{Insert, bs[j]})
+	}
+
+	return lines
+}
+
+func split(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+// Unified returns the diff from a to b in the unified format, with context
+// unchanged lines around every change, or "" if they are equal.
+func Unified(a string, b string, context int) string {
+	lines := Lines(a, b)
+
+	var sb strings.Builder
+	aLine, bLine := 1, 1 // Of lines[start]
+	for start := 0; start < len(lines); {
+		// Find the next change
+		change := start
+		for change < len(lines) && lines[change].Op == Equal {
+			change++
+		}
+		if change == len(lines) {
+			break
+		}
+
+		first := change - context
+		if first < start {
+			first = start
+		}
+		aLine += first - start
+		bLine += first - start
+
+		// Extend the hunk while the changes are at most 2*context lines
+		// apart, then keep context lines after the last change.
+		end, equal := change, 0
+		for end < len(lines) && equal <= 2*context {
+			if lines[end].Op == Equal {
+				equal++
+			} else {
+				equal = 0
+			}
+			end++
+		}
+		if equal > context {
+			end -= equal - context
+		}
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[first:end] {
+			if l.Op != Insert {
+				aCount++
+			}
+			if l.Op != Delete {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount))
+		for _, l := range lines[first:end] {
+			switch l.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Delete:
+				sb.WriteString("-")
+			case Insert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(l.Text)
+			sb.WriteString("\n")
+		}
+
+		aLine += aCount
+		bLine += bCount
+		start = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the first line and the number of lines of a hunk. An
+// empty range starts at the line before it.
+func hunkRange(line int, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+
+	return fmt.Sprintf("%d,%d", line, count)
+}
@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Line
+	}{
+		{"", "", nil},
+		{"a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{"a\nb\nc", "a\nc", []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}}},
+		{"a\nc", "a\nb\nc", []Line{{Equal, "a"}, {Insert, "b"}, {Equal, "c"}}},
+		{"a\nb", "a\nB", []Line{{Equal, "a"}, {Delete, "b"}, {Insert, "B"}}},
+		{"", "a", []Line{{Insert, "a"}}},
+		{"a\n", "", []Line{{Delete, "a"}}},
+	}
+
+	for _, test := range tests {
+		if got := Lines(test.a, test.b); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lines(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string // As printed by diff -U
+	}{
+		{"empty", "", "", 3, ""},
+		{"identical", "a\nb\n", "a\nb\n", 3, ""},
+		{"trailing newline", "a\nb", "a\nb\n", 3, ""},
+		{"added", "", "a\nb\n", 3, "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"removed", "a\nb\n", "", 3, "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"one line", "a", "b", 0, "@@ -1 +1 @@\n-a\n+b\n"},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\nX\n3\n4\n5\n6\n7\n8\nY\n", 1,
+			"@@ -1,3 +1,3 @@\n 1\n-2\n+X\n 3\n@@ -8,2 +8,2 @@\n 8\n-9\n+Y\n",
+		},
+		{
+			"merged hunks",
+			"1\n2\n3\n4\n", "1\n2b\n3\n4b\n", 1,
+			"@@ -1,4 +1,4 @@\n 1\n-2\n+2b\n 3\n-4\n+4b\n",
+		},
+		{
+			"inserted in the middle",
+			"1\n2\n3\n4\n5\n6\n", "1\n2\n3\nX\n4\n5\n6\n", 2,
+			"@@ -2,4 +2,5 @@\n 2\n 3\n+X\n 4\n 5\n",
+		},
+	}
+
+	for _, test := range tests {
+		if got := Unified(test.a, test.b, test.context); got != test.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
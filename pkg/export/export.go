@@ -0,0 +1,389 @@
+// Package export writes and reads articles as JSON Lines or CSV, to back up
+// the store or move articles between stores. Unlike the JSON of the API, the
+// files include the text of the articles, so that they can be summarised and
+// tagged again after an import.
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats
+const (
+	JSONL = "jsonl"
+	CSV   = "csv"
+)
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/x-ndjson"
+}
+
+// FormatOf guesses the format of a file from its extension: CSV for .csv,
+// and JSONL otherwise.
+func FormatOf(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return CSV
+	}
+
+	return JSONL
+}
+
+func checkFormat(format string) error {
+	if format != JSONL && format != CSV {
+		return fmt.Errorf("unknown format %q; use %s or %s", format, JSONL, CSV)
+	}
+
+	return nil
+}
+
+// record is the JSON Lines form of an article.
+type record struct {
+	models.Article
+	Text string `json:"text"` // Shadows Article.Text, which is not encoded
+}
+
+// csvHeader lists the columns of the CSV form. Tags are separated by "|",
+// and entities are encoded in JSON.
+var csvHeader = []string{
+	"id", "url", "title", "source", "section", "published_date", "captured_at", "algorithm_version",
+	"bookmarked", "tags", "entities", "summarised_text", "text",
+}
+
+const tagSeparator = "|"
+
+// Writer writes articles in one of the formats. Flush must be called after
+// the last article.
+type Writer struct {
+	format string
+	buf    *bufio.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+}
+
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	err := checkFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	ew := &Writer{format: format, buf: bufio.NewWriter(w)}
+	if format == CSV {
+		ew.csv = csv.NewWriter(ew.buf)
+		err = ew.csv.Write(csvHeader)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		ew.json = json.NewEncoder(ew.buf)
+	}
+
+	return ew, nil
+}
+
+func (w *Writer) Write(a models.Article) error {
+	if w.format == JSONL {
+		return w.json.Encode(record{Article: a, Text: a.Text})
+	}
+
+	entities, err := json.Marshal(a.Entities)
+	if err != nil {
+		return err
+	}
+
+	return w.csv.Write([]string{
+		a.ID.Hex(),
+		a.URL,
+		a.Title,
+		a.Source,
+		a.Section,
+		a.PublishedDate,
+		a.CapturedAt.Format(time.RFC3339Nano),
+		strconv.Itoa(a.AlgorithmVersion),
+		strconv.FormatBool(a.Bookmarked),
+		strings.Join(a.Tags, tagSeparator),
+		string(entities),
+		a.SummarisedText,
+		a.Text,
+	})
+}
+
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	return w.buf.Flush()
+}
+
+// Reader reads the articles written by a Writer. The IDs are not read, since
+// the articles are given new ones when imported.
+type Reader struct {
+	format  string
+	json    *json.Decoder
+	csv     *csv.Reader
+	columns map[string]int // CSV column index by name
+	line    int            // Of the last article read, assuming one article per line
+}
+
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	err := checkFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	er := &Reader{format: format}
+	if format == JSONL {
+		er.json = json.NewDecoder(r)
+		return er, nil
+	}
+
+	er.csv = csv.NewReader(r)
+	header, err := er.csv.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the CSV header: %w", err)
+	}
+	er.line = 1
+
+	er.columns = make(map[string]int)
+	for i, name := range header {
+		er.columns[name] = i
+	}
+	if _, ok := er.columns["url"]; !ok {
+		return nil, fmt.Errorf("the CSV header has no url column")
+	}
+
+	return er, nil
+}
+
+// Read returns the next article, or io.EOF after the last one.
+func (r *Reader) Read() (models.Article, error) {
+	r.line++
+
+	if r.format == JSONL {
+		var rec record
+		err := r.json.Decode(&rec)
+		if err != nil {
+			if err == io.EOF {
+				return models.Article{}, err
+			}
+			return models.Article{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+
+		a := rec.Article
+		a.Text = rec.Text
+		return r.check(a)
+	}
+
+	row, err := r.csv.Read()
+	if err != nil {
+		if err == io.EOF {
+			return models.Article{}, err
+		}
+		return models.Article{}, fmt.Errorf("line %d: %w", r.line, err)
+	}
+
+	get := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	a := models.Article{
+		URL:            get("url"),
+		Title:          get("title"),
+		Source:         get("source"),
+		Section:        get("section"),
+		PublishedDate:  get("published_date"),
+		SummarisedText: get("summarised_text"),
+		Text:           get("text"),
+	}
+
+	if v := get("captured_at"); v != "" {
+		a.CapturedAt, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return a, fmt.Errorf("line %d: captured_at: %w", r.line, err)
+		}
+	}
+
+	if v := get("algorithm_version"); v != "" {
+		a.AlgorithmVersion, err = strconv.Atoi(v)
+		if err != nil {
+			return a, fmt.Errorf("line %d: algorithm_version: %w", r.line, err)
+		}
+	}
+
+	if v := get("bookmarked"); v != "" {
+		a.Bookmarked, err = strconv.ParseBool(v)
+		if err != nil {
+			return a, fmt.Errorf("line %d: bookmarked: %w", r.line, err)
+		}
+	}
+
+	if v := get("tags"); v != "" {
+		a.Tags = strings.Split(v, tagSeparator)
+	}
+
+	if v := get("entities"); v != "" && v != "null" {
+		err = json.Unmarshal([]byte(v), &a.Entities)
+		if err != nil {
+			return a, fmt.Errorf("line %d: entities: %w", r.line, err)
+		}
+	}
+
+	return r.check(a)
+}
+
+func (r *Reader) check(a models.Article) (models.Article, error) {
+	if a.URL == "" {
+		return a, fmt.Errorf("line %d: the article has no url", r.line)
+	}
+
+	return a, nil
+}
+
+// ParseFilter builds a filter from comma separated lists of sections and
+// tags, and from RFC 3339 times or dates such as 2021-01-30. Empty values
+// do not filter.
+func ParseFilter(sections string, tags string, from string, to string) (models.ArticleFilter, error) {
+	f := models.ArticleFilter{
+		Sections: splitList(sections),
+		Tags:     splitList(tags),
+	}
+
+	var err error
+	f.From, err = parseTime(from)
+	if err != nil {
+		return f, fmt.Errorf("from: %w", err)
+	}
+
+	f.To, err = parseTime(to)
+	if err != nil {
+		return f, fmt.Errorf("to: %w", err)
+	}
+
+	if !f.From.IsZero() && !f.To.IsZero() && !f.To.After(f.From) {
+		return f, fmt.Errorf("to must be after from")
+	}
+
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("%q is neither a date such as 2021-01-30 nor an RFC 3339 time", s)
+	}
+
+	return t, nil
+}
+
+// FileArchiver archives articles in a new file of a directory, created by
+// the first call of Archive and named after the time of that call.
+type FileArchiver struct {
+	dir    string
+	format string
+	f      *os.File
+	w      *Writer
+}
+
+func NewFileArchiver(dir string, format string) *FileArchiver {
+	return &FileArchiver{dir: dir, format: format}
+}
+
+// Archive writes the articles and syncs the file, so that they can be
+// deleted from the store once it returns.
+func (fa *FileArchiver) Archive(ctx context.Context, articles []models.Article) error {
+	if fa.f == nil {
+		err := os.MkdirAll(fa.dir, 0755)
+		if err != nil {
+			return err
+		}
+
+		name := "infogrid-archive-" + time.Now().UTC().Format("20060102-150405.000") + "." + fa.format
+		f, err := os.OpenFile(filepath.Join(fa.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+
+		fa.w, err = NewWriter(f, fa.format)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		fa.f = f
+	}
+
+	for _, a := range articles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := fa.w.Write(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := fa.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	return fa.f.Sync()
+}
+
+// Name returns the path of the file, or "" if nothing has been archived.
+func (fa *FileArchiver) Name() string {
+	if fa.f == nil {
+		return ""
+	}
+
+	return fa.f.Name()
+}
+
+func (fa *FileArchiver) Close() error {
+	if fa.f == nil {
+		return nil
+	}
+
+	return fa.f.Close()
+}
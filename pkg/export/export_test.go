@@ -0,0 +1,259 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testArticles() []models.Article {
+	updated := time.Date(2021, 1, 21, 8, 0, 0, 0, time.UTC)
+
+	return []models.Article{
+		{
+			ID:             primitive.NewObjectID(),
+			URL:            "https://www.reuters.com/world/europe/talks-idUSKBN29P1",
+			Title:          `Talks resume in Geneva, "at last"`,
+			Section:        "world",
+			PublishedDate:  "2021-01-20T10:00:00-05:00",
+			Text:           "First paragraph, with a comma.\n\nSecond paragraph: « Genève », 日本.\r\nThird|with a pipe.",
+			SummarisedText: "First paragraph, with a comma.",
+			Tags:           []string{"geneva", "united nations"},
+			Entities: []models.Entity{
+				{Text: "geneva", Type: models.EntityPlace, Count: 2, Salience: 0.5},
+				{Text: "united nations", Type: models.EntityOrganisation, Count: 1, Salience: 0.25},
+			},
+			Source:           "reuters",
+			Bookmarked:       true,
+			Version:          2,
+			UpdatedAt:        &updated,
+			Charset:          "windows-1252",
+			CapturedAt:       time.Date(2021, 1, 20, 15, 4, 5, 123456789, time.UTC),
+			AlgorithmVersion: 3,
+		},
+		// Without any of the optional fields
+		{
+			URL:        "https://www.nytimes.com/2021/01/20/us/politics/biden-inauguration.html",
+			CapturedAt: time.Date(2021, 1, 20, 16, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+// roundTrip writes articles in format, and reads them back.
+func roundTrip(t *testing.T, articles []models.Article, format string) []models.Article {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range articles {
+		err = w.Write(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readAll(t, &buf, format)
+}
+
+func readAll(t *testing.T, r io.Reader, format string) []models.Article {
+	er, err := NewReader(r, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read []models.Article
+	for {
+		a, err := er.Read()
+		if err == io.EOF {
+			return read
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, a)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		format string
+		lost   func(a *models.Article) // Clears the fields the format does not keep
+	}{
+		{JSONL, func(a *models.Article) {}},
+		{CSV, func(a *models.Article) {
+			a.ID = primitive.NilObjectID
+			a.Version = 0
+			a.UpdatedAt = nil
+			a.Charset = ""
+			a.Text = strings.ReplaceAll(a.Text, "\r\n", "\n") // By encoding/csv
+		}},
+	}
+
+	for _, test := range tests {
+		articles := testArticles()
+		read := roundTrip(t, articles, test.format)
+		if len(read) != len(articles) {
+			t.Errorf("%s: got %d articles, want %d", test.format, len(read), len(articles))
+			continue
+		}
+
+		for i, want := range articles {
+			got := read[i]
+			test.lost(&want)
+
+			if !got.CapturedAt.Equal(want.CapturedAt) {
+				t.Errorf("%s: got captured_at %v, want %v", test.format, got.CapturedAt, want.CapturedAt)
+			}
+			got.CapturedAt = want.CapturedAt
+			if got.UpdatedAt != nil && want.UpdatedAt != nil && got.UpdatedAt.Equal(*want.UpdatedAt) {
+				got.UpdatedAt = want.UpdatedAt
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got\n%+v\nwant\n%+v", test.format, got, want)
+			}
+		}
+	}
+}
+
+func TestReadCSVColumns(t *testing.T) {
+	// Written by hand: other columns, in another order
+	input := "title,url,tags,comment\n" +
+		"One,https://example.com/1,a|b,ignored\n" +
+		"Two,https://example.com/2,,\n"
+
+	read := readAll(t, strings.NewReader(input), CSV)
+	want := []models.Article{
+		{URL: "https://example.com/1", Title: "One", Tags: []string{"a", "b"}},
+		{URL: "https://example.com/2", Title: "Two"},
+	}
+	if !reflect.DeepEqual(read, want) {
+		t.Errorf("got %+v, want %+v", read, want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   string // In the error of NewReader, or else of the first Read
+	}{
+		{"unknown format", "xml", "", "unknown format"},
+		{"CSV without header", CSV, "", "CSV header"},
+		{"CSV without url", CSV, "title\nOne\n", "no url column"},
+		{"CSV empty url", CSV, "url,title\n,One\n", "line 2: the article has no url"},
+		{"CSV captured_at", CSV, "url,captured_at\nhttps://example.com,yesterday\n", "line 2: captured_at"},
+		{"CSV algorithm_version", CSV, "url,algorithm_version\nhttps://example.com,v2\n", "line 2: algorithm_version"},
+		{"CSV bookmarked", CSV, "url,bookmarked\nhttps://example.com,maybe\n", "line 2: bookmarked"},
+		{"CSV entities", CSV, "url,entities\nhttps://example.com,geneva\n", "line 2: entities"},
+		{"CSV quotes", CSV, "url,title\nhttps://example.com,\"One\n", "line 2"},
+		{"JSONL syntax", JSONL, `{"url": "https://example.com"}` + "\n{url}\n", "line 2"},
+		{"JSONL empty url", JSONL, `{"title": "One"}` + "\n", "line 1: the article has no url"},
+	}
+
+	for _, test := range tests {
+		r, err := NewReader(strings.NewReader(test.input), test.format)
+		for err == nil {
+			_, err = r.Read()
+		}
+		if err == io.EOF || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want an error about %s", test.name, err, test.want)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	day := time.Date(2021, 1, 30, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		sections, tags, from, to string
+		want                     models.ArticleFilter
+		err                      bool
+	}{
+		{"", "", "", "", models.ArticleFilter{}, false},
+		{"world, business,", " biden ", "", "", models.ArticleFilter{Sections: []string{"world", "business"}, Tags: []string{"biden"}}, false},
+		{"", "", "2021-01-30", "2021-01-30T12:00:00Z", models.ArticleFilter{From: day, To: day.Add(12 * time.Hour)}, false},
+		{"", "", "30/01/2021", "", models.ArticleFilter{}, true},
+		{"", "", "", "tomorrow", models.ArticleFilter{}, true},
+		{"", "", "2021-01-30", "2021-01-30", models.ArticleFilter{}, true}, // to must be after from
+	}
+
+	for _, test := range tests {
+		f, err := ParseFilter(test.sections, test.tags, test.from, test.to)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseFilter(%q, %q, %q, %q) = %+v, want an error", test.sections, test.tags, test.from, test.to, f)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(f, test.want) {
+			t.Errorf("ParseFilter(%q, %q, %q, %q) = %+v, %v, want %+v", test.sections, test.tags, test.from, test.to, f, err, test.want)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{
+		"articles.csv":   CSV,
+		"articles.CSV":   CSV,
+		"articles.jsonl": JSONL,
+		"articles":       JSONL,
+		"-":              JSONL,
+	}
+
+	for path, want := range tests {
+		if got := FormatOf(path); got != want {
+			t.Errorf("FormatOf(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestFileArchiver(t *testing.T) {
+	dir := t.TempDir()
+	fa := NewFileArchiver(dir+"/archive", CSV)
+	if fa.Name() != "" {
+		t.Errorf("got file %s before archiving", fa.Name())
+	}
+
+	// Every call appends to the same file
+	articles := testArticles()
+	for _, a := range articles {
+		err := fa.Archive(context.Background(), []models.Article{a})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := fa.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(fa.Name(), dir+"/archive/infogrid-archive-") || !strings.HasSuffix(fa.Name(), ".csv") {
+		t.Errorf("got file %s", fa.Name())
+	}
+
+	f, err := os.Open(fa.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	read := readAll(t, f, CSV)
+	if len(read) != len(articles) || read[0].URL != articles[0].URL || read[1].URL != articles[1].URL {
+		t.Errorf("got %+v, want the %d articles", read, len(articles))
+	}
+}
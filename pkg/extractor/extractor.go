@@ -1,50 +1,107 @@
 package extractor
 
 import (
+	"context"
+	"errors"
 	"github.com/jdkato/prose/v2"
+	"github.com/vitsensei/infogrid/pkg/canonical"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
 	"golang.org/x/net/html"
-	"io/ioutil"
-	"net/http"
+	"golang.org/x/net/html/charset"
 	"sort"
 	"strings"
 )
 
 var (
-	extraSubString = []string{
-		"mr.",
-		"ms.",
-		"mrs.",
-	}
+	canonicaliser = canonical.Default()
 
-	commonString = []string{ // Used to filter out the common tags
-		"congress",
-		"state",
-		"department",
-		"north",
-		"south",
-		"east",
-		"west",
-	}
+	numberOfEntities = 10 // Entities stored with each article by TagArticle
+	numberOfTags     = 3  // Tags stored with each article by TagArticle
+
+	pageFetcher = fetcher.New(fetcher.DefaultConfig())
 )
 
-func ExtractTextFromURL(url string) (string, error) {
-	resp, err := http.Get(url)
+// ErrNoText is returned for the pages in which the sources find no article
+// text, such as interactive articles.
+var ErrNoText = errors.New("no text found")
+
+// SetCanonicaliser replaces the Canonicaliser used by ExtractTags. It is
+// meant to be called once at start up, before any extraction.
+func SetCanonicaliser(c *canonical.Canonicaliser) {
+	canonicaliser = c
+}
+
+// SetFetcher replaces the Fetcher used by FetchPage, and so by every source.
+// Like SetCanonicaliser, it is meant to be called once at start up.
+func SetFetcher(f *fetcher.Fetcher) {
+	pageFetcher = f
+}
+
+// SetLimits changes the number of entities and tags stored by TagArticle.
+// Like SetCanonicaliser, it is meant to be called once at start up.
+func SetLimits(entities int, tags int) {
+	numberOfEntities = entities
+	numberOfTags = tags
+}
+
+func ExtractTextFromURL(ctx context.Context, url string) (string, error) {
+	page, err := FetchPage(ctx, url)
 	if err != nil {
 		return "", err
 	}
 
-	defer func() {
-		err = resp.Body.Close()
-	}()
+	return page.HTML, nil
+}
+
+// FetchPage fetches the page at url with the Fetcher given to SetFetcher,
+// keeping its headers and fetch time so that it can be stored as a snapshot.
+// Pages whose status is not 2xx are returned as a *fetcher.StatusError.
+// The body is kept as sent, and also transcoded to UTF-8 in Page.HTML.
+func FetchPage(ctx context.Context, url string) (*models.Page, error) {
+	return FetchPageWith(ctx, nil, url)
+}
+
+// FetchPageWith is FetchPage with the Fetcher f, or the one given to
+// SetFetcher if f is nil.
+func FetchPageWith(ctx context.Context, f *fetcher.Fetcher, url string) (*models.Page, error) {
+	if f == nil {
+		f = pageFetcher
+	}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	resp, err := f.Get(ctx, url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	bodyString := string(bodyBytes)
+	// Cookies are not worth keeping, and may identify the server
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
 
-	return bodyString, nil
+	page := &models.Page{
+		URL:       resp.URL,
+		Status:    resp.Status,
+		Header:    header,
+		Body:      resp.Body,
+		FetchedAt: resp.FetchedAt,
+	}
+	page.HTML, page.Charset = decode(resp.Body, header.Get("Content-Type"))
+
+	return page, nil
+}
+
+// decode transcodes body to UTF-8. Its charset is given by a byte order
+// mark, the Content-Type header or a <meta charset> tag, or else guessed:
+// UTF-8 if it is valid, windows-1252 otherwise, as browsers do.
+func decode(body []byte, contentType string) (string, string) {
+	enc, name, _ := charset.DetermineEncoding(body, contentType)
+
+	b, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body), name
+	}
+
+	return strings.TrimPrefix(string(b), "\uFEFF"), name
 }
 
 // Recursively extract the <p> tag in HTML string.
@@ -72,105 +129,116 @@ func ExtractText(s string) (string, error) {
 	return paragraph, nil
 }
 
-func normaliseTags(tags []string) ([]string, error) {
-	/*
-		1. lowercase everything
-		2. Remove all the "extra bits" in the tags, such as titles (Mr., Ms., ...)
-		3. Remove common words such as Congress, State, Department, North, South, ...
-		4. Trim trailing white space and some random punctuation
-		5. Remove duplicate tags that might caused by all the operations above
-	*/
+// ExtractEntities returns the numberOfEntities most salient named entities of
+// the text, most salient first.
+func ExtractEntities(text string, numberOfEntities int) ([]models.Entity, error) {
+	// Use prose package to extract the entities
+	doc, err := prose.NewDocument(text)
+	if err != nil {
+		return nil, err
+	}
 
-	// 1. lowercase tags
-	for i := range tags {
-		tags[i] = strings.ToLower(tags[i])
+	// Entities are canonicalised before being counted, so that "Biden" and
+	// "Joe Biden" add up to the same entity.
+	entities := doc.Entities()
+	texts := make([]string, len(entities))
+	for i, ent := range entities {
+		texts[i] = ent.Text
 	}
 
-	// 2. Remove extra sub-string
-	for i := range tags {
-		for _, s := range extraSubString {
-			tags[i] = strings.ReplaceAll(tags[i], s, "")
-		}
+	type mention struct {
+		count      int
+		firstIndex int
+		labels     map[string]int // The same entity can be labelled differently in different sentences
 	}
 
-	var newTags []string
+	mentions := make(map[string]*mention)
+	total := 0
+	for i, name := range canonicaliser.Map(texts) {
+		if name == "" {
+			continue
+		}
 
-	isStringInside := func(s string, list []string) bool {
-		for _, sToCheck := range list {
-			if s == sToCheck {
-				return true
-			}
+		m, ok := mentions[name]
+		if !ok {
+			m = &mention{firstIndex: total, labels: make(map[string]int)}
+			mentions[name] = m
 		}
-		return false
+
+		m.count++
+		m.labels[entities[i].Label]++
+		total++
 	}
 
-	// 3. Remove common words
-	for _, tag := range tags {
-		if !(isStringInside(tag, commonString)) {
-			newTags = append(newTags, tag)
+	// Salience is the share of mentions of the entity, weighted by how early
+	// it is first mentioned: the first entity of the text keeps its full share,
+	// the last one keeps half of it.
+	var result []models.Entity
+	for name, m := range mentions {
+		earliness := 1 - float64(m.firstIndex)/float64(total)
+
+		label := ""
+		for l, n := range m.labels {
+			if n > m.labels[label] || (n == m.labels[label] && l < label) {
+				label = l
+			}
 		}
-	}
 
-	// 4. Trimming
-	for i := range newTags {
-		newTags[i] = strings.Trim(newTags[i], " !@#$%^&*(),./<>?;':{}[]|\\\"-=_+~`")
+		result = append(result, models.Entity{
+			Text:     name,
+			Type:     label,
+			Count:    m.count,
+			Salience: float64(m.count) / float64(total) * (1 + earliness) / 2,
+		})
 	}
 
-	// 5. Extract unique tags
-	uniqueTagsMap := make(map[string]struct{})
-	for _, tag := range newTags {
-		uniqueTagsMap[tag] = struct{}{}
-	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Salience == result[j].Salience {
+			return result[i].Text < result[j].Text
+		}
+		return result[i].Salience > result[j].Salience
+	})
 
-	var uniqueTags []string
-	for key := range uniqueTagsMap {
-		uniqueTags = append(uniqueTags, key)
+	if len(result) > numberOfEntities {
+		result = result[:numberOfEntities]
 	}
 
-	return uniqueTags, nil
+	return result, nil
 }
 
+// ExtractTags returns the names of the numberOfTags most salient entities.
 func ExtractTags(text string, numberOfTags int) ([]string, error) {
-	// Use prose package to extract the tags
-
-	// After prose parses the text, we extract the unique label of each entity
-	// and records the number of its occurrence
-	doc, err := prose.NewDocument(text)
+	entities, err := ExtractEntities(text, numberOfTags)
 	if err != nil {
 		return nil, err
 	}
 
-	uniqueLabel := make(map[string]int)
-	for _, ent := range doc.Entities() {
-		uniqueLabel[ent.Text] = uniqueLabel[ent.Text] + 1
-	}
+	return TagsOf(entities), nil
+}
 
-	// Since uniqueLabel is not sorted (it is a map), we need to sort it
-	// by transform it into slice and then sort the slice
-	type label struct {
-		Name  string
-		Count int
+// TagsOf returns the names of the entities, in the same order.
+func TagsOf(entities []models.Entity) []string {
+	var tags []string
+	for _, e := range entities {
+		tags = append(tags, e.Text)
 	}
 
-	var sortedUniqueLabel []label
-	for key, value := range uniqueLabel {
-		sortedUniqueLabel = append(sortedUniqueLabel, label{key, value})
-	}
+	return tags
+}
 
-	sort.Slice(sortedUniqueLabel, func(i, j int) bool {
-		return sortedUniqueLabel[i].Count > sortedUniqueLabel[j].Count
-	})
+// TagArticle sets the Entities of the article from its text, and its Tags
+// from the most salient of them.
+func TagArticle(article *models.Article) error {
+	entities, err := ExtractEntities(article.Text, numberOfEntities)
+	if err != nil {
+		return err
+	}
 
-	// What we really interested in is the sorted label in descending order
-	// Called the slice of string "tags" to differentiate with sortedUniqueLabel
-	var tags []string
-	for i, label := range sortedUniqueLabel {
-		if i < numberOfTags {
-			tags = append(tags, label.Name)
-		} else {
-			break
-		}
+	article.Entities = entities
+	if len(entities) > numberOfTags {
+		entities = entities[:numberOfTags]
 	}
+	article.Tags = TagsOf(entities)
 
-	return normaliseTags(tags)
+	return nil
 }
@@ -0,0 +1,238 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cache keeps the responses on disk, one file per URL. It is a private
+// cache: responses are served without a request while fresh according to
+// their Cache-Control max-age or Expires header, and revalidated with their
+// ETag and Last-Modified date once stale.
+type cache struct {
+	dir    string
+	maxAge time.Duration // Entries not stored or revalidated for this long are deleted, 0 to keep them
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// Entries are looked for in the cache directory at most this often.
+const pruneInterval = time.Hour
+
+type entry struct {
+	URL       string // After redirects
+	Header    http.Header
+	Body      []byte
+	StoredAt  time.Time // When the response was received, or last revalidated
+	FetchedAt time.Time // Of the request which received, or last revalidated, the response
+}
+
+func newCache(dir string, maxAge time.Duration) *cache {
+	return &cache{dir: dir, maxAge: maxAge}
+}
+
+func (c *cache) path(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// get returns the entry of rawURL, or nil if there is none or it cannot be
+// read.
+func (c *cache) get(rawURL string) *entry {
+	data, err := ioutil.ReadFile(c.path(rawURL))
+	if err != nil {
+		return nil
+	}
+
+	var e entry
+	if gob.NewDecoder(bytes.NewReader(data)).Decode(&e) != nil {
+		return nil
+	}
+
+	return &e
+}
+
+// put stores resp as the entry of rawURL, if it may be stored. The cache is
+// only an optimisation, so that failures to write it are ignored.
+func (c *cache) put(rawURL string, resp *Response) {
+	if resp.Status != http.StatusOK || !storable(resp.Header) {
+		_ = os.Remove(c.path(rawURL))
+		return
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(entry{
+		URL:       resp.URL,
+		Header:    resp.Header,
+		Body:      resp.Body,
+		StoredAt:  time.Now(),
+		FetchedAt: resp.FetchedAt,
+	})
+	if err != nil {
+		return
+	}
+
+	if os.MkdirAll(c.dir, 0700) != nil {
+		return
+	}
+
+	// Written to a temporary file first, so that concurrent gets never read
+	// half an entry.
+	f, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(rawURL))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+
+	c.prune()
+}
+
+// prune deletes the entries older than maxAge, once per pruneInterval.
+func (c *cache) prune() {
+	if c.maxAge <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	if time.Since(c.lastPrune) < pruneInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPrune = time.Now()
+	c.mu.Unlock()
+
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !info.IsDir() && time.Since(info.ModTime()) > c.maxAge {
+			_ = os.Remove(filepath.Join(c.dir, info.Name()))
+		}
+	}
+}
+
+// response returns the cached response, fetched, or revalidated, at
+// fetchedAt.
+func (e *entry) response(fetchedAt time.Time) *Response {
+	return &Response{
+		URL:       e.URL,
+		Status:    http.StatusOK,
+		Header:    e.Header,
+		Body:      e.Body,
+		FetchedAt: fetchedAt,
+		FromCache: true,
+	}
+}
+
+// fresh reports whether the entry can still be used without asking the
+// server.
+func (e *entry) fresh(now time.Time) bool {
+	h := e.Header
+	cc := cacheControl(h)
+
+	var lifetime time.Duration
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	} else if v, ok := cc["max-age"]; ok {
+		s, err := strconv.Atoi(v)
+		if err != nil {
+			return false
+		}
+		lifetime = time.Duration(s) * time.Second
+	} else if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return false // An invalid date means already expired
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = e.StoredAt
+		}
+		lifetime = expires.Sub(date)
+	} else {
+		return false
+	}
+
+	age := now.Sub(e.StoredAt)
+	if s, err := strconv.Atoi(h.Get("Age")); err == nil && s > 0 {
+		age += time.Duration(s) * time.Second
+	}
+
+	return age < lifetime
+}
+
+// revalidate adds the validators of the entry to req, so that the server
+// answers 304 if the entry is still valid.
+func (e *entry) revalidate(req *http.Request) {
+	if etag := e.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lm := e.Header.Get("Last-Modified"); lm != "" {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+}
+
+// updated returns the entry header updated with those of a 304 response.
+func (e *entry) updated(h http.Header) http.Header {
+	header := e.Header.Clone()
+	for k, v := range h {
+		// The 304 response has no body, so that its Content-Length is
+		// not the one of the entry
+		if k != "Content-Length" {
+			header[k] = v
+		}
+	}
+
+	return header
+}
+
+// storable reports whether a response with header h may be cached.
+func storable(h http.Header) bool {
+	if _, ok := cacheControl(h)["no-store"]; ok {
+		return false
+	}
+
+	return h.Get("Vary") != "*"
+}
+
+// cacheControl parses the Cache-Control directives of h, such as
+// "max-age=60, no-cache", into a map from their name to their value.
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, value := d, ""
+			if i := strings.Index(d, "="); i >= 0 {
+				name, value = d[:i], strings.Trim(d[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+
+	return cc
+}
@@ -0,0 +1,146 @@
+package fetcher
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFresh(t *testing.T) {
+	stored := time.Date(2021, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		age    time.Duration // Since the entry was stored
+		want   bool
+	}{
+		{"no header", nil, 0, false},
+		{"max-age", map[string]string{"Cache-Control": "public, max-age=60"}, 59 * time.Second, true},
+		{"max-age expired", map[string]string{"Cache-Control": "max-age=60"}, time.Minute, false},
+		{"max-age with Age", map[string]string{"Cache-Control": "max-age=60", "Age": "30"}, 40 * time.Second, false},
+		{"invalid max-age", map[string]string{"Cache-Control": "max-age=soon"}, 0, false},
+		{"no-cache", map[string]string{"Cache-Control": "no-cache, max-age=60"}, 0, false},
+		{"max-age over Expires", map[string]string{"Cache-Control": "max-age=0", "Expires": "Wed, 20 Jan 2021 13:00:00 GMT"}, time.Second, false},
+		{"Expires", map[string]string{"Date": "Wed, 20 Jan 2021 12:00:00 GMT", "Expires": "Wed, 20 Jan 2021 13:00:00 GMT"}, 59 * time.Minute, true},
+		{"Expires passed", map[string]string{"Date": "Wed, 20 Jan 2021 12:00:00 GMT", "Expires": "Wed, 20 Jan 2021 13:00:00 GMT"}, time.Hour, false},
+		{"Expires without Date", map[string]string{"Expires": "Wed, 20 Jan 2021 12:30:00 GMT"}, 10 * time.Minute, true},
+		{"invalid Expires", map[string]string{"Expires": "0"}, 0, false},
+	}
+
+	for _, test := range tests {
+		h := make(http.Header)
+		for k, v := range test.header {
+			h.Set(k, v)
+		}
+		e := entry{Header: h, StoredAt: stored}
+
+		if got := e.fresh(stored.Add(test.age)); got != test.want {
+			t.Errorf("%s: fresh = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	h := make(http.Header)
+	h.Add("Cache-Control", `Max-Age=60, private="Set-Cookie"`)
+	h.Add("Cache-Control", " no-cache ,, ")
+
+	want := map[string]string{"max-age": "60", "private": "Set-Cookie", "no-cache": ""}
+	if got := cacheControl(h); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStorable(t *testing.T) {
+	tests := []struct {
+		header, value string
+		want          bool
+	}{
+		{"Cache-Control", "max-age=60", true},
+		{"Cache-Control", "no-cache", true},
+		{"Cache-Control", "no-store", false},
+		{"Vary", "Accept-Encoding", true},
+		{"Vary", "*", false},
+	}
+
+	for _, test := range tests {
+		h := http.Header{test.header: {test.value}}
+		if got := storable(h); got != test.want {
+			t.Errorf("storable(%s: %s) = %t, want %t", test.header, test.value, got, test.want)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetcher-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests, notModified int
+	body := "version 1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"` + body + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.Robots = false
+	cfg.CacheDir = dir
+	f := New(cfg)
+	ctx := context.Background()
+
+	first, err := f.Get(ctx, srv.URL+"/page")
+	if err != nil || first.FromCache || string(first.Body) != "version 1" {
+		t.Fatalf("got %+v, %v for the first request", first, err)
+	}
+
+	// Fresh: no request, and the page is as fetched the first time
+	time.Sleep(10 * time.Millisecond)
+	cached, err := f.Get(ctx, srv.URL+"/page")
+	if err != nil || !cached.FromCache || string(cached.Body) != "version 1" || requests != 1 {
+		t.Fatalf("got %+v, %v after %d requests, want the cached page", cached, err, requests)
+	}
+	if !cached.FetchedAt.Equal(first.FetchedAt) {
+		t.Errorf("cached page fetched at %v, want %v", cached.FetchedAt, first.FetchedAt)
+	}
+
+	// Without the cache, the server is asked, and answers not modified
+	revalidated, err := f.Get(NoCache(ctx), srv.URL+"/page")
+	if err != nil || !revalidated.FromCache || string(revalidated.Body) != "version 1" || notModified != 1 {
+		t.Fatalf("got %+v, %v after %d requests, want the page revalidated", revalidated, err, requests)
+	}
+	if !revalidated.FetchedAt.After(first.FetchedAt) {
+		t.Errorf("revalidated page fetched at %v, want after %v", revalidated.FetchedAt, first.FetchedAt)
+	}
+	if revalidated.Header.Get("ETag") != `"version 1"` {
+		t.Errorf("got header %v", revalidated.Header)
+	}
+
+	// Modified: the new page is sent and cached
+	body = "version 2"
+	changed, err := f.Get(NoCache(ctx), srv.URL+"/page")
+	if err != nil || changed.FromCache || string(changed.Body) != "version 2" {
+		t.Fatalf("got %+v, %v, want the new page", changed, err)
+	}
+	cached, err = f.Get(ctx, srv.URL+"/page")
+	if err != nil || string(cached.Body) != "version 2" || requests != 3 {
+		t.Errorf("got %q, %v after %d requests, want the new page cached", cached.Body, err, requests)
+	}
+}
@@ -0,0 +1,511 @@
+// Package fetcher fetches the pages of the sources politely: with a timeout
+// and a User-Agent, obeying robots.txt, retrying the server errors with
+// backoff, limiting the rate and the number of concurrent requests to every
+// host, and caching the responses on disk.
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/robots"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Timeout      time.Duration // Of one attempt, body included
+	UserAgent    string
+	MaxBodySize  int64
+	Retries      int           // Attempts after the first one, for network errors, 429 and 5xx
+	RetryBackoff time.Duration // Before the first retry, doubled for every other one
+	MaxRetryWait time.Duration // Longer backoffs or Retry-After are not waited for
+
+	RatePerHost        float64 // Requests per second to one host
+	BurstPerHost       int     // Requests that can be sent at once after an idle period
+	ConcurrencyPerHost int     // Requests in progress to one host
+
+	Robots bool // Obey the robots.txt of every host, and its Crawl-delay
+
+	CacheDir    string        // Where responses are cached, empty to disable the cache
+	CacheMaxAge time.Duration // Cached responses not revalidated for this long are deleted, 0 to keep them
+
+	// Transport sends the requests, http.DefaultTransport if nil. Tests
+	// replace it by a replay.Replayer.
+	Transport http.RoundTripper
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Timeout:            30 * time.Second,
+		UserAgent:          "infogrid/1.0 (+https://github.com/vitsensei/infogrid)",
+		MaxBodySize:        10 << 20,
+		Retries:            3,
+		RetryBackoff:       time.Second,
+		MaxRetryWait:       time.Minute,
+		RatePerHost:        2,
+		BurstPerHost:       5,
+		ConcurrencyPerHost: 4,
+		Robots:             true,
+	}
+}
+
+// Response is a successful response, with its body read.
+type Response struct {
+	URL       string // After redirects
+	Status    int
+	Header    http.Header
+	Body      []byte
+	FetchedAt time.Time // When the request was sent, earlier for a fresh cached response
+	FromCache bool      // The body was cached: still fresh, or not modified according to the server
+}
+
+// StatusError is returned for the responses whose status is not 2xx.
+type StatusError struct {
+	URL        string // Without its query, which may hold an API key
+	StatusCode int
+	RetryAfter time.Duration // Requested by a 429 or 503 response, 0 if none
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Temporary reports whether the request may succeed later.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// StatusCode returns the status of the response that caused err, or 0 if
+// err is not a StatusError.
+func StatusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+
+	return 0
+}
+
+var (
+	// ErrTooLarge is returned for bodies larger than Config.MaxBodySize.
+	ErrTooLarge = errors.New("response body too large")
+
+	// ErrDisallowed is returned for the URLs that robots.txt disallows.
+	ErrDisallowed = errors.New("disallowed by robots.txt")
+)
+
+const (
+	robotsTTL     = 24 * time.Hour   // How long robots.txt is kept
+	robotsRetry   = 10 * time.Minute // How long a host is avoided when its robots.txt is unreachable
+	maxRobotsSize = 500 << 10        // Only the start of larger robots.txt files is read
+
+	// Longer Crawl-delays would stop the captures for too long.
+	maxCrawlDelay = time.Minute
+)
+
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+	cache  *cache // nil if disabled
+
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+// host limits the requests to one host.
+type host struct {
+	slots  chan struct{} // One per request in progress
+	bucket *bucket
+
+	robotsMu sync.Mutex // Held while robots.txt is fetched, so that it is fetched once
+	robots   *robotsTxt
+}
+
+// robotsTxt is the robots.txt of a host.
+type robotsTxt struct {
+	rules       *robots.Robots
+	unreachable error // Why robots.txt could not be fetched, in which case everything is disallowed
+	expiry      time.Time
+}
+
+func New(cfg Config) *Fetcher {
+	if cfg.ConcurrencyPerHost < 1 {
+		cfg.ConcurrencyPerHost = 1
+	}
+
+	f := &Fetcher{
+		cfg:    cfg,
+		client: &http.Client{Transport: cfg.Transport},
+		hosts:  make(map[string]*host),
+	}
+	if cfg.CacheDir != "" {
+		f.cache = newCache(cfg.CacheDir, cfg.CacheMaxAge)
+	}
+
+	return f
+}
+
+func (f *Fetcher) host(name string) *host {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h, ok := f.hosts[name]
+	if !ok {
+		h = &host{
+			slots:  make(chan struct{}, f.cfg.ConcurrencyPerHost),
+			bucket: newBucket(f.cfg.RatePerHost, f.cfg.BurstPerHost),
+		}
+		f.hosts[name] = h
+	}
+
+	return h
+}
+
+// Get fetches rawURL, retrying the temporary failures. Responses whose
+// status is not 2xx are returned as a *StatusError, and the URLs disallowed
+// by robots.txt are not fetched but return ErrDisallowed. With a cache,
+// fresh cached responses are returned without any request, and stale ones
+// are only sent again by the server if they have changed.
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	h := f.host(strings.ToLower(u.Host))
+	err = f.allowed(ctx, h, u)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached *entry
+	if f.cache != nil {
+		cached = f.cache.get(rawURL)
+		if cached != nil && !noCache(ctx) && cached.fresh(time.Now()) {
+			return cached.response(cached.FetchedAt), nil
+		}
+	}
+
+	resp, err := f.fetch(ctx, h, u, cached)
+	if err == nil && f.cache != nil {
+		f.cache.put(rawURL, resp)
+	}
+
+	return resp, err
+}
+
+type contextKey int
+
+const noCacheKey contextKey = iota
+
+// NoCache returns a context with which Get asks the server even when the
+// cached response is fresh, as "Cache-Control: no-cache" does: the cached
+// response is only used if the server answers that it is not modified.
+func NoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey, true)
+}
+
+func noCache(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey).(bool)
+	return v
+}
+
+// Allowed reports whether the robots.txt of its host allows fetching
+// rawURL, fetching robots.txt if needed. It is always true if Config.Robots
+// is false.
+func (f *Fetcher) Allowed(ctx context.Context, rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+
+	err = f.allowed(ctx, f.host(strings.ToLower(u.Host)), u)
+	if errors.Is(err, ErrDisallowed) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// allowed returns an error wrapping ErrDisallowed if u is disallowed, or the
+// error of the context.
+func (f *Fetcher) allowed(ctx context.Context, h *host, u *url.URL) error {
+	if !f.cfg.Robots {
+		return nil
+	}
+
+	rt, err := f.robotsOf(ctx, h, u)
+	if err != nil {
+		return err
+	}
+	if rt.rules.Allowed(f.cfg.UserAgent, u.RequestURI()) {
+		return nil
+	}
+
+	if rt.unreachable != nil {
+		return fmt.Errorf("GET %s: %w (robots.txt is unreachable: %v)", redact(u), ErrDisallowed, rt.unreachable)
+	}
+	return fmt.Errorf("GET %s: %w", redact(u), ErrDisallowed)
+}
+
+// robotsOf returns the robots.txt of the host of u, fetching it if needed.
+// If it is unreachable, everything is disallowed for a while. The rate of
+// requests to the host is lowered to its Crawl-delay.
+func (f *Fetcher) robotsOf(ctx context.Context, h *host, u *url.URL) (*robotsTxt, error) {
+	h.robotsMu.Lock()
+	defer h.robotsMu.Unlock()
+
+	if h.robots != nil && time.Now().Before(h.robots.expiry) {
+		return h.robots, nil
+	}
+
+	ru := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	resp, err := f.fetch(ctx, h, ru, nil)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	rt := &robotsTxt{rules: robots.AllowAll(), expiry: time.Now().Add(robotsTTL)}
+	switch code := StatusCode(err); {
+	case err == nil:
+		body := resp.Body
+		if len(body) > maxRobotsSize {
+			body = body[:maxRobotsSize]
+		}
+		rt.rules = robots.Parse(body)
+	case code >= 400 && code < 500 && code != http.StatusTooManyRequests:
+		// No robots.txt, so that everything is allowed
+	default:
+		rt.rules, rt.unreachable = robots.DisallowAll(), err
+		rt.expiry = time.Now().Add(robotsRetry)
+	}
+	h.robots = rt
+
+	rate, burst := f.cfg.RatePerHost, f.cfg.BurstPerHost
+	if d := rt.rules.CrawlDelay(f.cfg.UserAgent); d > 0 {
+		if d > maxCrawlDelay {
+			d = maxCrawlDelay
+		}
+		if cr := 1 / d.Seconds(); rate <= 0 || cr < rate {
+			rate = cr
+		}
+		burst = 1
+	}
+	h.bucket.limit(rate, burst)
+
+	return rt, nil
+}
+
+// fetch fetches u, retrying the temporary failures.
+func (f *Fetcher) fetch(ctx context.Context, h *host, u *url.URL, cached *entry) (*Response, error) {
+	backoff := f.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := f.try(ctx, h, u, cached)
+		if err == nil || ctx.Err() != nil || attempt >= f.cfg.Retries {
+			return resp, err
+		}
+
+		wait := jitter(backoff)
+		var se *StatusError
+		if errors.As(err, &se) {
+			if !se.Temporary() {
+				return nil, err
+			}
+			if se.RetryAfter > 0 {
+				wait = se.RetryAfter
+			}
+		}
+		if wait > f.cfg.MaxRetryWait {
+			return nil, err
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
+
+// try makes one attempt, once the host allows it. The request is
+// conditional if there is a cached entry.
+func (f *Fetcher) try(ctx context.Context, h *host, u *url.URL, cached *entry) (*Response, error) {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-h.slots }()
+
+	err := h.bucket.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	if cached != nil {
+		cached.revalidate(req)
+	}
+
+	fetchedAt := time.Now().UTC()
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = redact(u)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		r := cached.response(fetchedAt)
+		r.Header = cached.updated(resp.Header)
+		return r, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Read a little, so that the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+		return nil, &StatusError{
+			URL:        redact(u),
+			StatusCode: resp.StatusCode,
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", redact(u), err)
+	}
+	if int64(len(body)) > f.cfg.MaxBodySize {
+		return nil, fmt.Errorf("GET %s: %w", redact(u), ErrTooLarge)
+	}
+
+	return &Response{
+		URL:       resp.Request.URL.String(),
+		Status:    resp.StatusCode,
+		Header:    resp.Header,
+		Body:      body,
+		FetchedAt: fetchedAt,
+	}, nil
+}
+
+// redact removes the query of u from error messages, since it may hold an
+// API key.
+func redact(u *url.URL) string {
+	r := *u
+	if r.RawQuery != "" {
+		r.RawQuery = "..."
+	}
+
+	return r.String()
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date.
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// jitter spreads the retries of concurrent requests, by up to 20% of d.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// bucket is a token bucket: it holds up to burst tokens, refilled at rate
+// per second, and every request takes one.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// limit changes the rate and the burst of the bucket.
+func (b *bucket) limit(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate, b.burst = rate, float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// wait takes a token, waiting for it if there is none. Tokens are reserved
+// in the order of the calls, so that waiting requests are served in order.
+func (b *bucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	rate := b.rate
+	if rate <= 0 {
+		b.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(time.Duration(deficit / rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
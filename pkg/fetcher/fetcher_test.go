@@ -0,0 +1,232 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns a Config sending requests without delay or retries.
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.RatePerHost = 0
+	cfg.Retries = 0
+
+	return cfg
+}
+
+func TestRobots(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int    // Of robots.txt
+		body    string // Of robots.txt
+		allowed bool   // The page /private
+	}{
+		{"rules", http.StatusOK, "User-agent: infogrid\nDisallow: /private\n", false},
+		{"other crawler", http.StatusOK, "User-agent: other\nDisallow: /\n", true},
+		{"no robots.txt", http.StatusNotFound, "", true},
+		{"forbidden", http.StatusForbidden, "", true},
+		{"too many requests", http.StatusTooManyRequests, "", false},
+		{"server error", http.StatusServiceUnavailable, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					w.WriteHeader(test.status)
+					_, _ = w.Write([]byte(test.body))
+					return
+				}
+				_, _ = w.Write([]byte("page"))
+			}))
+			defer srv.Close()
+
+			f := New(testConfig())
+			_, err := f.Get(context.Background(), srv.URL+"/private")
+			if test.allowed && err != nil {
+				t.Errorf("got %v, want the page", err)
+			}
+			if !test.allowed && !errors.Is(err, ErrDisallowed) {
+				t.Errorf("got %v, want ErrDisallowed", err)
+			}
+
+			// Other pages are allowed unless robots.txt is unreachable
+			_, err = f.Get(context.Background(), srv.URL+"/public")
+			unreachable := test.status >= 500 || test.status == http.StatusTooManyRequests
+			if unreachable != errors.Is(err, ErrDisallowed) {
+				t.Errorf("got %v for another page", err)
+			}
+		})
+	}
+}
+
+func TestRobotsFetchedOnce(t *testing.T) {
+	fetched := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fetched++
+			_, _ = w.Write([]byte("User-agent: *\nCrawl-delay: 4\n"))
+			return
+		}
+		_, _ = w.Write([]byte("page"))
+	}))
+	defer srv.Close()
+
+	f := New(DefaultConfig())
+	for _, path := range []string{"/a", "/b"} {
+		allowed, err := f.Allowed(context.Background(), srv.URL+path)
+		if err != nil || !allowed {
+			t.Fatalf("Allowed(%s) = %t, %v", path, allowed, err)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("robots.txt fetched %d times, want once", fetched)
+	}
+
+	// The Crawl-delay lowers the rate of requests to the host
+	h := f.host(strings.TrimPrefix(srv.URL, "http://"))
+	if h.bucket.rate != 0.25 || h.bucket.burst != 1 {
+		t.Errorf("got rate %g and burst %g, want 0.25 and 1", h.bucket.rate, h.bucket.burst)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int  // Of the successive attempts, 200 afterwards
+		retryAfter string // Header of the failed attempts
+		wantErr    int    // Status of the error, 0 for none
+		attempts   int
+	}{
+		{"recovered", []int{503, 500}, "", 0, 3},
+		{"too many requests", []int{429}, "1", 0, 2},
+		{"given up", []int{502, 502, 502, 502}, "", 502, 4},
+		{"not found", []int{404}, "", 404, 1},
+		{"retry after too long", []int{503}, "120", 503, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts < len(test.statuses) {
+					if test.retryAfter != "" {
+						w.Header().Set("Retry-After", test.retryAfter)
+					}
+					w.WriteHeader(test.statuses[attempts])
+					attempts++
+					return
+				}
+				attempts++
+				_, _ = w.Write([]byte("page"))
+			}))
+			defer srv.Close()
+
+			cfg := testConfig()
+			cfg.Robots = false
+			cfg.Retries = 3
+			cfg.RetryBackoff = time.Millisecond
+			cfg.MaxRetryWait = 2 * time.Second
+			f := New(cfg)
+
+			resp, err := f.Get(context.Background(), srv.URL+"/page?api-key=secret")
+			if StatusCode(err) != test.wantErr || (err == nil) != (test.wantErr == 0) {
+				t.Errorf("got %v, want status %d", err, test.wantErr)
+			}
+			if err == nil && string(resp.Body) != "page" {
+				t.Errorf("got body %q", resp.Body)
+			}
+			if err != nil && strings.Contains(err.Error(), "secret") {
+				t.Errorf("error %q shows the query", err)
+			}
+			if attempts != test.attempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.attempts)
+			}
+		})
+	}
+}
+
+func TestStatusErrorTemporary(t *testing.T) {
+	for status, want := range map[int]bool{400: false, 403: false, 404: false, 429: true, 500: true, 503: true} {
+		if got := (&StatusError{StatusCode: status}).Temporary(); got != want {
+			t.Errorf("Temporary() = %t for %d, want %t", got, status, want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 20 Jan 2021 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 20 Jan 2021 11:59:00 GMT", 0}, // In the past
+	}
+
+	for _, test := range tests {
+		if got := retryAfter(test.header, now); got != test.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", test.header, got, test.want)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	ctx := context.Background()
+	b := newBucket(20, 2)
+
+	// The burst is sent at once, then one request every 50ms
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := b.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond || d > time.Second {
+		t.Errorf("4 requests took %s, want about 100ms", d)
+	}
+
+	// A cancelled wait gives its token back
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	b.mu.Lock()
+	before := b.tokens
+	b.mu.Unlock()
+	if err := b.wait(cctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	b.mu.Lock()
+	after := b.tokens
+	b.mu.Unlock()
+	if after < before {
+		t.Errorf("got %g tokens after a cancelled wait, want at least %g", after, before)
+	}
+
+	// Lowering the burst drops the tokens above it
+	b = newBucket(1, 5)
+	b.limit(1, 1)
+	if b.tokens != 1 {
+		t.Errorf("got %g tokens, want 1", b.tokens)
+	}
+
+	// Without a rate, nothing waits
+	b = newBucket(0, 1)
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		_ = b.wait(ctx)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("10 requests without a rate took %s", d)
+	}
+}
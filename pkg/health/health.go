@@ -0,0 +1,111 @@
+// Package health notices when a source stops working, usually because its
+// markup has changed: the metrics of every capture are compared with their
+// median over the previous captures.
+package health
+
+import (
+	"github.com/vitsensei/infogrid/pkg/models"
+	"sort"
+)
+
+// Monitor alerts when a metric of a capture is below Threshold times its
+// baseline, the median of the Window previous captures.
+type Monitor struct {
+	Window    int     // Number of previous runs forming the baseline
+	MinRuns   int     // Runs needed before any alert, so that the baseline is meaningful
+	Threshold float64 // Share of the baseline under which a metric alerts
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{
+		Window:    10,
+		MinRuns:   3,
+		Threshold: 0.5,
+	}
+}
+
+// Measure returns the metrics of a capture which found articles, fetched
+// the pages of some of them, extracted the text of some pages and whose
+// texts add up to length bytes.
+func Measure(found int, fetched int, extracted int, length int) models.SourceMetrics {
+	m := models.SourceMetrics{Found: found, Fetched: fetched, Extracted: extracted}
+	if fetched > 0 {
+		m.ExtractionRate = float64(extracted) / float64(fetched)
+	}
+	if extracted > 0 {
+		m.AverageLength = float64(length) / float64(extracted)
+	}
+
+	return m
+}
+
+// Check compares current with the previous runs of the source, newest
+// first. The runs which could not read the source are not part of the
+// baseline. The baseline is nil, and there is no alert, if there are fewer
+// than MinRuns previous runs.
+func (m *Monitor) Check(current models.SourceMetrics, previous []models.SourceRun) (*models.SourceMetrics, []models.SourceAlert) {
+	var found, fetched, extracted, rates, lengths []float64
+	for _, run := range previous {
+		if len(found) == m.Window {
+			break
+		}
+		if run.Error != "" {
+			continue
+		}
+
+		found = append(found, float64(run.Found))
+		fetched = append(fetched, float64(run.Fetched))
+		extracted = append(extracted, float64(run.Extracted))
+		// Captures in which every article was already stored say nothing
+		// about the extraction
+		if run.Fetched > 0 {
+			rates = append(rates, run.ExtractionRate)
+		}
+		if run.Extracted > 0 {
+			lengths = append(lengths, run.AverageLength)
+		}
+	}
+	if len(found) < m.MinRuns {
+		return nil, nil
+	}
+
+	baseline := &models.SourceMetrics{
+		Found:          int(median(found) + 0.5),
+		Fetched:        int(median(fetched) + 0.5),
+		Extracted:      int(median(extracted) + 0.5),
+		ExtractionRate: median(rates),
+		AverageLength:  median(lengths),
+	}
+
+	var alerts []models.SourceAlert
+	alert := func(metric string, value float64, base float64) {
+		if base > 0 && value < m.Threshold*base {
+			alerts = append(alerts, models.SourceAlert{Metric: metric, Value: value, Baseline: base})
+		}
+	}
+	alert("found", float64(current.Found), median(found))
+	if current.Fetched > 0 {
+		alert("extraction_rate", current.ExtractionRate, baseline.ExtractionRate)
+	}
+	if current.Extracted > 0 {
+		alert("average_length", current.AverageLength, baseline.AverageLength)
+	}
+
+	return baseline, alerts
+}
+
+// median returns the median of values, or 0 if there are none.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"github.com/vitsensei/infogrid/pkg/models"
+	"reflect"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		found, fetched, extracted, length int
+		want                              models.SourceMetrics
+	}{
+		{0, 0, 0, 0, models.SourceMetrics{}},
+		{10, 0, 0, 0, models.SourceMetrics{Found: 10}},
+		{10, 4, 3, 300, models.SourceMetrics{Found: 10, Fetched: 4, Extracted: 3, ExtractionRate: 0.75, AverageLength: 100}},
+		{10, 4, 0, 0, models.SourceMetrics{Found: 10, Fetched: 4}},
+	}
+
+	for _, test := range tests {
+		if got := Measure(test.found, test.fetched, test.extracted, test.length); got != test.want {
+			t.Errorf("Measure(%d, %d, %d, %d) = %+v, want %+v", test.found, test.fetched, test.extracted, test.length, got, test.want)
+		}
+	}
+}
+
+// run returns a capture measured as Measure does.
+func run(found, fetched, extracted, length int) models.SourceRun {
+	return models.SourceRun{SourceMetrics: Measure(found, fetched, extracted, length)}
+}
+
+func failed() models.SourceRun {
+	return models.SourceRun{Error: "no article found"}
+}
+
+func TestCheck(t *testing.T) {
+	healthy := []models.SourceRun{run(20, 20, 20, 20000), run(20, 20, 20, 20000), run(20, 20, 20, 20000)}
+	baseline := &models.SourceMetrics{Found: 20, Fetched: 20, Extracted: 20, ExtractionRate: 1, AverageLength: 1000}
+
+	tests := []struct {
+		name         string
+		current      models.SourceMetrics
+		previous     []models.SourceRun // Newest first
+		wantBaseline *models.SourceMetrics
+		wantAlerts   []models.SourceAlert
+	}{
+		{"first run", Measure(0, 0, 0, 0), nil, nil, nil},
+		{"too few runs", Measure(0, 0, 0, 0), healthy[:2], nil, nil},
+		{"failed runs left out", Measure(0, 0, 0, 0), []models.SourceRun{failed(), run(20, 20, 20, 20000), failed(), run(20, 20, 20, 20000)}, nil, nil},
+		{"healthy", Measure(18, 18, 17, 17000), healthy, baseline, nil},
+		{
+			"fewer articles found", Measure(5, 5, 5, 5000), healthy, baseline,
+			[]models.SourceAlert{{Metric: "found", Value: 5, Baseline: 20}},
+		},
+		{
+			"nothing found", Measure(0, 0, 0, 0), append([]models.SourceRun{failed()}, healthy...), baseline,
+			[]models.SourceAlert{{Metric: "found", Value: 0, Baseline: 20}},
+		},
+		{
+			"fewer pages extracted", Measure(20, 20, 4, 4000), healthy, baseline,
+			[]models.SourceAlert{{Metric: "extraction_rate", Value: 0.2, Baseline: 1}},
+		},
+		{
+			"shorter texts", Measure(20, 20, 20, 4000), healthy, baseline,
+			[]models.SourceAlert{{Metric: "average_length", Value: 200, Baseline: 1000}},
+		},
+		{
+			"every alert", Measure(8, 8, 2, 200), healthy, baseline,
+			[]models.SourceAlert{
+				{Metric: "found", Value: 8, Baseline: 20},
+				{Metric: "extraction_rate", Value: 0.25, Baseline: 1},
+				{Metric: "average_length", Value: 100, Baseline: 1000},
+			},
+		},
+
+		// Every article already stored: nothing to say about the extraction
+		{"nothing fetched", Measure(20, 0, 0, 0), healthy, baseline, nil},
+		{
+			"baseline of stored articles", Measure(20, 20, 1, 100),
+			[]models.SourceRun{run(20, 0, 0, 0), run(20, 0, 0, 0), run(20, 0, 0, 0)},
+			&models.SourceMetrics{Found: 20},
+			nil,
+		},
+
+		// Medians over the Window newest runs
+		{
+			"window", Measure(15, 15, 15, 15000),
+			append(healthy, run(100, 100, 100, 100000), run(100, 100, 100, 100000), run(100, 100, 100, 100000)),
+			baseline,
+			nil,
+		},
+		{
+			"even number of runs", Measure(10, 10, 10, 10000),
+			[]models.SourceRun{run(10, 10, 10, 1000), run(40, 40, 20, 40000), run(20, 20, 20, 4000), run(30, 30, 30, 9000)},
+			&models.SourceMetrics{Found: 25, Fetched: 25, Extracted: 20, ExtractionRate: 1, AverageLength: 250},
+			[]models.SourceAlert{{Metric: "found", Value: 10, Baseline: 25}},
+		},
+	}
+
+	m := &Monitor{Window: 4, MinRuns: 3, Threshold: 0.5}
+	for _, test := range tests {
+		gotBaseline, gotAlerts := m.Check(test.current, test.previous)
+		if !reflect.DeepEqual(gotBaseline, test.wantBaseline) {
+			t.Errorf("%s: got baseline %+v, want %+v", test.name, gotBaseline, test.wantBaseline)
+		}
+		if !reflect.DeepEqual(gotAlerts, test.wantAlerts) {
+			t.Errorf("%s: got alerts %+v, want %+v", test.name, gotAlerts, test.wantAlerts)
+		}
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{3}, 3},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+
+	for _, test := range tests {
+		values := append([]float64(nil), test.values...)
+		if got := median(values); got != test.want {
+			t.Errorf("median(%v) = %g, want %g", test.values, got, test.want)
+		}
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("median(%v) sorted its argument", test.values)
+		}
+	}
+}
@@ -2,75 +2,320 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"log"
 	"sort"
+	"strings"
 	"time"
 )
 
 type ArticleDB struct {
-	ctx        context.Context
 	client     *mongo.Client
 	database   *mongo.Database
 	collection *mongo.Collection
+	trends     *mongo.Collection
+	jobs       *mongo.Collection
+	snapshots  *mongo.Collection
+	versions   *mongo.Collection // Previous versions of the edited articles
+	blobs      *mongo.Collection // Compressed HTML of the snapshots
+	sourceRuns *mongo.Collection // Health of the sources, see SourceRun
+	failures   *mongo.Collection // Articles to capture again, see FailedArticle
+	tagCounts  *mongo.Collection // Baseline of the trends, see SaveTagCounts
 }
 
 func NewDB() *ArticleDB {
 	return &ArticleDB{}
 }
 
-func (adb *ArticleDB) Init(uri string) error {
+// Init connects to the MongoDB server at uri and uses the given database.
+func (adb *ArticleDB) Init(ctx context.Context, uri string, database string) error {
 	var err error
 	adb.client, err = mongo.NewClient(options.Client().ApplyURI(uri))
 	if err != nil {
 		return err
 	}
 
-	adb.ctx = context.Background()
-	err = adb.client.Connect(adb.ctx)
+	err = adb.client.Connect(ctx)
 	if err != nil {
 		return err
 	}
 
-	adb.database = adb.client.Database("info_grid")
+	adb.database = adb.client.Database(database)
 	adb.collection = adb.database.Collection("articles")
+	adb.trends = adb.database.Collection("trends")
+	adb.jobs = adb.database.Collection("jobs")
+	adb.snapshots = adb.database.Collection("snapshots")
+	adb.versions = adb.database.Collection("article_versions")
+	adb.blobs = adb.database.Collection("snapshot_blobs")
+	adb.sourceRuns = adb.database.Collection("source_runs")
+	adb.failures = adb.database.Collection("failed_articles")
+	adb.tagCounts = adb.database.Collection("tag_counts")
+
+	err = adb.createIndexes(ctx)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return adb.backfillCapturedAt(ctx)
 }
 
-func (adb *ArticleDB) Close() error {
-	return adb.client.Disconnect(adb.ctx)
+// backfillCapturedAt sets the capture time of the articles stored before it
+// was recorded to the time of their ID, when they were inserted, so that the
+// retention rules and the statistics also apply to them. It is a single
+// update run by the server (a pipeline, which needs MongoDB 4.2), finding
+// nothing to do once it has run.
+func (adb *ArticleDB) backfillCapturedAt(ctx context.Context) error {
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"captured_at": bson.M{"$toDate": "$_id"}}}},
+	}
+
+	_, err := adb.collection.UpdateMany(ctx, bson.M{"captured_at": nil}, update)
+	return err
 }
 
-// Remove all documents in "articles" collection by
-// dropping the collection and create it again.
-func (adb *ArticleDB) DestructiveReset() error {
-	err := adb.collection.Drop(adb.ctx)
+// createIndexes creates the indexes of the collections, unless they exist.
+// The URL of an article is unique, so that two workers reading it at once
+// cannot both store it. The articles stored twice before the index existed
+// are deleted first, keeping the oldest copy.
+func (adb *ArticleDB) createIndexes(ctx context.Context) error {
+	urlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := adb.collection.Indexes().CreateOne(ctx, urlIndex)
+	if isDuplicateKey(err) {
+		err = adb.deleteDuplicates(ctx)
+		if err == nil {
+			_, err = adb.collection.Indexes().CreateOne(ctx, urlIndex)
+		}
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("fail to create the unique index on the URL of the articles: %w", err)
 	}
 
-	adb.collection = adb.database.Collection("articles")
+	_, err = adb.tagCounts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tag", Value: 1}, {Key: "hour", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to create the index of the tag counts: %w", err)
+	}
 
 	return nil
 }
 
+// deleteDuplicates deletes the articles whose URL is stored more than once,
+// but the first one stored.
+func (adb *ArticleDB) deleteDuplicates(ctx context.Context) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$url",
+			"first": bson.M{"$min": "$_id"},
+			"ids":   bson.M{"$push": "$_id"},
+		}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	}
+
+	c, err := adb.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+
+	var groups []struct {
+		First primitive.ObjectID   `bson:"first"`
+		IDs   []primitive.ObjectID `bson:"ids"`
+	}
+	err = c.All(ctx, &groups)
+	if err != nil {
+		return err
+	}
+
+	var duplicates []primitive.ObjectID
+	for _, g := range groups {
+		for _, id := range g.IDs {
+			if id != g.First {
+				duplicates = append(duplicates, id)
+			}
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	_, err = adb.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicates}})
+	return err
+}
+
+// ErrDuplicate is returned by InsertArticle for an article whose URL is
+// already stored.
+var ErrDuplicate = errors.New("article already stored")
+
+// isDuplicateKey tells if err is the violation of a unique index, by a
+// write or by the creation of the index.
+func isDuplicateKey(err error) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, e := range we.WriteErrors {
+			if e.Code == duplicateKeyCode {
+				return true
+			}
+		}
+	}
+
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.Code == duplicateKeyCode
+}
+
+const duplicateKeyCode = 11000
+
+// Close waits for the operations in progress, until ctx is done, and
+// disconnects from the server.
+func (adb *ArticleDB) Close(ctx context.Context) error {
+	return adb.client.Disconnect(ctx)
+}
+
+// Remove all documents in "articles" collection by
+// dropping the collection and create it again. Everything recorded about the
+// articles and their sources is dropped too: versions, snapshots, failures,
+// trends and health. Only the history of the jobs is kept.
+func (adb *ArticleDB) DestructiveReset(ctx context.Context) error {
+	for _, c := range []*mongo.Collection{
+		adb.collection, adb.versions, adb.snapshots, adb.blobs,
+		adb.failures, adb.trends, adb.tagCounts, adb.sourceRuns,
+	} {
+		err := c.Drop(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return adb.createIndexes(ctx)
+}
+
 // The document that goes into the (mongo) database.
 type Article struct {
-	URL            string   `bson:"url,omitempty" json:"url"`
-	Title          string   `bson:"title,omitempty" json:"title"`
-	Section        string   `bson:"section,omitempty" json:"section"`
-	PublishedDate  string   `bson:"date_created,omitempty" json:"published_date"`
-	Text           string   `bson:"text,omitempty" json:"-"`
-	SummarisedText string   `bson:"summarised_text,omitempty"`
-	Tags           []string `bson:"tags,omitempty"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL            string             `bson:"url,omitempty" json:"url"`
+	Title          string             `bson:"title,omitempty" json:"title"`
+	Section        string             `bson:"section,omitempty" json:"section"`
+	PublishedDate  string             `bson:"date_created,omitempty" json:"published_date"`
+	Text           string             `bson:"text,omitempty" json:"-"`
+	SummarisedText string             `bson:"summarised_text,omitempty"`
+	Tags           []string           `bson:"tags,omitempty"` // Names of the first Entities, kept for backward compatibility
+	Entities       []Entity           `bson:"entities,omitempty" json:"entities,omitempty"`
+
+	// Name of the source the article was captured from, empty for the
+	// articles stored before it was recorded.
+	Source string `bson:"source,omitempty" json:"source"`
+
+	// Bookmarked articles can be kept by the retention rules, see
+	// RetentionRule.KeepBookmarked.
+	Bookmarked bool `bson:"bookmarked,omitempty" json:"bookmarked"`
+
+	// TextHash is the SHA-256 of Text, compared to detect the edits of the
+	// page when the article is fetched again. Empty for the articles stored
+	// before it was recorded.
+	TextHash string `bson:"text_hash,omitempty" json:"-"`
+
+	// Version is 1 when the article is captured, and incremented for every
+	// edit, see ArticleVersion. 0 for the articles stored before it was
+	// recorded.
+	Version   int        `bson:"version,omitempty" json:"version"`
+	UpdatedAt *time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+
+	// Charset of the page the text was extracted from, such as
+	// "windows-1252", before it was transcoded to UTF-8. Empty for the
+	// articles stored before it was recorded.
+	Charset string `bson:"charset,omitempty" json:"charset,omitempty"`
+
+	// Page the text was extracted from, set by the sources. It is not part
+	// of the article, but stored as its Snapshot if snapshots are enabled.
+	Page *Page `bson:"-" json:"-"`
+
+	// Set by InsertArticle, and by Init to the time of the ID for the
+	// articles stored before it was recorded. Unlike PublishedDate, this is
+	// always a valid time, so it is what the statistics are computed on.
+	CapturedAt time.Time `bson:"captured_at" json:"captured_at"`
+
+	// AlgorithmVersion that computed SummarisedText, Tags and Entities.
+	// 0 for the articles stored before it was recorded.
+	AlgorithmVersion int `bson:"algorithm_version" json:"algorithm_version"`
 }
 
-// Insert an article/document into the mongo database
-func (adb *ArticleDB) InsertArticle(a Article) error {
-	_, err := adb.collection.InsertOne(adb.ctx, a)
+// Layout of the PublishedDate of the articles stored by the first versions,
+// as formatted by time.Time.String.
+const legacyDateLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// PublishedTime parses PublishedDate, an RFC 3339 time, or in the format of
+// the first versions. ok is false if it is neither, as some sources give no
+// date.
+func (a *Article) PublishedTime() (t time.Time, ok bool) {
+	t, err := time.Parse(time.RFC3339, a.PublishedDate)
+	if err == nil {
+		return t, true
+	}
+
+	// time.Time.String adds the monotonic clock reading, such as "m=+0.01"
+	date := a.PublishedDate
+	if i := strings.Index(date, " m="); i >= 0 {
+		date = date[:i]
+	}
+	t, err = time.Parse(legacyDateLayout, date)
+
+	return t, err == nil
+}
+
+// PublishedBefore tells if the article was published before t. It is false
+// if PublishedDate cannot be parsed, see PublishedTime.
+func (a *Article) PublishedBefore(t time.Time) bool {
+	published, ok := a.PublishedTime()
+	return ok && published.Before(t)
+}
+
+// AlgorithmVersion is the version of the summary and tag algorithms
+// (pkg/textrank and pkg/extractor). Increment it after changing them, and run
+// cmd/backfill to process the stored articles again.
+const AlgorithmVersion = 1
+
+// Labels given by the prose named-entity recognition.
+const (
+	EntityPerson       = "PERSON"
+	EntityPlace        = "GPE" // Geopolitical entity: countries, cities, states
+	EntityOrganisation = "ORG"
+)
+
+// Entity is a named entity found in the text of an article.
+type Entity struct {
+	Text  string `bson:"text" json:"text"` // Canonical form, as used in Tags
+	Type  string `bson:"type" json:"type"` // One of the Entity* labels
+	Count int    `bson:"count" json:"count"`
+
+	// Between 0 and 1, higher for entities mentioned often and early in the
+	// text. The salience of all entities of an article add up to at most 1.
+	Salience float64 `bson:"salience" json:"salience"`
+}
+
+// Insert an article/document into the mongo database. ErrDuplicate is
+// returned if its URL is already stored.
+func (adb *ArticleDB) InsertArticle(ctx context.Context, a Article) error {
+	if a.CapturedAt.IsZero() {
+		a.CapturedAt = time.Now().UTC()
+	}
+	a.TextHash = HashText(a.Text)
+	a.Version = 1
+	if a.Page != nil {
+		a.Charset = a.Page.Charset
+	}
+
+	_, err := adb.collection.InsertOne(ctx, a)
+	if isDuplicateKey(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return err
 	}
@@ -78,14 +323,14 @@ func (adb *ArticleDB) InsertArticle(a Article) error {
 	return nil
 }
 
-func (adb *ArticleDB) AllArticles() ([]Article, error) {
-	c, err := adb.collection.Find(adb.ctx, bson.M{})
+func (adb *ArticleDB) AllArticles(ctx context.Context) ([]Article, error) {
+	c, err := adb.collection.Find(ctx, bson.M{})
 	if err != nil {
 		return nil, err
 	}
 
 	var articles Articles
-	err = c.All(adb.ctx, &articles)
+	err = c.All(ctx, &articles)
 	if err != nil {
 		return nil, err
 	}
@@ -98,11 +343,11 @@ func (adb *ArticleDB) AllArticles() ([]Article, error) {
 // ByURL is used in controller packages to check for existing
 // article, assuming the URL of the article never changed and each article
 // has an unique url.
-func (adb *ArticleDB) ByURL(url string) (*Article, error) {
+func (adb *ArticleDB) ByURL(ctx context.Context, url string) (*Article, error) {
 	filter := bson.M{"url": url}
 
 	var article Article
-	err := adb.collection.FindOne(adb.ctx, filter).Decode(&article)
+	err := adb.collection.FindOne(ctx, filter).Decode(&article)
 
 	if err != nil {
 		return nil, err
@@ -111,8 +356,112 @@ func (adb *ArticleDB) ByURL(url string) (*Article, error) {
 	return &article, nil
 }
 
+// HasURL reports whether an article with the given URL is stored.
+func (adb *ArticleDB) HasURL(ctx context.Context, url string) (bool, error) {
+	n, err := adb.collection.CountDocuments(ctx, bson.M{"url": url}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// ByID returns the article with the given ID, or mongo.ErrNoDocuments.
+func (adb *ArticleDB) ByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	var article Article
+	err := adb.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&article)
+	if err != nil {
+		return nil, err
+	}
+
+	return &article, nil
+}
+
+// CapturedBetween returns the articles captured in [from, to).
+func (adb *ArticleDB) CapturedBetween(ctx context.Context, from time.Time, to time.Time) ([]Article, error) {
+	filter := bson.M{"captured_at": bson.M{"$gte": from, "$lt": to}}
+
+	c, err := adb.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"captured_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	articles := make([]Article, 0)
+	err = c.All(ctx, &articles)
+	if err != nil {
+		return nil, err
+	}
+
+	return articles, nil
+}
+
+// UpdateSummary replaces the summary of the article with the given ID. Its
+// algorithm version is left as is, since its tags are not computed again
+// (see UpdateProcessed).
+func (adb *ArticleDB) UpdateSummary(ctx context.Context, id primitive.ObjectID, summary string) error {
+	_, err := adb.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"summarised_text": summary}})
+	return err
+}
+
+// UpdateEntities replaces the entities and the tags of the article with the
+// given ID. As with UpdateSummary, its algorithm version is left as is.
+func (adb *ArticleDB) UpdateEntities(ctx context.Context, id primitive.ObjectID, entities []Entity, tags []string) error {
+	update := bson.M{"$set": bson.M{"entities": entities, "tags": tags}}
+
+	_, err := adb.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// Outdated returns at most limit articles processed by an algorithm older
+// than version, with an ID greater than after (use primitive.NilObjectID to
+// start), sorted by ID.
+func (adb *ArticleDB) Outdated(ctx context.Context, version int, after primitive.ObjectID, limit int) ([]Article, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit))
+
+	c, err := adb.collection.Find(ctx, outdatedFilter(version, after), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	articles := make([]Article, 0, limit)
+	err = c.All(ctx, &articles)
+	if err != nil {
+		return nil, err
+	}
+
+	return articles, nil
+}
+
+// CountOutdated counts the articles processed by an algorithm older than version.
+func (adb *ArticleDB) CountOutdated(ctx context.Context, version int) (int64, error) {
+	return adb.collection.CountDocuments(ctx, outdatedFilter(version, primitive.NilObjectID))
+}
+
+func outdatedFilter(version int, after primitive.ObjectID) bson.M {
+	return bson.M{
+		"_id":               bson.M{"$gt": after},
+		"algorithm_version": bson.M{"$not": bson.M{"$gte": version}}, // Also matches a missing field
+	}
+}
+
+// UpdateProcessed replaces the fields computed from the text of the article
+// with the given ID: the summary, entities, tags and algorithm version.
+func (adb *ArticleDB) UpdateProcessed(ctx context.Context, a Article) error {
+	update := bson.M{"$set": bson.M{
+		"summarised_text":   a.SummarisedText,
+		"entities":          a.Entities,
+		"tags":              a.Tags,
+		"algorithm_version": a.AlgorithmVersion,
+	}}
+
+	_, err := adb.collection.UpdateOne(ctx, bson.M{"_id": a.ID}, update)
+	return err
+}
+
+// UpdateTags replaces the tags of the article with the given URL.
+func (adb *ArticleDB) UpdateTags(ctx context.Context, url string, tags []string) error {
+	_, err := adb.collection.UpdateOne(ctx, bson.M{"url": url}, bson.M{"$set": bson.M{"tags": tags}})
+	return err
+}
+
 // Query the articles by tags and sections
-func (adb *ArticleDB) BySectionsAndTags(sections []string, tags []string) ([]Article, error) {
+func (adb *ArticleDB) BySectionsAndTags(ctx context.Context, sections []string, tags []string) ([]Article, error) {
 	var filter bson.M
 
 	if len(sections) > 0 && len(tags) > 0 {
@@ -139,13 +488,13 @@ func (adb *ArticleDB) BySectionsAndTags(sections []string, tags []string) ([]Art
 	}
 
 	var articles []Article
-	c, err := adb.collection.Find(adb.ctx, filter)
+	c, err := adb.collection.Find(ctx, filter)
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.All(adb.ctx, &articles)
+	err = c.All(ctx, &articles)
 	if err != nil {
 		return nil, err
 	}
@@ -154,13 +503,13 @@ func (adb *ArticleDB) BySectionsAndTags(sections []string, tags []string) ([]Art
 }
 
 // Query the articles by sections
-func (adb *ArticleDB) BySections(sections []string) ([]Article, error) {
-	return adb.BySectionsAndTags(sections, []string{})
+func (adb *ArticleDB) BySections(ctx context.Context, sections []string) ([]Article, error) {
+	return adb.BySectionsAndTags(ctx, sections, []string{})
 }
 
 // Query the articles by tags
-func (adb *ArticleDB) ByTags(tags []string) ([]Article, error) {
-	return adb.BySectionsAndTags([]string{}, tags)
+func (adb *ArticleDB) ByTags(ctx context.Context, tags []string) ([]Article, error) {
+	return adb.BySectionsAndTags(ctx, []string{}, tags)
 }
 
 type Articles []Article
@@ -169,16 +518,13 @@ func (as Articles) Len() int {
 	return len(as)
 }
 
+// Less sorts the articles by PublishedTime, those without a valid date
+// first.
 func (as Articles) Less(i, j int) bool {
-	layout := "2006-01-02 15:04:05 -0700 MST"
-	time1, err := time.Parse(layout, as[i].PublishedDate)
-	if err != nil {
-		return true
-	}
-
-	time2, err := time.Parse(layout, as[j].PublishedDate)
-	if err != nil {
-		return true
+	time1, ok1 := as[i].PublishedTime()
+	time2, ok2 := as[j].PublishedTime()
+	if !ok1 || !ok2 {
+		return !ok1 && ok2
 	}
 
 	return time1.Before(time2)
@@ -187,37 +533,3 @@ func (as Articles) Less(i, j int) bool {
 func (as Articles) Swap(i, j int) {
 	as[i], as[j] = as[j], as[i]
 }
-
-// Delete old articles
-func (adb *ArticleDB) CleanOldArticles(numberOfArticles int, logger *log.Logger) {
-	articles, err := adb.AllArticles()
-	if err != nil {
-		return
-	}
-
-	if len(articles) < numberOfArticles {
-		return
-	}
-
-	layout := "2006-01-02 15:04:05 -0700 MST"
-	for i := range articles {
-		publishedDate, err := time.Parse(layout, articles[i].PublishedDate)
-		if err != nil {
-			logger.Println(err)
-			continue
-		}
-
-		if time.Since(publishedDate).Hours() > 72 {
-			_, err = adb.collection.DeleteOne(adb.ctx, bson.M{"url": articles[i].URL})
-			if err != nil {
-				logger.Println("[ERROR] Fail to delete article with title", articles[i].Title)
-			} else {
-				logger.Println("[INFO] Delete article with title", articles[i].Title)
-			}
-		} else {
-			// Since adb.AllArticles() return articles sorted by their published date (old to new),
-			// we can just break the loop when first encounter articles that is less than 3 days old.
-			break
-		}
-	}
-}
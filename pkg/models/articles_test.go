@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPublishedTime(t *testing.T) {
+	tests := []struct {
+		date string
+		want string // RFC 3339, empty if the date cannot be parsed
+	}{
+		{"2021-01-20T12:00:00-05:00", "2021-01-20T12:00:00-05:00"},
+		{"2021-01-20T17:00:00Z", "2021-01-20T17:00:00Z"},
+		{"2021-01-20 17:00:00.123456789 +0000 UTC", "2021-01-20T17:00:00.123456789Z"},
+		{"2021-01-20 17:00:00.123 +0000 UTC m=+0.004100001", "2021-01-20T17:00:00.123Z"},
+		{"2021-01-20 17:00:00 +0100 CET", "2021-01-20T17:00:00+01:00"},
+		{"", ""},
+		{"yesterday", ""},
+	}
+
+	for _, test := range tests {
+		a := Article{PublishedDate: test.date}
+		got, ok := a.PublishedTime()
+		if test.want == "" {
+			if ok {
+				t.Errorf("PublishedTime(%q) = %v, want no time", test.date, got)
+			}
+			continue
+		}
+
+		want, err := time.Parse(time.RFC3339Nano, test.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || !got.Equal(want) {
+			t.Errorf("PublishedTime(%q) = %v, %t, want %v", test.date, got, ok, want)
+		}
+	}
+}
+
+func TestPublishedBefore(t *testing.T) {
+	since := time.Date(2021, 1, 20, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		date string
+		want bool
+	}{
+		{"2021-01-20T09:00:00-05:00", true},
+		{"2021-01-20T12:00:00-05:00", false},
+		{"2021-01-20 14:59:59.5 +0000 UTC m=+1.5", true},
+		{"2021-01-20 15:00:00 +0000 UTC", false},
+		{"", false}, // Kept when the source gives no date
+	}
+
+	for _, test := range tests {
+		a := Article{PublishedDate: test.date}
+		if got := a.PublishedBefore(since); got != test.want {
+			t.Errorf("PublishedBefore(%q) = %t, want %t", test.date, got, test.want)
+		}
+	}
+}
+
+func TestArticlesSort(t *testing.T) {
+	as := Articles{
+		{URL: "c", PublishedDate: "2021-01-20T12:00:00Z"},
+		{URL: "a", PublishedDate: "unknown"},
+		{URL: "d", PublishedDate: "2021-01-21 08:00:00.5 +0000 UTC m=+3.2"},
+		{URL: "b", PublishedDate: "2021-01-20 11:00:00 +0000 UTC"},
+	}
+	sort.Sort(as)
+
+	for i, url := range []string{"a", "b", "c", "d"} {
+		if as[i].URL != url {
+			t.Fatalf("got %s at %d, want %s: %+v", as[i].URL, i, url, as)
+		}
+	}
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("E11000 duplicate key error"), false},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, true},
+		{mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121}}}, false},
+		{fmt.Errorf("insert: %w", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}), true},
+		{mongo.CommandError{Code: 11000, Name: "DuplicateKey"}, true}, // Creating a unique index
+		{mongo.CommandError{Code: 85, Name: "IndexOptionsConflict"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isDuplicateKey(test.err); got != test.want {
+			t.Errorf("isDuplicateKey(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+// ArticleResult is what a capture of a source got for one of its articles.
+type ArticleResult struct {
+	Article Article
+
+	// Why the page of the article could not be read, nil if it was or if
+	// the article is already stored (its page is then not fetched again).
+	// Article.Page is set if the page was fetched but had no text.
+	Err error
+}
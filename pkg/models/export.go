@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ArticleFilter selects articles. Its zero value selects every article.
+type ArticleFilter struct {
+	Sections []string  // Any of them
+	Tags     []string  // All of them
+	From     time.Time // Captured at or after From
+	To       time.Time // Captured before To
+}
+
+func (f ArticleFilter) query() bson.M {
+	q := bson.M{}
+
+	if len(f.Sections) > 0 {
+		q["section"] = bson.M{"$in": f.Sections}
+	}
+
+	if len(f.Tags) > 0 {
+		q["tags"] = bson.M{"$all": f.Tags}
+	}
+
+	captured := bson.M{}
+	if !f.From.IsZero() {
+		captured["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		captured["$lt"] = f.To
+	}
+	if len(captured) > 0 {
+		q["captured_at"] = captured
+	}
+
+	return q
+}
+
+// EachArticle calls fn for every article selected by f, in capture order,
+// without loading them all in memory. It stops at the first error of fn.
+func (adb *ArticleDB) EachArticle(ctx context.Context, f ArticleFilter, fn func(Article) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "captured_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	c, err := adb.collection.Find(ctx, f.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer c.Close(ctx)
+
+	for c.Next(ctx) {
+		var a Article
+		err = c.Decode(&a)
+		if err != nil {
+			return err
+		}
+
+		err = fn(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.Err()
+}
+
+// UpsertByURL stores a, replacing the article with the same URL if there is
+// one. The ID of a is ignored, so that articles can be moved between stores.
+// inserted is false if an article has been replaced.
+func (adb *ArticleDB) UpsertByURL(ctx context.Context, a Article) (inserted bool, err error) {
+	a.ID = primitive.NilObjectID
+	if a.CapturedAt.IsZero() {
+		a.CapturedAt = time.Now().UTC()
+	}
+	a.TextHash = HashText(a.Text)
+	if a.Version == 0 {
+		a.Version = 1
+	}
+
+	res, err := adb.collection.ReplaceOne(ctx, bson.M{"url": a.URL}, a, options.Replace().SetUpsert(true))
+	if err != nil {
+		return false, err
+	}
+
+	return res.UpsertedCount > 0, nil
+}
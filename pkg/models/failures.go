@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// FailedArticle is an article listed by a source but not stored, because
+// its page could not be read or the article could not be stored. It is
+// retried at NextRetry, or kept without NextRetry once given up on, so that
+// the failures can be looked into.
+type FailedArticle struct {
+	URL           string     `bson:"_id" json:"url"`
+	Source        string     `bson:"source" json:"source"`
+	Section       string     `bson:"section,omitempty" json:"section"`
+	Title         string     `bson:"title,omitempty" json:"title"`
+	PublishedDate string     `bson:"date_created,omitempty" json:"published_date"`
+	Error         string     `bson:"error" json:"error"` // Of the last attempt
+	Attempts      int        `bson:"attempts" json:"attempts"`
+	FirstFailure  time.Time  `bson:"first_failure" json:"first_failure"`
+	LastFailure   time.Time  `bson:"last_failure" json:"last_failure"`
+	NextRetry     *time.Time `bson:"next_retry,omitempty" json:"next_retry,omitempty"`
+}
+
+// Article returns the article as listed by its source, without its text.
+func (f *FailedArticle) Article() Article {
+	return Article{
+		URL:           f.URL,
+		Source:        f.Source,
+		Section:       f.Section,
+		Title:         f.Title,
+		PublishedDate: f.PublishedDate,
+	}
+}
+
+// FailedArticle returns the failure of the article at url, or
+// mongo.ErrNoDocuments if it has not failed.
+func (adb *ArticleDB) FailedArticle(ctx context.Context, url string) (FailedArticle, error) {
+	var f FailedArticle
+	err := adb.failures.FindOne(ctx, bson.M{"_id": url}).Decode(&f)
+	return f, err
+}
+
+// SaveFailure stores f, replacing the previous failure of the article.
+func (adb *ArticleDB) SaveFailure(ctx context.Context, f FailedArticle) error {
+	_, err := adb.failures.ReplaceOne(ctx, bson.M{"_id": f.URL}, f, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeleteFailure forgets the failure of the article at url, once it has been
+// stored. It is not an error if it has not failed.
+func (adb *ArticleDB) DeleteFailure(ctx context.Context, url string) error {
+	_, err := adb.failures.DeleteOne(ctx, bson.M{"_id": url})
+	return err
+}
+
+// DueFailures returns the failed articles of the source to retry at now,
+// oldest retry first.
+func (adb *ArticleDB) DueFailures(ctx context.Context, source string, now time.Time) ([]FailedArticle, error) {
+	filter := bson.M{"source": source, "next_retry": bson.M{"$lte": now}}
+	return adb.findFailures(ctx, filter, options.Find().SetSort(bson.M{"next_retry": 1}))
+}
+
+// Failures returns the last failed articles, of source if it is not empty,
+// most recent failure first.
+func (adb *ArticleDB) Failures(ctx context.Context, source string, limit int) ([]FailedArticle, error) {
+	filter := bson.M{}
+	if source != "" {
+		filter["source"] = source
+	}
+
+	opts := options.Find().SetSort(bson.M{"last_failure": -1}).SetLimit(int64(limit))
+	return adb.findFailures(ctx, filter, opts)
+}
+
+func (adb *ArticleDB) findFailures(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]FailedArticle, error) {
+	c, err := adb.failures.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]FailedArticle, 0)
+	err = c.All(ctx, &failures)
+	return failures, err
+}
+
+// CleanFailures deletes the failures given up on which last failed before
+// the given time, and returns how many were deleted.
+func (adb *ArticleDB) CleanFailures(ctx context.Context, before time.Time) (int64, error) {
+	filter := bson.M{"next_retry": bson.M{"$exists": false}, "last_failure": bson.M{"$lt": before}}
+	res, err := adb.failures.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// SourceMetrics measure a capture of a source, to notice when its pages can
+// no longer be read, usually because their markup has changed.
+type SourceMetrics struct {
+	Found          int     `bson:"found" json:"found"`                     // Articles listed by the source
+	Fetched        int     `bson:"fetched" json:"fetched"`                 // Article pages fetched, the others were already stored
+	Extracted      int     `bson:"extracted" json:"extracted"`             // Fetched pages with text
+	ExtractionRate float64 `bson:"extraction_rate" json:"extraction_rate"` // Extracted / Fetched, 0 if nothing was fetched
+	AverageLength  float64 `bson:"average_length" json:"average_length"`   // Of the extracted texts, in bytes
+}
+
+// SourceAlert tells that a metric of a capture is below its baseline.
+type SourceAlert struct {
+	Metric   string  `bson:"metric" json:"metric"` // "found", "extraction_rate" or "average_length"
+	Value    float64 `bson:"value" json:"value"`
+	Baseline float64 `bson:"baseline" json:"baseline"`
+}
+
+// SourceRun is the health of a source during one capture.
+type SourceRun struct {
+	Source        string    `bson:"source" json:"source"`
+	Time          time.Time `bson:"time" json:"time"`
+	SourceMetrics `bson:",inline"`
+	Error         string `bson:"error,omitempty" json:"error,omitempty"` // Why the source could not be read
+
+	// Median of the previous runs, nil until there are enough of them.
+	Baseline *SourceMetrics `bson:"baseline,omitempty" json:"baseline,omitempty"`
+	Alerts   []SourceAlert  `bson:"alerts,omitempty" json:"alerts,omitempty"`
+}
+
+// Only the last runs of every source are kept.
+const maxSourceRuns = 200
+
+// InsertSourceRun stores run, and deletes the oldest runs of its source.
+func (adb *ArticleDB) InsertSourceRun(ctx context.Context, run SourceRun) error {
+	_, err := adb.sourceRuns.InsertOne(ctx, run)
+	if err != nil {
+		return err
+	}
+
+	var oldest SourceRun
+	opts := options.FindOne().SetSort(bson.M{"time": -1}).SetSkip(maxSourceRuns - 1)
+	err = adb.sourceRuns.FindOne(ctx, bson.M{"source": run.Source}, opts).Decode(&oldest)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = adb.sourceRuns.DeleteMany(ctx, bson.M{"source": run.Source, "time": bson.M{"$lt": oldest.Time}})
+	return err
+}
+
+// SourceRuns returns the last runs of the source, newest first.
+func (adb *ArticleDB) SourceRuns(ctx context.Context, source string, limit int) ([]SourceRun, error) {
+	opts := options.Find().SetSort(bson.M{"time": -1}).SetLimit(int64(limit))
+	c, err := adb.sourceRuns.Find(ctx, bson.M{"source": source}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]SourceRun, 0)
+	err = c.All(ctx, &runs)
+	return runs, err
+}
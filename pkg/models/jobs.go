@@ -0,0 +1,92 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Statuses of a JobRun.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled" // The server shut down during the run
+	JobSkipped   = "skipped"   // The previous run of the job was still in progress
+)
+
+// JobRun is one run of a job of the scheduler package. It is inserted when
+// the run starts and updated when it ends.
+type JobRun struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Job     string             `bson:"job" json:"job"`
+	Trigger string             `bson:"trigger" json:"trigger"` // "schedule" or "manual"
+	Status  string             `bson:"status" json:"status"`
+	Start   time.Time          `bson:"start" json:"start"`
+	End     *time.Time         `bson:"end,omitempty" json:"end,omitempty"`
+
+	// Filled by capture jobs
+	Found   int      `bson:"found" json:"found"`                         // Articles returned by the source
+	New     int      `bson:"new" json:"new"`                             // Articles stored, the others were already stored
+	Failed  int      `bson:"failed" json:"failed"`                       // Articles that could not be stored or updated
+	Skipped int      `bson:"skipped,omitempty" json:"skipped,omitempty"` // Articles whose page robots.txt disallows
+	Errors  []string `bson:"errors,omitempty" json:"errors,omitempty"`
+
+	// Filled by admin jobs
+	Updated int `bson:"updated,omitempty" json:"updated,omitempty"` // Articles re-summarised or re-tagged
+	Deleted int `bson:"deleted,omitempty" json:"deleted,omitempty"` // Articles removed by the retention rules, archived first if configured
+}
+
+// InsertJobRun stores run and sets its ID.
+func (adb *ArticleDB) InsertJobRun(ctx context.Context, run *JobRun) error {
+	run.ID = primitive.NewObjectID()
+
+	_, err := adb.jobs.InsertOne(ctx, run)
+	return err
+}
+
+// UpdateJobRun replaces the stored run having the ID of run.
+func (adb *ArticleDB) UpdateJobRun(ctx context.Context, run *JobRun) error {
+	_, err := adb.jobs.ReplaceOne(ctx, bson.M{"_id": run.ID}, run)
+	return err
+}
+
+// JobRunByID returns the run with the given ID, or mongo.ErrNoDocuments.
+func (adb *ArticleDB) JobRunByID(ctx context.Context, id primitive.ObjectID) (*JobRun, error) {
+	var run JobRun
+	err := adb.jobs.FindOne(ctx, bson.M{"_id": id}).Decode(&run)
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// JobRuns returns the last runs of the given job, or of every job if job is
+// empty, newest first.
+func (adb *ArticleDB) JobRuns(ctx context.Context, job string, limit int) ([]JobRun, error) {
+	filter := bson.M{}
+	if job != "" {
+		filter["job"] = job
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	c, err := adb.jobs.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]JobRun, 0)
+	err = c.All(ctx, &runs)
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
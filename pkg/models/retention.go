@@ -0,0 +1,316 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// RetentionRule limits how long the articles of a source and section are
+// kept: those captured more than MaxAge ago are removed, and so are the
+// oldest ones beyond the MaxCount newest. Zero values do not limit.
+//
+// Every article follows the first rule matching its source and section.
+type RetentionRule struct {
+	Source  string // Empty for every source
+	Section string // Empty for every section
+
+	MaxAge   time.Duration
+	MaxCount int // Not counting the kept articles
+
+	KeepTags       []string // Articles with any of these tags are never removed
+	KeepBookmarked bool
+}
+
+// Name identifies the rule in reports, such as "nytimes/*".
+func (r RetentionRule) Name() string {
+	source, section := r.Source, r.Section
+	if source == "" {
+		source = "*"
+	}
+	if section == "" {
+		section = "*"
+	}
+
+	return source + "/" + section
+}
+
+// Covers reports whether every article matching o also matches r, in which
+// case o is never used after r.
+func (r RetentionRule) Covers(o RetentionRule) bool {
+	return (r.Source == "" || r.Source == o.Source) && (r.Section == "" || r.Section == o.Section)
+}
+
+func (r RetentionRule) match() bson.M {
+	m := bson.M{}
+	if r.Source != "" {
+		m["source"] = r.Source
+	}
+	if r.Section != "" {
+		m["section"] = r.Section
+	}
+
+	return m
+}
+
+// RetentionReport tells what ApplyRetention removed, or would remove in a
+// dry run.
+type RetentionReport struct {
+	DryRun   bool         `json:"dry_run"`
+	Archived bool         `json:"archived"` // The removed articles were archived rather than deleted
+	Removed  int          `json:"removed"`
+	Rules    []RuleReport `json:"rules"`
+}
+
+type RuleReport struct {
+	Rule    string `json:"rule"`
+	Matched int    `json:"matched"` // Articles following the rule
+	Kept    int    `json:"kept"`    // By KeepTags or KeepBookmarked, whatever their age
+	Expired int    `json:"expired"` // Older than MaxAge
+	Removed int    `json:"removed"` // The expired articles and those beyond MaxCount
+}
+
+// Archiver keeps the articles removed by ApplyRetention. Archive is called
+// before the articles are deleted, so they are deleted only once archived.
+// Their previous versions are not archived.
+type Archiver interface {
+	Archive(ctx context.Context, articles []Article) error
+	Close() error
+}
+
+// Articles are archived and deleted in batches of this size.
+const retentionBatch = 500
+
+// ApplyRetention removes the articles that the rules no longer keep. If
+// archive is not nil, they are archived first. Nothing is removed in a dry
+// run, but the report counts what would be.
+func (adb *ArticleDB) ApplyRetention(ctx context.Context, rules []RetentionRule, archive Archiver, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun, Archived: archive != nil}
+	now := time.Now().UTC()
+
+	for i, rule := range rules {
+		rr, err := adb.applyRule(ctx, rule, rules[:i], now, archive, dryRun)
+		report.Rules = append(report.Rules, rr)
+		report.Removed += rr.Removed
+		if err != nil {
+			return report, fmt.Errorf("retention rule %s: %w", rule.Name(), err)
+		}
+	}
+
+	return report, nil
+}
+
+func (adb *ArticleDB) applyRule(ctx context.Context, r RetentionRule, previous []RetentionRule, now time.Time, archive Archiver, dryRun bool) (RuleReport, error) {
+	rr := RuleReport{Rule: r.Name()}
+
+	// The articles matched by a previous rule follow that rule instead
+	governed := bson.A{r.match()}
+	for _, p := range previous {
+		governed = append(governed, bson.M{"$nor": bson.A{p.match()}})
+	}
+
+	n, err := adb.collection.CountDocuments(ctx, bson.M{"$and": governed})
+	if err != nil {
+		return rr, err
+	}
+	rr.Matched = int(n)
+
+	removable := governed
+	if len(r.KeepTags) > 0 {
+		removable = append(removable, bson.M{"tags": bson.M{"$nin": r.KeepTags}})
+	}
+	if r.KeepBookmarked {
+		removable = append(removable, bson.M{"bookmarked": bson.M{"$ne": true}})
+	}
+
+	n, err = adb.collection.CountDocuments(ctx, bson.M{"$and": removable})
+	if err != nil {
+		return rr, err
+	}
+	rr.Kept = rr.Matched - int(n)
+
+	var limits bson.A
+	if r.MaxAge > 0 {
+		expired := bson.M{"captured_at": bson.M{"$lt": now.Add(-r.MaxAge)}}
+		limits = append(limits, expired)
+
+		n, err = adb.collection.CountDocuments(ctx, bson.M{"$and": append(removable[:len(removable):len(removable)], expired)})
+		if err != nil {
+			return rr, err
+		}
+		rr.Expired = int(n)
+	}
+	if r.MaxCount > 0 {
+		ids, err := adb.excess(ctx, bson.M{"$and": removable}, r.MaxCount)
+		if err != nil {
+			return rr, err
+		}
+		if len(ids) > 0 {
+			limits = append(limits, bson.M{"_id": bson.M{"$in": ids}})
+		}
+	}
+	if len(limits) == 0 {
+		return rr, nil
+	}
+
+	filter := bson.M{"$and": append(removable, bson.M{"$or": limits})}
+
+	if dryRun {
+		n, err = adb.collection.CountDocuments(ctx, filter)
+		rr.Removed = int(n)
+		return rr, err
+	}
+
+	rr.Removed, err = adb.removeMany(ctx, filter, archive)
+	return rr, err
+}
+
+// excess returns the IDs of the articles selected by filter beyond the
+// keep newest ones.
+func (adb *ArticleDB) excess(ctx context.Context, filter bson.M, keep int) ([]primitive.ObjectID, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "captured_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(keep)).
+		SetProjection(bson.M{"_id": 1})
+
+	c, err := adb.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close(ctx)
+
+	var ids []primitive.ObjectID
+	for c.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err = c.Decode(&doc)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+
+	return ids, c.Err()
+}
+
+// removeMany deletes the articles selected by filter and their previous
+// versions, one batch at a time, archiving them first if archive is not nil.
+// It returns how many were deleted.
+func (adb *ArticleDB) removeMany(ctx context.Context, filter bson.M, archive Archiver) (int, error) {
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if archive == nil {
+		opts.SetProjection(bson.M{"_id": 1})
+	}
+
+	c, err := adb.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close(ctx)
+
+	deleted := 0
+	flush := func(batch []Article) error {
+		if archive != nil {
+			err := archive.Archive(ctx, batch)
+			if err != nil {
+				return fmt.Errorf("cannot archive: %w", err)
+			}
+		}
+
+		ids := make([]primitive.ObjectID, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].ID
+		}
+
+		err := adb.deleteVersionsOf(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		res, err := adb.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		deleted += int(res.DeletedCount)
+		return nil
+	}
+
+	var batch []Article
+	for c.Next(ctx) {
+		var a Article
+		err = c.Decode(&a)
+		if err != nil {
+			return deleted, err
+		}
+
+		batch = append(batch, a)
+		if len(batch) == retentionBatch {
+			err = flush(batch)
+			if err != nil {
+				return deleted, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = c.Err(); err != nil {
+		return deleted, err
+	}
+
+	if len(batch) > 0 {
+		err = flush(batch)
+	}
+	return deleted, err
+}
+
+type collectionArchiver struct {
+	c *mongo.Collection
+}
+
+// CollectionArchiver archives the articles in the named collection of the
+// database, keeping their IDs.
+func (adb *ArticleDB) CollectionArchiver(name string) Archiver {
+	return collectionArchiver{adb.database.Collection(name)}
+}
+
+func (ca collectionArchiver) Archive(ctx context.Context, articles []Article) error {
+	// Replacing by ID, an article archived by a clean up that then failed to
+	// delete it is not archived twice.
+	writes := make([]mongo.WriteModel, len(articles))
+	for i := range articles {
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": articles[i].ID}).
+			SetReplacement(articles[i]).
+			SetUpsert(true)
+	}
+
+	_, err := ca.c.BulkWrite(ctx, writes)
+	return err
+}
+
+func (ca collectionArchiver) Close() error {
+	return nil
+}
+
+// CountArticles returns the number of stored articles.
+func (adb *ArticleDB) CountArticles(ctx context.Context) (int64, error) {
+	return adb.collection.CountDocuments(ctx, bson.M{})
+}
+
+// SetBookmarked bookmarks the article with the given ID, or removes its
+// bookmark. It returns mongo.ErrNoDocuments if there is no such article.
+func (adb *ArticleDB) SetBookmarked(ctx context.Context, id primitive.ObjectID, bookmarked bool) error {
+	res, err := adb.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"bookmarked": bookmarked}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"time"
+)
+
+// Page is a web page as fetched by a source.
+type Page struct {
+	URL       string // After redirects
+	Status    int
+	Header    http.Header
+	Body      []byte // As sent by the server
+	FetchedAt time.Time
+
+	Charset string // Of Body, such as "utf-8" or "windows-1252"
+	HTML    string // Body transcoded to UTF-8
+}
+
+// Snapshot records the page an article was extracted from. The HTML itself
+// is stored compressed in the snapshot_blobs collection under its SHA-256,
+// so that identical pages are only stored once.
+type Snapshot struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ArticleID      primitive.ObjectID `bson:"article_id" json:"article_id"`
+	URL            string             `bson:"url" json:"url"`
+	Status         int                `bson:"status" json:"status"`
+	Header         http.Header        `bson:"header" json:"header"`
+	FetchedAt      time.Time          `bson:"fetched_at" json:"fetched_at"`
+	Hash           string             `bson:"hash" json:"sha256"` // Of the uncompressed HTML
+	Charset        string             `bson:"charset,omitempty" json:"charset,omitempty"`
+	Size           int                `bson:"size" json:"size"`
+	CompressedSize int                `bson:"compressed_size" json:"compressed_size"`
+}
+
+type snapshotBlob struct {
+	Hash string `bson:"_id"`
+	Data []byte `bson:"data"` // gzip
+}
+
+// Documents cannot be larger than 16MB.
+const maxSnapshotSize = 15 << 20
+
+// SaveSnapshot stores page as the snapshot of the article with the given ID.
+func (adb *ArticleDB) SaveSnapshot(ctx context.Context, articleID primitive.ObjectID, page *Page) (*Snapshot, error) {
+	sum := sha256.Sum256(page.Body)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(page.Body)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if buf.Len() > maxSnapshotSize {
+		return nil, fmt.Errorf("the snapshot of %s is too large (%d bytes compressed)", page.URL, buf.Len())
+	}
+
+	s := &Snapshot{
+		ArticleID:      articleID,
+		URL:            page.URL,
+		Status:         page.Status,
+		Header:         page.Header,
+		FetchedAt:      page.FetchedAt,
+		Hash:           hex.EncodeToString(sum[:]),
+		Charset:        page.Charset,
+		Size:           len(page.Body),
+		CompressedSize: buf.Len(),
+	}
+
+	// The snapshot is inserted before its blob, so that CleanSnapshots never
+	// deletes a blob about to be used.
+	res, err := adb.snapshots.InsertOne(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	s.ID = res.InsertedID.(primitive.ObjectID)
+
+	_, err = adb.blobs.UpdateOne(ctx,
+		bson.M{"_id": s.Hash},
+		bson.M{"$setOnInsert": snapshotBlob{Hash: s.Hash, Data: buf.Bytes()}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// LatestSnapshot returns the last snapshot of the article with the given ID
+// and its gzip compressed HTML, or mongo.ErrNoDocuments if it has none.
+func (adb *ArticleDB) LatestSnapshot(ctx context.Context, articleID primitive.ObjectID) (*Snapshot, []byte, error) {
+	var s Snapshot
+	opts := options.FindOne().SetSort(bson.M{"fetched_at": -1})
+	err := adb.snapshots.FindOne(ctx, bson.M{"article_id": articleID}, opts).Decode(&s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var blob snapshotBlob
+	err = adb.blobs.FindOne(ctx, bson.M{"_id": s.Hash}).Decode(&blob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &s, blob.Data, nil
+}
+
+// CleanSnapshots deletes the snapshots fetched more than maxAge ago, and the
+// HTML no longer used by any snapshot. It returns the number of snapshots
+// deleted.
+func (adb *ArticleDB) CleanSnapshots(ctx context.Context, maxAge time.Duration) (int, error) {
+	res, err := adb.snapshots.DeleteMany(ctx, bson.M{"fetched_at": bson.M{"$lt": time.Now().UTC().Add(-maxAge)}})
+	if err != nil {
+		return 0, err
+	}
+
+	hashes, err := adb.snapshots.Distinct(ctx, "hash", bson.M{})
+	if err != nil {
+		return int(res.DeletedCount), err
+	}
+
+	if hashes == nil {
+		hashes = bson.A{}
+	}
+
+	_, err = adb.blobs.DeleteMany(ctx, bson.M{"_id": bson.M{"$nin": hashes}})
+	return int(res.DeletedCount), err
+}
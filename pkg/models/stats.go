@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// Stat is the number of articles carrying a tag (or belonging to a section)
+// in the current window and in the window just before it.
+type Stat struct {
+	Name          string    `bson:"_id" json:"name"`
+	Count         int       `bson:"count" json:"count"`
+	PreviousCount int       `bson:"previous_count" json:"previous_count"`
+	FirstSeen     time.Time `bson:"first_seen" json:"first_seen"`
+	LastSeen      time.Time `bson:"last_seen" json:"last_seen"`
+
+	// (Count - PreviousCount) / (PreviousCount + 1). Positive when the tag is
+	// more frequent than in the previous window, and large for a new tag that
+	// suddenly appears in many articles.
+	Trend float64 `bson:"trend" json:"trend"`
+}
+
+// TagStats computes a Stat for every tag seen in [end - 2*window, end).
+func (adb *ArticleDB) TagStats(ctx context.Context, end time.Time, window time.Duration) ([]Stat, error) {
+	return adb.stats(ctx, "tags", true, end, window)
+}
+
+// SectionStats computes a Stat for every section seen in [end - 2*window, end).
+func (adb *ArticleDB) SectionStats(ctx context.Context, end time.Time, window time.Duration) ([]Stat, error) {
+	return adb.stats(ctx, "section", false, end, window)
+}
+
+// The whole collection goes through the $group stage (rather than only the
+// two windows) so that FirstSeen is the first time the value was ever seen.
+func (adb *ArticleDB) stats(ctx context.Context, field string, unwind bool, end time.Time, window time.Duration) ([]Stat, error) {
+	start := end.Add(-window)
+	previousStart := start.Add(-window)
+
+	inRange := func(from, to time.Time) bson.M {
+		return bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{
+				bson.M{"$gte": bson.A{"$captured_at", from}},
+				bson.M{"$lt": bson.A{"$captured_at", to}},
+			}},
+			1,
+			0,
+		}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{field: bson.M{"$exists": true, "$ne": ""}}}},
+	}
+
+	if unwind {
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$" + field}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":            "$" + field,
+			"count":          bson.M{"$sum": inRange(start, end)},
+			"previous_count": bson.M{"$sum": inRange(previousStart, start)},
+			"first_seen":     bson.M{"$min": "$captured_at"},
+			"last_seen":      bson.M{"$max": "$captured_at"},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"count": bson.M{"$gt": 0}},
+			bson.M{"previous_count": bson.M{"$gt": 0}},
+		}}}},
+		bson.D{{Key: "$addFields", Value: bson.M{
+			"trend": bson.M{"$divide": bson.A{
+				bson.M{"$subtract": bson.A{"$count", "$previous_count"}},
+				bson.M{"$add": bson.A{"$previous_count", 1}},
+			}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "trend", Value: -1}, {Key: "_id", Value: 1}}}},
+	)
+
+	c, err := adb.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]Stat, 0)
+	err = c.All(ctx, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// EntityStat summarises the articles mentioning an entity.
+type EntityStat struct {
+	Text     string    `bson:"text" json:"text"`
+	Type     string    `bson:"type" json:"type"`
+	Articles int       `bson:"articles" json:"articles"` // Number of articles mentioning the entity
+	Mentions int       `bson:"mentions" json:"mentions"` // Number of mentions in all articles
+	Salience float64   `bson:"salience" json:"salience"` // Mean salience in those articles
+	LastSeen time.Time `bson:"last_seen" json:"last_seen"`
+}
+
+// EntityStats returns the entities of the given types (all of them if types
+// is empty), the most widely mentioned first.
+func (adb *ArticleDB) EntityStats(ctx context.Context, types []string, limit int) ([]EntityStat, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$unwind", Value: "$entities"}},
+	}
+
+	if len(types) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"entities.type": bson.M{"$in": types}}}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":       bson.M{"text": "$entities.text", "type": "$entities.type"},
+			"articles":  bson.M{"$sum": 1},
+			"mentions":  bson.M{"$sum": "$entities.count"},
+			"salience":  bson.M{"$avg": "$entities.salience"},
+			"last_seen": bson.M{"$max": "$captured_at"},
+		}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":       0,
+			"text":      "$_id.text",
+			"type":      "$_id.type",
+			"articles":  1,
+			"mentions":  1,
+			"salience":  1,
+			"last_seen": 1,
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "articles", Value: -1}, {Key: "mentions", Value: -1}, {Key: "text", Value: 1}}}},
+	)
+
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	c, err := adb.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]EntityStat, 0)
+	err = c.All(ctx, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
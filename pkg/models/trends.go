@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// HourlyCount is the number of articles carrying Tag captured during the hour
+// starting at Hour (UTC).
+type HourlyCount struct {
+	Tag   string    `bson:"tag"`
+	Hour  time.Time `bson:"hour"`
+	Count int       `bson:"count"`
+	URLs  []string  `bson:"urls"`
+}
+
+// TrendEvent records a tag whose frequency in one bucket of time, starting at
+// Hour, was well above its baseline. It is created by the trending package.
+type TrendEvent struct {
+	Tag         string    `bson:"tag" json:"tag"`
+	Hour        time.Time `bson:"hour" json:"hour"`
+	Count       int       `bson:"count" json:"count"`
+	Mean        float64   `bson:"mean" json:"baseline_mean"`
+	StdDev      float64   `bson:"std_dev" json:"baseline_std_dev"`
+	ZScore      float64   `bson:"z_score" json:"z_score"`
+	ArticleURLs []string  `bson:"article_urls" json:"article_urls"`
+	DetectedAt  time.Time `bson:"detected_at" json:"detected_at"`
+}
+
+// TagHourlyCounts groups the articles captured since the given time by tag
+// and by hour.
+func (adb *ArticleDB) TagHourlyCounts(ctx context.Context, since time.Time) ([]HourlyCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"captured_at": bson.M{"$gte": since}}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"tag": "$tags",
+				"hour": bson.M{"$dateFromParts": bson.M{
+					"year":  bson.M{"$year": "$captured_at"},
+					"month": bson.M{"$month": "$captured_at"},
+					"day":   bson.M{"$dayOfMonth": "$captured_at"},
+					"hour":  bson.M{"$hour": "$captured_at"},
+				}},
+			},
+			"count": bson.M{"$sum": 1},
+			"urls":  bson.M{"$addToSet": "$url"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":   0,
+			"tag":   "$_id.tag",
+			"hour":  "$_id.hour",
+			"count": 1,
+			"urls":  1,
+		}}},
+	}
+
+	c, err := adb.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []HourlyCount
+	err = c.All(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// SaveTagCounts stores counts, so that the baseline of the trends outlives
+// the articles deleted by the retention rules. The count of an hour only
+// grows: once its articles are deleted, it is not counted again as 0.
+func (adb *ArticleDB) SaveTagCounts(ctx context.Context, counts []HourlyCount) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(counts))
+	for _, c := range counts {
+		update := bson.M{
+			"$max":      bson.M{"count": c.Count},
+			"$addToSet": bson.M{"urls": bson.M{"$each": c.URLs}},
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"tag": c.Tag, "hour": c.Hour}).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+
+	_, err := adb.tagCounts.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// TagCounts returns the stored counts of the hours since the given time.
+func (adb *ArticleDB) TagCounts(ctx context.Context, since time.Time) ([]HourlyCount, error) {
+	c, err := adb.tagCounts.Find(ctx, bson.M{"hour": bson.M{"$gte": since}})
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []HourlyCount
+	err = c.All(ctx, &counts)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// CleanTagCounts deletes the counts of the hours before the given time,
+// which no baseline needs anymore.
+func (adb *ArticleDB) CleanTagCounts(ctx context.Context, before time.Time) (int64, error) {
+	res, err := adb.tagCounts.DeleteMany(ctx, bson.M{"hour": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+// UpsertTrendEvent stores e, replacing any previous event for the same tag
+// and bucket, so that running the detection twice over the same hours is harmless.
+func (adb *ArticleDB) UpsertTrendEvent(ctx context.Context, e TrendEvent) error {
+	filter := bson.M{"tag": e.Tag, "hour": e.Hour}
+
+	_, err := adb.trends.ReplaceOne(ctx, filter, e, options.Replace().SetUpsert(true))
+	return err
+}
+
+// TrendEvents returns the events of the buckets since the given time, newest first.
+func (adb *ArticleDB) TrendEvents(ctx context.Context, since time.Time, limit int) ([]TrendEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "hour", Value: -1}, {Key: "z_score", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	c, err := adb.trends.Find(ctx, bson.M{"hour": bson.M{"$gte": since}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]TrendEvent, 0)
+	err = c.All(ctx, &events)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ByURLs returns the stored articles among urls. Articles deleted since are
+// silently missing from the result.
+func (adb *ArticleDB) ByURLs(ctx context.Context, urls []string) ([]Article, error) {
+	c, err := adb.collection.Find(ctx, bson.M{"url": bson.M{"$in": urls}})
+	if err != nil {
+		return nil, err
+	}
+
+	articles := make([]Article, 0, len(urls))
+	err = c.All(ctx, &articles)
+	if err != nil {
+		return nil, err
+	}
+
+	return articles, nil
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// ArticleVersion is a previous version of an article, replaced when the page
+// of the article was edited after its capture.
+type ArticleVersion struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	ArticleID      primitive.ObjectID `bson:"article_id" json:"article_id"`
+	Version        int                `bson:"version" json:"version"`
+	Title          string             `bson:"title" json:"title"`
+	Text           string             `bson:"text" json:"-"`
+	TextHash       string             `bson:"text_hash" json:"text_hash"`
+	SummarisedText string             `bson:"summarised_text" json:"summarised_text"`
+	Tags           []string           `bson:"tags" json:"tags"`
+	FetchedAt      time.Time          `bson:"fetched_at" json:"fetched_at"`   // When this version was captured
+	ReplacedAt     time.Time          `bson:"replaced_at" json:"replaced_at"` // When the next version was
+}
+
+// HashText returns the hash stored in Article.TextHash.
+func HashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// VersionOf returns the version of a, as stored in ArticleVersion. The
+// articles stored before versions were recorded are version 1.
+func VersionOf(a *Article) ArticleVersion {
+	v := ArticleVersion{
+		ArticleID:      a.ID,
+		Version:        a.Version,
+		Title:          a.Title,
+		Text:           a.Text,
+		TextHash:       a.TextHash,
+		SummarisedText: a.SummarisedText,
+		Tags:           a.Tags,
+		FetchedAt:      a.CapturedAt,
+	}
+	if v.Version == 0 {
+		v.Version = 1
+	}
+	if v.TextHash == "" {
+		v.TextHash = HashText(a.Text)
+	}
+	if a.UpdatedAt != nil {
+		v.FetchedAt = *a.UpdatedAt
+	}
+
+	return v
+}
+
+// RecentArticles returns the articles of the source captured after since.
+func (adb *ArticleDB) RecentArticles(ctx context.Context, source string, since time.Time) ([]Article, error) {
+	filter := bson.M{"source": source, "captured_at": bson.M{"$gte": since}}
+
+	c, err := adb.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"captured_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []Article
+	err = c.All(ctx, &articles)
+	return articles, err
+}
+
+// UpdateVersion stores the current version of old as an ArticleVersion and
+// replaces it by the text, summary and tags of updated, as a new version.
+func (adb *ArticleDB) UpdateVersion(ctx context.Context, old *Article, updated *Article) error {
+	now := time.Now().UTC()
+
+	v := VersionOf(old)
+	v.ReplacedAt = now
+	_, err := adb.versions.InsertOne(ctx, v)
+	if err != nil {
+		return err
+	}
+
+	updated.Version = v.Version + 1
+	updated.UpdatedAt = &now
+	updated.TextHash = HashText(updated.Text)
+	if updated.Page != nil {
+		updated.Charset = updated.Page.Charset
+	}
+
+	_, err = adb.collection.UpdateOne(ctx, bson.M{"_id": old.ID}, bson.M{"$set": bson.M{
+		"title":             updated.Title,
+		"text":              updated.Text,
+		"text_hash":         updated.TextHash,
+		"summarised_text":   updated.SummarisedText,
+		"tags":              updated.Tags,
+		"entities":          updated.Entities,
+		"algorithm_version": updated.AlgorithmVersion,
+		"charset":           updated.Charset,
+		"version":           updated.Version,
+		"updated_at":        now,
+	}})
+	return err
+}
+
+// ArticleVersions returns the previous versions of the article with the
+// given ID, oldest first.
+func (adb *ArticleDB) ArticleVersions(ctx context.Context, articleID primitive.ObjectID) ([]ArticleVersion, error) {
+	c, err := adb.versions.Find(ctx, bson.M{"article_id": articleID}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []ArticleVersion
+	err = c.All(ctx, &versions)
+	return versions, err
+}
+
+func (adb *ArticleDB) deleteVersionsOf(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := adb.versions.DeleteMany(ctx, bson.M{"article_id": bson.M{"$in": ids}})
+	return err
+}
@@ -1,22 +1,21 @@
 package nytimes
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
 	"github.com/vitsensei/infogrid/pkg/models"
 	"golang.org/x/net/html"
-	"io/ioutil"
-	"net/http"
-	"os"
 	"strings"
-	"sync"
+	"time"
 )
 
-var (
-	apiKey             = os.Getenv("NYTIMES_KEY")
-	partialTopStoryURL = "https://api.nytimes.com/svc/topstories/v2/home.json?api-key="
-	wg                 sync.WaitGroup
-)
+// Name is recorded as the source of the articles.
+const Name = "nytimes"
+
+var partialTopStoryURL = "https://api.nytimes.com/svc/topstories/v2/home.json?api-key="
 
 // The json of the response from NYTimes API
 type TopStories struct {
@@ -26,35 +25,55 @@ type TopStories struct {
 // The API for other package to interact with
 type API struct {
 	url             string
+	apiKey          string
 	allowedSections []string
-	TopStories      TopStories `json:"body"`
+	fetcher         *fetcher.Fetcher
+}
+
+// Name returns the name of the source, recorded in its articles.
+func (a *API) Name() string {
+	return Name
 }
 
-func NewAPI() *API {
+// NewAPI returns an API for the top stories of the given sections, or of
+// business, politics, technology, us and world if sections is empty.
+func NewAPI(apiKey string, sections []string) *API {
+	if len(sections) == 0 {
+		sections = []string{"business", "politics", "technology", "us", "world"}
+	}
+
 	return &API{
-		allowedSections: []string{"business", "politics", "technology", "us", "world"},
+		apiKey:          apiKey,
+		allowedSections: sections,
 	}
 }
 
-// Used in controller/article to filter out the "non-news" sections
-func (a *API) FilterBySections() {
+// Used in Fetch to filter out the "non-news" sections
+func (a *API) filterBySections(articles []models.Article) []models.Article {
 	var filteredArticles []models.Article
 
-	for _, article := range a.TopStories.Articles {
+	for _, article := range articles {
 		for _, allowedSection := range a.allowedSections {
 			if article.Section == allowedSection {
+				article.Source = Name
 				filteredArticles = append(filteredArticles, article)
 				break
 			}
 		}
 	}
 
-	a.TopStories.Articles = filteredArticles
+	return filteredArticles
+}
 
+// SetFetcher makes the API fetch its pages with f, such as a Fetcher
+// replaying fixtures in tests, rather than with the one of the extractor
+// package.
+func (a *API) SetFetcher(f *fetcher.Fetcher) {
+	a.fetcher = f
 }
 
 func (a *API) generateURL() {
-	a.url = partialTopStoryURL + apiKey
+	a.url = partialTopStoryURL + a.apiKey
 }
 
 // Used in ExtractText to detect ArticleBody node
@@ -69,15 +88,26 @@ func isArticleBody(n html.Node) bool {
 }
 
 // Given a URL, the text will be extracted (if exist)
-func ExtractText(url string) (string, error) {
+func ExtractText(ctx context.Context, url string) (string, error) {
+	text, _, err := extractPage(ctx, nil, url)
+	return text, err
+}
+
+// extractPage fetches the page at url with pf, nil for the Fetcher of the
+// extractor package, and extracts its text.
+func extractPage(ctx context.Context, pf *fetcher.Fetcher, url string) (string, *models.Page, error) {
 	var paragraph string
 
-	bodyString, err := extractor.ExtractTextFromURL(url)
+	page, err := extractor.FetchPageWith(ctx, pf, url)
+	if err != nil {
+		return "", nil, err
+	}
+	bodyString := page.HTML
 
 	doc, err := html.Parse(strings.NewReader(bodyString))
 
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	var articleBodyNode *html.Node
@@ -118,75 +148,77 @@ func ExtractText(url string) (string, error) {
 		f(articleBodyNode)
 	}
 
-	return paragraph, nil
+	return paragraph, page, nil
 }
 
-func GenerateArticleText(article *models.Article) {
-	defer wg.Done()
-
-	text, _ := ExtractText(article.URL)
-	if text != "" {
-		article.Text = text
-
-		tags, err := extractor.ExtractTags(text, 3)
-		if err == nil {
-			article.Tags = tags
-		}
-	}
-}
-
-//	Construct the Article list (TopStories struct).
-//	Each Article in the list will only contain the URL, Section, and Title
-//	after this call. These are the value returned from NYTimes API.
-func (a *API) GenerateArticles() error {
+//	Lists the top stories of the allowed sections published since the given
+//	time, with the URL, Section, and Title returned from NYTimes API. Their
+//	text is fetched by FetchArticle.
+func (a *API) Fetch(ctx context.Context, since time.Time) (<-chan models.Article, <-chan error) {
 	if a.url == "" {
 		a.generateURL()
 	}
 
-	resp, err := http.Get(a.url)
+	articles := make(chan models.Article)
+	errs := make(chan error)
 
-	if err != nil {
-		return err
-	}
-	defer func() {
-		err = resp.Body.Close()
+	go func() {
+		defer close(articles)
+		defer close(errs)
+
+		stories, err := a.topStories(ctx)
+		if err != nil {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		for _, article := range a.filterBySections(stories) {
+			if article.PublishedBefore(since) {
+				continue
+			}
+
+			select {
+			case articles <- article:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}()
 
-	bytes, err := ioutil.ReadAll(resp.Body)
+	return articles, errs
+}
+
+// topStories returns the top stories of every section.
+func (a *API) topStories(ctx context.Context) ([]models.Article, error) {
+	page, err := extractor.FetchPageWith(ctx, a.fetcher, a.url)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = json.Unmarshal(bytes, &a.TopStories)
+	var stories TopStories
+	err = json.Unmarshal(page.Body, &stories)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	a.FilterBySections()
+	return stories.Articles, nil
+}
 
-	// Extract text from URL
-	for i := range a.TopStories.Articles {
-		wg.Add(1)
-		go GenerateArticleText(&a.TopStories.Articles[i])
+// FetchArticle fetches the page of article again, to replace its text and
+// page if they have changed.
+func (a *API) FetchArticle(ctx context.Context, article *models.Article) error {
+	text, page, err := extractPage(ctx, a.fetcher, article.URL)
+	if err != nil {
+		return err
 	}
-
-	wg.Wait()
-
-	// Filter out the node that is interactive ~= article.text == ""
-	var articleWithText []models.Article
-	for i := range a.TopStories.Articles {
-		if a.TopStories.Articles[i].Text != "" {
-			articleWithText = append(articleWithText, a.TopStories.Articles[i])
-		}
+	if text == "" {
+		return fmt.Errorf("%w at %s", extractor.ErrNoText, article.URL)
 	}
 
-	a.TopStories.Articles = articleWithText
-
-	return err
-}
-
-// A Get-Set style function to exposes the the articles array
-// through interface
-func (a *API) GetArticles() []models.Article {
-	return a.TopStories.Articles
+	article.Text = text
+	article.Page = page
+	return nil
 }
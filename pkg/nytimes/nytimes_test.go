@@ -0,0 +1,190 @@
+package nytimes
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/replay"
+	"golang.org/x/net/html"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var record = flag.Bool("record", false, "record the fixtures of testdata from nytimes.com, with the API key in NYTIMES_KEY")
+
+// testFetcher returns a Fetcher replaying the fixtures of testdata, or
+// recording them with -record.
+func testFetcher() *fetcher.Fetcher {
+	cfg := fetcher.DefaultConfig()
+	if *record {
+		cfg.Transport = replay.NewRecorder("testdata", nil)
+	} else {
+		cfg.Transport = replay.NewReplayer("testdata")
+		cfg.RatePerHost = 0
+		cfg.Retries = 0
+	}
+
+	return fetcher.New(cfg)
+}
+
+// collect returns the articles listed by Fetch, and the errors sent.
+func collect(api *API, since time.Time) ([]models.Article, []error) {
+	listed, errs := api.Fetch(context.Background(), since)
+
+	var sent []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			sent = append(sent, err)
+		}
+	}()
+
+	var articles []models.Article
+	for article := range listed {
+		articles = append(articles, article)
+	}
+	<-done
+
+	return articles, sent
+}
+
+func TestFetch(t *testing.T) {
+	api := NewAPI(os.Getenv("NYTIMES_KEY"), nil)
+	api.SetFetcher(testFetcher())
+
+	articles, errs := collect(api, time.Time{})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// The sports article is not in the default sections
+	urls := []string{
+		"https://www.nytimes.com/2021/01/20/us/politics/biden-inauguration.html",
+		"https://www.nytimes.com/interactive/2021/us/covid-cases.html",
+		"https://www.nytimes.com/private/2021/01/20/world/members.html",
+	}
+	if len(articles) != len(urls) {
+		t.Fatalf("got %d articles, want %d: %+v", len(articles), len(urls), articles)
+	}
+	for i, url := range urls {
+		if articles[i].URL != url || articles[i].Source != Name || articles[i].Text != "" {
+			t.Errorf("got article %q from %s with text %q, want %q without text", articles[i].URL, articles[i].Source, articles[i].Text, url)
+		}
+	}
+
+	a := articles[0]
+	if a.Title != "Biden Takes the Oath of Office" || a.Section != "us" {
+		t.Errorf("got article %q in %s", a.Title, a.Section)
+	}
+	if a.PublishedDate != "2021-01-20T12:00:00-05:00" {
+		t.Errorf("got published date %q", a.PublishedDate)
+	}
+
+	// The interactive article has no text and the private one is disallowed
+	// by robots.txt
+	err := api.FetchArticle(context.Background(), &articles[1])
+	if !errors.Is(err, extractor.ErrNoText) {
+		t.Errorf("got %v for the interactive article, want no text", err)
+	}
+	err = api.FetchArticle(context.Background(), &articles[2])
+	if !errors.Is(err, fetcher.ErrDisallowed) {
+		t.Errorf("got %v for the private article, want it disallowed", err)
+	}
+
+	// Nothing is kept from the previous fetch
+	again, errs := collect(api, time.Time{})
+	if len(errs) > 0 || len(again) != len(articles) {
+		t.Errorf("got %d articles and %v from the second fetch, want %d", len(again), errs, len(articles))
+	}
+}
+
+func TestFetchSince(t *testing.T) {
+	api := NewAPI(os.Getenv("NYTIMES_KEY"), nil)
+	api.SetFetcher(testFetcher())
+
+	since, err := time.Parse(time.RFC3339, "2021-01-20T10:00:00-05:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles, errs := collect(api, since)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(articles) != 1 || articles[0].URL != "https://www.nytimes.com/2021/01/20/us/politics/biden-inauguration.html" {
+		t.Errorf("got %+v, want the article published after %v", articles, since)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	extractor.SetFetcher(testFetcher())
+	defer extractor.SetFetcher(fetcher.New(fetcher.DefaultConfig()))
+
+	text, err := ExtractText(context.Background(), "https://www.nytimes.com/2021/01/20/us/politics/biden-inauguration.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "Advertisement") || strings.Contains(text, "©") {
+		t.Errorf("text outside the article body extracted: %q", text)
+	}
+
+	// Interactive articles have no article body
+	text, err = ExtractText(context.Background(), "https://www.nytimes.com/interactive/2021/us/covid-cases.html")
+	if err != nil || text != "" {
+		t.Errorf("got %q, %v for an interactive article, want no text", text, err)
+	}
+}
+
+func TestFetchArticle(t *testing.T) {
+	api := NewAPI("", nil)
+	api.SetFetcher(testFetcher())
+
+	article := models.Article{URL: "https://www.nytimes.com/2021/01/20/us/politics/biden-inauguration.html"}
+	err := api.FetchArticle(context.Background(), &article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "WASHINGTON — Joseph R. Biden Jr. was sworn in as the 46th president on Wednesday.\n" +
+		"He called for unity in his inaugural address.\n"
+	if article.Text != text {
+		t.Errorf("got text\n%q\nwant\n%q", article.Text, text)
+	}
+	if article.Page == nil || article.Page.URL != article.URL || article.Page.Status != 200 {
+		t.Errorf("got page %+v", article.Page)
+	}
+
+	article = models.Article{URL: "https://www.nytimes.com/interactive/2021/us/covid-cases.html"}
+	err = api.FetchArticle(context.Background(), &article)
+	if err == nil {
+		t.Error("no error for an article without text")
+	}
+}
+
+func TestIsArticleBody(t *testing.T) {
+	tests := []struct {
+		html string
+		want bool
+	}{
+		{`<section name="articleBody"></section>`, true},
+		{`<div name="articleBody"></div>`, true},
+		{`<section name="articleHeader"></section>`, false},
+		{`<section id="articleBody"></section>`, false},
+	}
+
+	for _, test := range tests {
+		doc, err := html.Parse(strings.NewReader("<body>" + test.html + "</body>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := doc.LastChild.LastChild // html > body
+		if got := isArticleBody(*body.FirstChild); got != test.want {
+			t.Errorf("isArticleBody(%s) = %t, want %t", test.html, got, test.want)
+		}
+	}
+}
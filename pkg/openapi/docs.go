@@ -0,0 +1,121 @@
+package openapi
+
+// The page renders the document client-side so that it never drifts from
+// Spec. Each GET operation not requiring the admin token can be tried
+// directly from the page.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>InfoGrid API</title>
+    <style>
+        body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+        details { border: 1px solid #ddd; border-radius: 4px; margin: 0.5em 0; padding: 0.5em; }
+        summary { cursor: pointer; }
+        .method { display: inline-block; width: 5em; font-weight: bold; text-transform: uppercase; }
+        .get { color: #1a7f37; } .post { color: #0969da; } .delete { color: #cf222e; } .put, .patch { color: #9a6700; }
+        table { border-collapse: collapse; margin: 0.5em 0; }
+        td, th { border: 1px solid #ddd; padding: 0.2em 0.5em; text-align: left; }
+        pre { background: #f6f8fa; padding: 0.5em; overflow: auto; max-height: 30em; }
+        input { width: 15em; }
+    </style>
+</head>
+<body>
+<h1 id="title">InfoGrid API</h1>
+<p id="description"></p>
+<p>Machine-readable document: <a href="/openapi.json">/openapi.json</a></p>
+<div id="paths"></div>
+<h2>Schemas</h2>
+<pre id="schemas"></pre>
+<script>
+"use strict";
+
+function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) { e.setAttribute(k, attrs[k]); });
+    (children || []).forEach(function (c) {
+        e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+    });
+    return e;
+}
+
+function schemaName(s) {
+    if (!s) return "";
+    if (s.$ref) return s.$ref.split("/").pop();
+    if (s.type === "array") return schemaName(s.items) + "[]";
+    return s.type || "";
+}
+
+function renderOperation(path, method, op) {
+    var details = el("details", {}, [
+        el("summary", {}, [el("span", {"class": "method " + method}, [method]), path + "  ", el("em", {}, [op.summary])])
+    ]);
+    if (op.description) details.appendChild(el("p", {}, [op.description]));
+    if (op.security) details.appendChild(el("p", {}, [el("em", {}, ["Requires the admin token in an Authorization: Bearer header."])]));
+
+    var inputs = {};
+    var params = op.parameters || [];
+    if (params.length) {
+        var table = el("table", {}, [el("tr", {}, [el("th", {}, ["Name"]), el("th", {}, ["In"]), el("th", {}, ["Description"]), el("th", {}, ["Value"])])]);
+        params.forEach(function (p) {
+            var input = el("input", {placeholder: schemaName(p.schema) + (p.required ? " (required)" : "")});
+            inputs[p.name] = {param: p, input: input};
+            table.appendChild(el("tr", {}, [el("td", {}, [p.name]), el("td", {}, [p.in]), el("td", {}, [p.description || ""]), el("td", {}, [input])]));
+        });
+        details.appendChild(table);
+    }
+
+    var responses = el("table", {}, [el("tr", {}, [el("th", {}, ["Status"]), el("th", {}, ["Description"]), el("th", {}, ["Schema"])])]);
+    Object.keys(op.responses).sort().forEach(function (code) {
+        var r = op.responses[code];
+        var types = Object.keys(r.content || {});
+        var schema = types.length ? types[0] + " " + schemaName(r.content[types[0]].schema) : "";
+        responses.appendChild(el("tr", {}, [el("td", {}, [code]), el("td", {}, [r.description]), el("td", {}, [schema])]));
+    });
+    details.appendChild(responses);
+
+    if (method === "get" && !op.security) {
+        var output = el("pre", {}, []);
+        var button = el("button", {}, ["Try it"]);
+        button.addEventListener("click", function () {
+            var url = path;
+            var query = [];
+            Object.keys(inputs).forEach(function (name) {
+                var v = inputs[name].input.value;
+                if (v === "") return;
+                if (inputs[name].param.in === "path") {
+                    url = url.replace("{" + name + "}", encodeURIComponent(v));
+                } else if (inputs[name].param.in === "query") {
+                    query.push(encodeURIComponent(name) + "=" + encodeURIComponent(v));
+                }
+            });
+            if (query.length) url += "?" + query.join("&");
+            output.textContent = "GET " + url + "\n...";
+            fetch(url).then(function (resp) {
+                return resp.text().then(function (text) {
+                    output.textContent = "GET " + url + "\n" + resp.status + " " + resp.statusText + "\n\n" + text.slice(0, 20000);
+                });
+            }).catch(function (err) { output.textContent = String(err); });
+        });
+        details.appendChild(button);
+        details.appendChild(output);
+    }
+
+    return details;
+}
+
+fetch("/openapi.json").then(function (resp) { return resp.json(); }).then(function (doc) {
+    document.getElementById("title").textContent = doc.info.title + " " + doc.info.version;
+    document.getElementById("description").textContent = doc.info.description || "";
+    var container = document.getElementById("paths");
+    Object.keys(doc.paths).sort().forEach(function (path) {
+        Object.keys(doc.paths[path]).sort().forEach(function (method) {
+            container.appendChild(renderOperation(path, method, doc.paths[path][method]));
+        });
+    });
+    document.getElementById("schemas").textContent = JSON.stringify(doc.components.schemas, null, 2);
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,26 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeSpec writes the document returned by Spec as JSON.
+func ServeSpec(w http.ResponseWriter, _ *http.Request) {
+	body, err := json.MarshalIndent(Spec(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write(body)
+}
+
+// ServeDocs writes a self-contained page that fetches /openapi.json and
+// renders it. Nothing is loaded from a CDN.
+func ServeDocs(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(docsPage))
+}
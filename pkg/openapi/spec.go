@@ -0,0 +1,686 @@
+package openapi
+
+// Spec returns the OpenAPI document describing every route registered in
+// cmd/routes.go. A route added there without an entry here fails the test
+// in cmd/routes_test.go.
+func Spec() *Document {
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "InfoGrid",
+			Description: "A simple news aggregation. Articles are captured from NYTimes and Reuters, summarised and tagged.",
+			Version:     "1.0.0",
+		},
+		Servers: []Server{{URL: "https://www.infogrid.app/"}},
+		Paths: map[string]PathItem{
+			"/": {
+				"get": {
+					Summary:     "Browse the captured articles",
+					OperationID: "showArticles",
+					Tags:        []string{"pages"},
+					Responses: map[string]Response{
+						"200": {
+							Description: "An HTML page listing every article.",
+							Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+						},
+						"500": errorResponse("The page could not be rendered."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/articles": {
+				"get": {
+					Summary:     "List articles",
+					Description: "Articles are sorted by their published date, oldest first.",
+					OperationID: "getArticles",
+					Tags:        []string{"articles"},
+					Parameters: []Parameter{
+						queryParam("section", "Only return articles from this section (us, world, technology, etc.)."),
+						queryParam("tag", "Only return articles containing this tag."),
+						queryParam("person", "Only return articles mentioning this person, for example \"joe biden\"."),
+						queryParam("place", "Only return articles mentioning this place (GPE or LOC entity)."),
+						queryParam("org", "Only return articles mentioning this organisation. Also accepted as organisation or organization."),
+					},
+					Responses: map[string]Response{
+						"200": {Description: "An array of articles.", Content: jsonContent(arrayOf(ref("Article")))},
+						"400": errorResponse("The query string is malformed."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/sections": {
+				"get": {
+					Summary:     "List all available sections",
+					OperationID: "getSections",
+					Tags:        []string{"articles"},
+					Responses: map[string]Response{
+						"200": {Description: "An array of available sections.", Content: jsonContent(arrayOf(&Schema{Type: "string"}))},
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/tags": {
+				"get": {
+					Summary:     "List all available tags",
+					OperationID: "getTags",
+					Tags:        []string{"articles"},
+					Responses: map[string]Response{
+						"200": {Description: "An array of available tags (biden, trump, covid-19, etc.).", Content: jsonContent(arrayOf(&Schema{Type: "string"}))},
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/tags/stats": {
+				"get": statsOperation("getTagStats", "tag"),
+			},
+			"/sections/stats": {
+				"get": statsOperation("getSectionStats", "section"),
+			},
+			"/entities": {
+				"get": {
+					Summary:     "List the named entities found in the articles",
+					Description: "Entities are sorted by the number of articles mentioning them.",
+					OperationID: "getEntities",
+					Tags:        []string{"statistics"},
+					Parameters: []Parameter{
+						queryParam("type", "Comma separated entity types: person, place, org, or prose labels such as PERSON or GPE. All types by default."),
+						{Name: "limit", In: "query", Description: "Maximum number of entities, 100 by default, 0 for all.", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "An array of entities.", Content: jsonContent(arrayOf(ref("EntityStat")))},
+						"400": errorResponse("limit is invalid."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/trending": {
+				"get": {
+					Summary:     "Tags that are spiking",
+					Description: "Hours in which a tag appeared in many more articles than during the previous week, newest first.",
+					OperationID: "getTrending",
+					Tags:        []string{"statistics"},
+					Parameters: []Parameter{
+						queryParam("since", "Only return events of the hours in this duration before now, for example 24h (default)."),
+						{Name: "limit", In: "query", Description: "Maximum number of events, 50 by default.", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "An array of trend events.", Content: jsonContent(arrayOf(ref("Trend")))},
+						"400": errorResponse("since or limit is invalid."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/articles/{id}/snapshot": {
+				"get": {
+					Summary: "Snapshot of an article",
+					Description: "The HTML of the article as it was fetched, if snapshots are enabled. " +
+						"X-Snapshot-URL and X-Snapshot-Fetched-At tell where and when, and the ETag is the SHA-256 of the HTML. " +
+						"With format=json, the record of the snapshot instead.",
+					OperationID: "getSnapshot",
+					Tags:        []string{"articles"},
+					Parameters: []Parameter{
+						pathParam("id", "ID of the article."),
+						{Name: "format", In: "query", Description: "html (default) or json.", Schema: &Schema{Type: "string", Enum: []string{"html", "json"}}},
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The page, or its record.",
+							Content: map[string]MediaType{
+								"text/html":        {Schema: &Schema{Type: "string"}},
+								"application/json": {Schema: ref("Snapshot")},
+							},
+						},
+						"400": errorResponse("format is invalid."),
+						"404": errorResponse("No article has this ID, or it has no snapshot."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/articles/{id}/versions": {
+				"get": {
+					Summary: "Versions of an article",
+					Description: "Recent articles are fetched again on a schedule, and a new version is stored when their text has changed. " +
+						"Every version after the first has the unified diff of the text from the previous version, paragraph by paragraph.",
+					OperationID: "getVersions",
+					Tags:        []string{"articles"},
+					Parameters:  []Parameter{pathParam("id", "ID of the article.")},
+					Responses: map[string]Response{
+						"200": {Description: "The versions, oldest first; the last one is the current article.", Content: jsonContent(ref("ArticleVersions"))},
+						"404": errorResponse("No article has this ID."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/export": {
+				"get": {
+					Summary: "Export articles",
+					Description: "Streams the selected articles, text included, as JSON Lines (one article per line) or CSV. " +
+						"The file can be imported with \"infogrid import\".",
+					OperationID: "exportArticles",
+					Tags:        []string{"articles"},
+					Parameters: []Parameter{
+						{Name: "format", In: "query", Description: "jsonl (default) or csv.", Schema: &Schema{Type: "string", Enum: []string{"jsonl", "csv"}}},
+						queryParam("section", "Comma separated sections; articles from any of them."),
+						queryParam("tag", "Comma separated tags; articles having all of them."),
+						queryParam("from", "Articles captured from this date (2021-01-30) or RFC 3339 time."),
+						queryParam("to", "Articles captured before this date or RFC 3339 time."),
+					},
+					Responses: map[string]Response{
+						"200": {
+							Description: "The articles, oldest capture first.",
+							Content: map[string]MediaType{
+								"application/x-ndjson": {Schema: &Schema{Type: "string"}},
+								"text/csv":             {Schema: &Schema{Type: "string"}},
+							},
+						},
+						"400": errorResponse("format or a filter is invalid."),
+						"500": errorResponse("Internal error."),
+						"503": errorResponse("The database is unavailable."),
+					},
+				},
+			},
+			"/admin/jobs": {
+				"get": adminOperation(Operation{
+					Summary:     "Scheduled jobs and their run history",
+					Description: "Lists the capture jobs with their schedules, and the last runs of every job, newest first.",
+					OperationID: "getJobs",
+					Parameters: []Parameter{
+						queryParam("job", "Only return the runs of this job, for example capture:reuters."),
+						{Name: "limit", In: "query", Description: "Maximum number of runs, 50 by default.", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "The jobs and their runs.", Content: jsonContent(ref("JobsResponse"))},
+						"400": errorResponse("limit is invalid."),
+					},
+				}),
+			},
+			"/admin/jobs/{id}": {
+				"get": adminOperation(Operation{
+					Summary:     "Status of a job run",
+					Description: "Poll this to follow a job started by another admin endpoint.",
+					OperationID: "getJob",
+					Parameters:  []Parameter{pathParam("id", "ID of the run, as returned when the job was started.")},
+					Responses: map[string]Response{
+						"200": {Description: "The run.", Content: jsonContent(ref("JobRun"))},
+						"404": errorResponse("No run has this ID."),
+					},
+				}),
+			},
+			"/admin/sources": {
+				"get": adminOperation(Operation{
+					Summary:     "Health of the sources",
+					Description: "Lists the last captures of every enabled source, newest first, with the metrics which alert when they drop below their median over the previous captures, usually because the markup of the source has changed.",
+					OperationID: "getSources",
+					Parameters: []Parameter{
+						{Name: "limit", In: "query", Description: "Maximum number of captures per source, 10 by default.", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "The health of the sources.", Content: jsonContent(ref("SourcesResponse"))},
+						"400": errorResponse("limit is invalid."),
+					},
+				}),
+			},
+			"/admin/failures": {
+				"get": adminOperation(Operation{
+					Summary:     "Articles which could not be captured",
+					Description: "Lists the articles whose page could not be read, or which could not be stored, most recent failure first. They are captured again by the retry jobs until next_retry is missing.",
+					OperationID: "getFailures",
+					Parameters: []Parameter{
+						queryParam("source", "Only return the failures of this source (nytimes or reuters)."),
+						{Name: "limit", In: "query", Description: "Maximum number of failures, 50 by default.", Schema: &Schema{Type: "integer"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "The failed articles.", Content: jsonContent(ref("FailuresResponse"))},
+						"400": errorResponse("limit is invalid."),
+					},
+				}),
+			},
+			"/admin/capture": {
+				"post": jobOperation(Operation{
+					Summary:     "Capture articles now",
+					OperationID: "triggerCapture",
+					Parameters:  []Parameter{queryParam("source", "Only capture this source (nytimes or reuters). Every enabled source by default.")},
+					Responses: map[string]Response{
+						"404": errorResponse("The source does not exist or is not enabled."),
+					},
+				}),
+			},
+			"/admin/resummarise": {
+				"post": jobOperation(Operation{
+					Summary:     "Summarise articles again",
+					Description: "For example after changing the summary ratio. Select one article with id, or the articles captured between from and to.",
+					OperationID: "resummarise",
+					Parameters:  articleSelectionParams(),
+					Responses: map[string]Response{
+						"400": errorResponse("The selection is invalid."),
+						"404": errorResponse("No article has this id."),
+					},
+				}),
+			},
+			"/admin/retag": {
+				"post": jobOperation(Operation{
+					Summary:     "Extract the entities and tags of articles again",
+					Description: "For example after changing the tag configuration. Select one article with id, or the articles captured between from and to.",
+					OperationID: "retag",
+					Parameters:  articleSelectionParams(),
+					Responses: map[string]Response{
+						"400": errorResponse("The selection is invalid."),
+						"404": errorResponse("No article has this id."),
+					},
+				}),
+			},
+			"/admin/clean": {
+				"post": jobOperation(Operation{
+					Summary: "Remove old articles",
+					Description: "Applies the retention rules, whatever the number of stored articles, archiving the removed articles if configured. " +
+						"With dry_run=true, nothing is removed and the report is returned at once.",
+					OperationID: "cleanArticles",
+					Parameters: []Parameter{
+						queryParam("max_age", "A Go duration such as 72h. Replaces the rules by one removing every article captured before, except the bookmarked ones."),
+						{Name: "dry_run", In: "query", Description: "Only report what would be removed.", Schema: &Schema{Type: "boolean"}},
+					},
+					Responses: map[string]Response{
+						"200": {Description: "The dry run report.", Content: jsonContent(ref("RetentionReport"))},
+						"400": errorResponse("max_age or dry_run is invalid."),
+					},
+				}),
+			},
+			"/admin/articles/{id}/bookmark": {
+				"put": adminOperation(Operation{
+					Summary:     "Bookmark an article",
+					Description: "The retention rules with keep_bookmarked never remove bookmarked articles.",
+					OperationID: "bookmarkArticle",
+					Parameters:  []Parameter{pathParam("id", "ID of the article.")},
+					Responses: map[string]Response{
+						"200": {Description: "The bookmarked article.", Content: jsonContent(ref("Article"))},
+						"404": errorResponse("No article has this ID."),
+					},
+				}),
+				"delete": adminOperation(Operation{
+					Summary:     "Remove the bookmark of an article",
+					OperationID: "unbookmarkArticle",
+					Parameters:  []Parameter{pathParam("id", "ID of the article.")},
+					Responses: map[string]Response{
+						"200": {Description: "The article.", Content: jsonContent(ref("Article"))},
+						"404": errorResponse("No article has this ID."),
+					},
+				}),
+			},
+			"/admin/reset": {
+				"post": jobOperation(Operation{
+					Summary: "Delete every article",
+					Description: "Must be called twice. Without confirm, returns a confirmation token valid for 5 minutes. " +
+						"Called again with this token in confirm, deletes every article, with its versions, snapshots and failures, " +
+						"the trends and the health of the sources. The history of the jobs is kept.",
+					OperationID: "resetDatabase",
+					Parameters:  []Parameter{queryParam("confirm", "The token returned by the first call.")},
+					Responses: map[string]Response{
+						"200": {Description: "The confirmation token to send back.", Content: jsonContent(ref("ResetConfirmation"))},
+						"400": errorResponse("The confirmation token is invalid or has expired."),
+					},
+				}),
+			},
+			"/openapi.json": {
+				"get": {
+					Summary:     "This document",
+					OperationID: "getOpenAPI",
+					Tags:        []string{"docs"},
+					Responses: map[string]Response{
+						"200": {Description: "The OpenAPI 3 document of the API.", Content: jsonContent(&Schema{Type: "object"})},
+					},
+				},
+			},
+			"/docs": {
+				"get": {
+					Summary:     "Interactive documentation",
+					OperationID: "getDocs",
+					Tags:        []string{"docs"},
+					Responses: map[string]Response{
+						"200": {
+							Description: "An HTML page rendering this document.",
+							Content:     map[string]MediaType{"text/html": {Schema: &Schema{Type: "string"}}},
+						},
+					},
+				},
+			},
+		},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"Article": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":             str("Used by the admin endpoints."),
+						"url":            str("Link to the original article."),
+						"title":          str(""),
+						"section":        str("Section of the news agency the article comes from."),
+						"published_date": str("For example \"2021-01-30 00:08:43 +0000 UTC\"."),
+						"SummarisedText": str("Summary of the article computed with TextRank."),
+						"Tags":           {Type: "array", Items: &Schema{Type: "string"}, Description: "Names of the most salient entities."},
+						"entities":       arrayOf(ref("Entity")),
+						"captured_at":    dateTime("When the article was stored."),
+						"source":         str("Source the article was captured from, empty for old articles."),
+						"bookmarked":     {Type: "boolean", Description: "Bookmarked articles can be kept by the retention rules."},
+						"charset":        str("Charset of the page the text was extracted from, before it was transcoded to UTF-8. Missing for old articles."),
+						"version":        {Type: "integer", Description: "1 when captured, incremented for every edit of the page; 0 for old articles."},
+						"updated_at":     dateTime("When the last edit was captured; absent if the article was never edited."),
+						"algorithm_version": {
+							Type:        "integer",
+							Description: "Version of the algorithms that computed the summary and tags, 0 if unknown.",
+						},
+					},
+				},
+				"ArticleVersions": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"article_id": str(""),
+						"url":        str(""),
+						"versions":   arrayOf(ref("Version")),
+					},
+				},
+				"Version": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"version":         {Type: "integer"},
+						"title":           str(""),
+						"text_hash":       str("SHA-256 of the text."),
+						"summarised_text": str(""),
+						"tags":            {Type: "array", Items: &Schema{Type: "string"}},
+						"fetched_at":      dateTime("When this version was captured."),
+						"replaced_at":     dateTime("When the next version was captured; absent for the current version."),
+						"diff":            str("Unified diff of the text from the previous version; absent for the first version."),
+					},
+				},
+				"Snapshot": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":              str(""),
+						"article_id":      str(""),
+						"url":             str("URL of the page, after redirects."),
+						"status":          {Type: "integer", Description: "HTTP status of the response."},
+						"header":          {Type: "object", Description: "HTTP headers of the response, except Set-Cookie."},
+						"fetched_at":      dateTime(""),
+						"sha256":          str("Of the HTML."),
+						"charset":         str("Charset of the HTML, such as windows-1252, detected from the Content-Type header, a byte order mark or a meta tag."),
+						"size":            {Type: "integer", Description: "Of the HTML, in bytes."},
+						"compressed_size": {Type: "integer", Description: "Stored size, in bytes."},
+					},
+				},
+				"RetentionReport": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"dry_run":  {Type: "boolean"},
+						"archived": {Type: "boolean", Description: "The removed articles were archived rather than deleted."},
+						"removed":  {Type: "integer", Description: "Number of articles removed, or that would be in a dry run."},
+						"rules":    arrayOf(ref("RuleReport")),
+					},
+				},
+				"RuleReport": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"rule":    str("Source and section of the rule, such as \"nytimes/*\"."),
+						"matched": {Type: "integer", Description: "Articles following the rule."},
+						"kept":    {Type: "integer", Description: "Articles kept for their tags or bookmark."},
+						"expired": {Type: "integer", Description: "Articles older than the maximum age."},
+						"removed": {Type: "integer", Description: "The expired articles and those beyond the maximum count."},
+					},
+				},
+				"Entity": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"text":     str("Canonical name of the entity, as used in Tags."),
+						"type":     {Type: "string", Description: "Label given by the named-entity recognition.", Enum: []string{"PERSON", "GPE", "ORG"}},
+						"count":    {Type: "integer", Description: "Number of mentions in the article."},
+						"salience": {Type: "number", Description: "Between 0 and 1, higher for entities mentioned often and early."},
+					},
+				},
+				"EntityStat": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"text":      str(""),
+						"type":      str(""),
+						"articles":  {Type: "integer", Description: "Number of articles mentioning the entity."},
+						"mentions":  {Type: "integer", Description: "Number of mentions in all articles."},
+						"salience":  {Type: "number", Description: "Mean salience in those articles."},
+						"last_seen": dateTime("Capture time of the last article mentioning the entity."),
+					},
+				},
+				"Stat": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"name":           str("The tag or section."),
+						"count":          {Type: "integer", Description: "Number of articles in the window."},
+						"previous_count": {Type: "integer", Description: "Number of articles in the window before."},
+						"first_seen":     dateTime("First time an article with this value was captured."),
+						"last_seen":      dateTime("Last time an article with this value was captured."),
+						"trend":          {Type: "number", Description: "(count - previous_count) / (previous_count + 1)."},
+					},
+				},
+				"StatsResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"from":          dateTime("Start of the window."),
+						"to":            dateTime("End of the window."),
+						"previous_from": dateTime("Start of the previous window, which ends at from."),
+						"stats":         arrayOf(ref("Stat")),
+					},
+				},
+				"Trend": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"tag":              str(""),
+						"hour":             dateTime("Start of the bucket of time, as wide as scheduler.interval, in which the burst happened."),
+						"count":            {Type: "integer", Description: "Number of articles with the tag captured in that bucket."},
+						"baseline_mean":    {Type: "number", Description: "Mean number of articles per bucket during the previous week."},
+						"baseline_std_dev": {Type: "number", Description: "Standard deviation of the number of articles per bucket during the previous week."},
+						"z_score":          {Type: "number", Description: "(count - baseline_mean) / baseline_std_dev."},
+						"article_urls":     arrayOf(&Schema{Type: "string"}),
+						"detected_at":      dateTime(""),
+						"articles":         {Type: "array", Items: ref("Article"), Description: "The articles causing the burst that are still stored."},
+					},
+				},
+				"ResetConfirmation": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"confirm":    str("Token to send in the confirm parameter."),
+						"expires_at": dateTime(""),
+						"message":    str(""),
+					},
+				},
+				"Job": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"name":     str("capture: followed by the source name."),
+						"schedule": str("Cron expression, or @every followed by the interval."),
+						"jitter":   str("Maximum random delay added to every run."),
+						"running":  {Type: "boolean"},
+						"next_run": dateTime("When the job runs next, jitter included."),
+					},
+				},
+				"JobRun": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"id":      str(""),
+						"job":     str(""),
+						"trigger": {Type: "string", Enum: []string{"schedule", "manual"}},
+						"status":  {Type: "string", Enum: []string{"running", "succeeded", "failed", "cancelled", "skipped"}},
+						"start":   dateTime(""),
+						"end":     dateTime("Missing while the run is in progress."),
+						"found":   {Type: "integer", Description: "Articles listed by the source, selected for re-processing, or retried."},
+						"new":     {Type: "integer", Description: "Articles stored, the others were already stored."},
+						"failed":  {Type: "integer", Description: "Articles that could not be read, stored or updated."},
+						"skipped": {Type: "integer", Description: "Articles whose page robots.txt disallows."},
+						"errors":  arrayOf(&Schema{Type: "string"}),
+						"updated": {Type: "integer", Description: "Articles re-summarised or re-tagged."},
+						"deleted": {Type: "integer", Description: "Articles deleted."},
+					},
+				},
+				"JobsResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"jobs": arrayOf(ref("Job")),
+						"runs": arrayOf(ref("JobRun")),
+					},
+				},
+				"SourceMetrics": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"found":           {Type: "integer", Description: "Articles listed by the source."},
+						"fetched":         {Type: "integer", Description: "Article pages fetched, the others were already stored."},
+						"extracted":       {Type: "integer", Description: "Fetched pages with text."},
+						"extraction_rate": {Type: "number", Description: "extracted / fetched, 0 if nothing was fetched."},
+						"average_length":  {Type: "number", Description: "Of the extracted texts, in bytes."},
+					},
+				},
+				"SourceAlert": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"metric":   {Type: "string", Enum: []string{"found", "extraction_rate", "average_length"}},
+						"value":    {Type: "number"},
+						"baseline": {Type: "number"},
+					},
+				},
+				"SourceRun": {
+					Type:        "object",
+					Description: "The metrics of a capture, see SourceMetrics, with their baseline.",
+					Properties: map[string]*Schema{
+						"source":          str(""),
+						"time":            dateTime(""),
+						"found":           {Type: "integer"},
+						"fetched":         {Type: "integer"},
+						"extracted":       {Type: "integer"},
+						"extraction_rate": {Type: "number"},
+						"average_length":  {Type: "number"},
+						"error":           str("Why the source could not be read."),
+						"baseline":        {Ref: "#/components/schemas/SourceMetrics", Description: "Median of the previous captures, missing until there are enough of them."},
+						"alerts":          arrayOf(ref("SourceAlert")),
+					},
+				},
+				"SourceStatus": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"source": str(""),
+						"status": {
+							Type:        "string",
+							Enum:        []string{"ok", "alerting", "failing", "unknown"},
+							Description: "alerting if a metric of the last capture is below its baseline, failing if the last capture could not read the source, unknown before the first capture with a baseline.",
+						},
+						"runs": arrayOf(ref("SourceRun")),
+					},
+				},
+				"SourcesResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"sources": arrayOf(ref("SourceStatus")),
+					},
+				},
+				"FailedArticle": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"url":            str(""),
+						"source":         str(""),
+						"section":        str(""),
+						"title":          str(""),
+						"published_date": str(""),
+						"error":          str("Of the last attempt."),
+						"attempts":       {Type: "integer"},
+						"first_failure":  dateTime(""),
+						"last_failure":   dateTime(""),
+						"next_retry":     dateTime("Missing once the article is given up on: its error is not temporary, or it failed retry.max_attempts times."),
+					},
+				},
+				"FailuresResponse": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"failures": arrayOf(ref("FailedArticle")),
+					},
+				},
+				"ErrorResponse": {
+					Type:     "object",
+					Required: []string{"error"},
+					Properties: map[string]*Schema{
+						"error": {
+							Type:     "object",
+							Required: []string{"code", "message"},
+							Properties: map[string]*Schema{
+								"code": {
+									Type: "string",
+									Enum: []string{"bad_request", "unauthorized", "forbidden", "not_found", "method_not_allowed", "conflict", "internal_error", "service_unavailable"},
+								},
+								"message":    str("Human readable description of the error."),
+								"request_id": str("Also sent in the X-Request-ID response header."),
+							},
+						},
+					},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"adminToken": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "The admin token set in INFOGRID_ADMIN_TOKEN.",
+				},
+			},
+		},
+	}
+}
+
+// adminOperation adds the authentication and the common errors to an
+// operation of the /admin endpoints.
+func adminOperation(op Operation) Operation {
+	op.Tags = []string{"admin"}
+	op.Security = []map[string][]string{{"adminToken": {}}}
+
+	op.Responses["401"] = errorResponse("The admin token is missing or wrong.")
+	op.Responses["403"] = errorResponse("The admin endpoints are disabled.")
+	if _, ok := op.Responses["500"]; !ok {
+		op.Responses["500"] = errorResponse("Internal error.")
+	}
+	op.Responses["503"] = errorResponse("The database is unavailable, or the server is shutting down.")
+
+	return op
+}
+
+// jobOperation is an adminOperation starting a job.
+func jobOperation(op Operation) Operation {
+	op.Responses["202"] = Response{
+		Description: "The job has started. Poll the Location header, /admin/jobs/{id}, for its status.",
+		Content:     jsonContent(ref("JobRun")),
+	}
+	op.Responses["409"] = errorResponse("The same job is already running.")
+
+	return adminOperation(op)
+}
+
+func articleSelectionParams() []Parameter {
+	return []Parameter{
+		queryParam("id", "ID of one article."),
+		{Name: "from", In: "query", Description: "Select the articles captured from this time.", Schema: dateTime("")},
+		{Name: "to", In: "query", Description: "Select the articles captured before this time, now by default.", Schema: dateTime("")},
+	}
+}
+
+func statsOperation(operationID string, of string) Operation {
+	return Operation{
+		Summary:     "Number of articles per " + of + " with trends",
+		Description: "Counts articles per " + of + " captured in the window ending now, and in the window just before it.",
+		OperationID: operationID,
+		Tags:        []string{"statistics"},
+		Parameters: []Parameter{
+			queryParam("window", "Length of the window as a Go duration, for example 24h (default) or 168h. At most 2160h."),
+			{Name: "limit", In: "query", Description: "Maximum number of entries returned, 0 for all.", Schema: &Schema{Type: "integer"}},
+		},
+		Responses: map[string]Response{
+			"200": {Description: "The statistics, most frequent first.", Content: jsonContent(ref("StatsResponse"))},
+			"400": errorResponse("window or limit is invalid."),
+			"500": errorResponse("Internal error."),
+			"503": errorResponse("The database is unavailable."),
+		},
+	}
+}
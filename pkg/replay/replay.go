@@ -0,0 +1,133 @@
+// Package replay records the HTTP responses of the sources to fixture
+// files, and replays them, so that the sources can be tested offline.
+//
+// A fixture holds one response, as sent on the wire, in a file named after
+// the URL: https://www.reuters.com/news/world is stored in
+// <dir>/www.reuters.com/news/world.http.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoredParams are the query parameters left out of the fixture names, so
+// that API keys are not recorded and any key replays the same fixture.
+var IgnoredParams = []string{"api-key"}
+
+// Path returns the fixture of u in dir.
+func Path(dir string, u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") || p == "/" {
+		p += "/index"
+	}
+
+	q := u.Query()
+	for _, name := range IgnoredParams {
+		q.Del(name)
+	}
+	if len(q) > 0 {
+		sum := sha256.Sum256([]byte(q.Encode()))
+		p += "-" + hex.EncodeToString(sum[:4])
+	}
+
+	return filepath.Join(dir, strings.ToLower(u.Host), filepath.FromSlash(p)+".http")
+}
+
+// Recorder is a RoundTripper saving the responses of another one as
+// fixtures.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// NewRecorder returns a Recorder saving the responses of next, or of
+// http.DefaultTransport if nil, in dir.
+func NewRecorder(dir string, next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{dir: dir, next: next}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is saved decoded, without its length, so that fixtures can
+	// be edited by hand.
+	rec := *resp
+	rec.Header = resp.Header.Clone()
+	rec.Header.Del("Set-Cookie")
+	rec.Header.Del("Content-Length")
+	rec.Header.Del("Transfer-Encoding")
+	rec.TransferEncoding = nil
+	rec.ContentLength = -1
+	rec.Close = true
+	rec.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	dump, err := httputil.DumpResponse(&rec, true)
+	if err != nil {
+		return nil, err
+	}
+
+	file := Path(r.dir, req.URL)
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(file, dump, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Replayer is a RoundTripper answering with the fixtures of a directory.
+// Requests without a fixture fail, so that tests never reach the network.
+type Replayer struct {
+	dir string
+}
+
+func NewReplayer(dir string) *Replayer {
+	return &Replayer{dir: dir}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	file := Path(r.dir, req.URL)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no fixture for %s %s://%s%s (%s)", req.Method, req.URL.Scheme, req.URL.Host, req.URL.Path, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", file, err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,102 @@
+package replay
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.reuters.com/news/world", "www.reuters.com/news/world.http"},
+		{"https://WWW.Reuters.com/news/world/", "www.reuters.com/news/world/index.http"},
+		{"https://www.reuters.com", "www.reuters.com/index.http"},
+		{"https://www.reuters.com//article/x", "www.reuters.com/article/x.http"},
+		{"https://www.reuters.com/../../etc/passwd", "www.reuters.com/etc/passwd.http"},
+		{"https://api.nytimes.com/svc/home.json?api-key=secret", "api.nytimes.com/svc/home.json.http"},
+		{"https://api.nytimes.com/svc/home.json?page=2&api-key=secret", "api.nytimes.com/svc/home.json-"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := filepath.ToSlash(Path("testdata", u))
+		if !strings.HasPrefix(got, "testdata/"+test.want) {
+			t.Errorf("Path(%s) = %s, want testdata/%s", test.url, got, test.want)
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Set-Cookie", "session=1")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("<p>" + r.URL.Path + "</p>"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	get := func(rt http.RoundTripper, path string) (*http.Response, string, error) {
+		resp, err := (&http.Client{Transport: rt}).Get(srv.URL + path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		return resp, string(body), err
+	}
+
+	resp, body, err := get(NewRecorder(dir, nil), "/news?api-key=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "<p>/news</p>" {
+		t.Errorf("recorder returned %q", body)
+	}
+
+	srv.Close() // Replays must not need the server
+
+	resp, body, err = get(NewReplayer(dir), "/news?api-key=other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || body != "<p>/news</p>" ||
+		resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("replayed %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+	if resp.Header.Get("Set-Cookie") != "" {
+		t.Error("Set-Cookie recorded")
+	}
+
+	u, _ := url.Parse(srv.URL + "/news")
+	fixture, err := ioutil.ReadFile(Path(dir, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(fixture), "secret") {
+		t.Errorf("API key recorded in %s", fixture)
+	}
+
+	_, _, err = get(NewReplayer(dir), "/other")
+	if err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("got %v for a request without fixture", err)
+	}
+}
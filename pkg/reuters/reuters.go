@@ -1,64 +1,120 @@
 package reuters
 
 import (
+	"context"
+	"fmt"
 	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
 	"github.com/vitsensei/infogrid/pkg/models"
 	"golang.org/x/net/html"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
 
 const (
 	reuterBasedURL = "https://www.reuters.com/"
+
+	// Name is recorded as the source of the articles.
+	Name = "reuters"
 )
 
 type API struct {
-	urls     map[string]string
-	articles []models.Article
+	urls    map[string]string
+	fetcher *fetcher.Fetcher
 }
 
-func NewAPI() *API {
-	urls := map[string]string{
-		"world":      "https://www.reuters.com/news/world",
-		"technology": "https://www.reuters.com/news/technology"}
+// Name returns the name of the source, recorded in its articles.
+func (a *API) Name() string {
+	return Name
+}
+
+// NewAPI returns an API for the news of the given sections, or of world and
+// technology if sections is empty.
+func NewAPI(sections []string) *API {
+	if len(sections) == 0 {
+		sections = []string{"world", "technology"}
+	}
+
+	urls := make(map[string]string)
+	for _, section := range sections {
+		urls[section] = reuterBasedURL + "news/" + section
+	}
 
 	return &API{urls: urls}
 }
 
-func (a *API) GenerateArticles() error {
-	for section, url := range a.urls {
-		articles, err := generateArticles(url)
-		if err != nil {
-			return err
-		}
+// SetFetcher makes the API fetch its pages with f, such as a Fetcher
+// replaying fixtures in tests, rather than with the one of the extractor
+// package.
+func (a *API) SetFetcher(f *fetcher.Fetcher) {
+	a.fetcher = f
+}
 
-		for i := range articles {
-			articles[i].Section = section
-			articles[i].PublishedDate = time.Now().String()
+// Fetch lists the articles of every section, without their text, which
+// FetchArticle fetches. since is ignored: the section pages give no date. A
+// section which cannot be read does not prevent the others from being
+// listed: its error is sent on errs.
+func (a *API) Fetch(ctx context.Context, since time.Time) (<-chan models.Article, <-chan error) {
+	articles := make(chan models.Article)
+	errs := make(chan error)
+
+	go func() {
+		defer close(articles)
+		defer close(errs)
+
+		for _, section := range a.sections() {
+			listed, err := generateArticles(ctx, a.fetcher, a.urls[section])
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				select {
+				case errs <- fmt.Errorf("section %s: %w", section, err):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
 
-			text, err := ExtractText(articles[i].URL)
-			if err == nil {
-				articles[i].Text = text
+			for _, article := range listed {
+				article.Source = Name
+				article.Section = section
+				article.PublishedDate = time.Now().UTC().Format(time.RFC3339)
 
-				tags, err := extractor.ExtractTags(text, 3)
-				if err == nil {
-					articles[i].Tags = tags
+				select {
+				case articles <- article:
+				case <-ctx.Done():
+					return
 				}
 			}
-
 		}
+	}()
+
+	return articles, errs
+}
 
-		a.articles = append(a.articles, articles...)
+// sections returns the sections of the API, sorted so that every capture
+// reads them in the same order.
+func (a *API) sections() []string {
+	sections := make([]string, 0, len(a.urls))
+	for section := range a.urls {
+		sections = append(sections, section)
 	}
+	sort.Strings(sections)
 
-	return nil
+	return sections
 }
 
-func generateArticles(url string) ([]models.Article, error) {
+func generateArticles(ctx context.Context, pf *fetcher.Fetcher, url string) ([]models.Article, error) {
 	var articles []models.Article
 
-	bodyString, err := extractor.ExtractTextFromURL(url)
+	page, err := extractor.FetchPageWith(ctx, pf, url)
+	if err != nil {
+		return nil, err
+	}
+	bodyString := page.HTML
 
 	doc, err := html.Parse(strings.NewReader(bodyString))
 
@@ -118,7 +174,8 @@ func isContainLink(node *html.Node) (bool, string) {
 	if node.Data == "a" {
 		for _, a := range node.Attr {
 			if a.Key == "href" {
-				return true, reuterBasedURL + a.Val
+				// The links are relative to the root, which reuterBasedURL ends with
+				return true, reuterBasedURL + strings.TrimPrefix(a.Val, "/")
 			}
 		}
 	}
@@ -138,10 +195,6 @@ func isContainTitle(node *html.Node) (bool, string) {
 	return false, ""
 }
 
-func (a *API) GetArticles() []models.Article {
-	return a.articles
-}
-
 func isArticleBody(n *html.Node) bool {
 	for _, a := range n.Attr {
 		if a.Key == "class" && a.Val == "ArticleBodyWrapper" {
@@ -163,15 +216,26 @@ func hasArticleText(n *html.Node) bool {
 	return false
 }
 
-func ExtractText(url string) (string, error) {
+func ExtractText(ctx context.Context, url string) (string, error) {
+	text, _, err := extractPage(ctx, nil, url)
+	return text, err
+}
+
+// extractPage fetches the page at url with pf, nil for the Fetcher of the
+// extractor package, and extracts its text.
+func extractPage(ctx context.Context, pf *fetcher.Fetcher, url string) (string, *models.Page, error) {
 	var paragraph string
 
-	bodyString, err := extractor.ExtractTextFromURL(url)
+	page, err := extractor.FetchPageWith(ctx, pf, url)
+	if err != nil {
+		return "", nil, err
+	}
+	bodyString := page.HTML
 
 	doc, err := html.Parse(strings.NewReader(bodyString))
 
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	var articleBodyNode *html.Node
@@ -203,7 +267,28 @@ func ExtractText(url string) (string, error) {
 		}
 
 	}
-	f(articleBodyNode)
 
-	return paragraph, nil
+	// Without an article body, the markup of the page has probably changed.
+	// The empty text is noticed by the health checks of the controller.
+	if articleBodyNode != nil {
+		f(articleBodyNode)
+	}
+
+	return paragraph, page, nil
+}
+
+// FetchArticle fetches the page of article again, to replace its text and
+// page if they have changed.
+func (a *API) FetchArticle(ctx context.Context, article *models.Article) error {
+	text, page, err := extractPage(ctx, a.fetcher, article.URL)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return fmt.Errorf("%w at %s", extractor.ErrNoText, article.URL)
+	}
+
+	article.Text = text
+	article.Page = page
+	return nil
 }
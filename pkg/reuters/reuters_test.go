@@ -0,0 +1,222 @@
+package reuters
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/vitsensei/infogrid/pkg/extractor"
+	"github.com/vitsensei/infogrid/pkg/fetcher"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"github.com/vitsensei/infogrid/pkg/replay"
+	"golang.org/x/net/html"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var record = flag.Bool("record", false, "record the fixtures of testdata from reuters.com")
+
+// testFetcher returns a Fetcher replaying the fixtures of testdata, or
+// recording them with -record.
+func testFetcher() *fetcher.Fetcher {
+	cfg := fetcher.DefaultConfig()
+	if *record {
+		cfg.Transport = replay.NewRecorder("testdata", nil)
+	} else {
+		cfg.Transport = replay.NewReplayer("testdata")
+		cfg.RatePerHost = 0
+		cfg.Retries = 0
+	}
+
+	return fetcher.New(cfg)
+}
+
+// collect returns the articles listed by Fetch, and the errors sent.
+func collect(api *API) ([]models.Article, []error) {
+	listed, errs := api.Fetch(context.Background(), time.Time{})
+
+	var sent []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errs {
+			sent = append(sent, err)
+		}
+	}()
+
+	var articles []models.Article
+	for article := range listed {
+		articles = append(articles, article)
+	}
+	<-done
+
+	return articles, sent
+}
+
+func TestFetch(t *testing.T) {
+	api := NewAPI([]string{"world", "technology"})
+	api.SetFetcher(testFetcher())
+
+	listed, errs := collect(api)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(listed) != 3 {
+		t.Fatalf("got %d articles, want 3: %+v", len(listed), listed)
+	}
+
+	var articles []models.Article
+	var skipped []string
+	for _, article := range listed {
+		if article.Text != "" {
+			t.Errorf("%s listed with its text", article.URL)
+		}
+
+		err := api.FetchArticle(context.Background(), &article)
+		switch {
+		case errors.Is(err, fetcher.ErrDisallowed):
+			skipped = append(skipped, article.URL)
+		case err != nil:
+			t.Errorf("%s: %v", article.URL, err)
+		default:
+			articles = append(articles, article)
+		}
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].URL < articles[j].URL })
+
+	type want struct {
+		url, title, section, text, charset string
+	}
+	wants := []want{
+		{
+			url:     "https://www.reuters.com/article/us-tech-chips-idUSKBN29P0C3",
+			title:   "Chipmaker opens plant in Dresden",
+			section: "technology",
+			text: "DRESDEN (Reuters) - The plant will make chips for cars, the company’s chief executive said.\n" +
+				"Production will start in 2023 – earlier than planned – at a cost of €10 billion.\n",
+			charset: "windows-1252",
+		},
+		{
+			url:     "https://www.reuters.com/article/us-world-summit-idUSKBN29P0A1",
+			title:   "Leaders agree on climate targets at summit",
+			section: "world",
+			text: "GENEVA (Reuters) - Leaders of 40 countries agreed on Friday to cut their emissions by half within ten years.\n" +
+				"The agreement will be reviewed every two years.\n",
+			charset: "utf-8",
+		},
+	}
+
+	if len(articles) != len(wants) {
+		t.Fatalf("got %d articles, want %d", len(articles), len(wants))
+	}
+	for i, w := range wants {
+		a := articles[i]
+		if a.URL != w.url || a.Title != w.title || a.Section != w.section || a.Source != Name {
+			t.Errorf("got article %q %q in %s from %s, want %q %q in %s from %s",
+				a.URL, a.Title, a.Section, a.Source, w.url, w.title, w.section, Name)
+		}
+		if _, ok := a.PublishedTime(); !ok {
+			t.Errorf("published date of %s %q cannot be parsed", w.url, a.PublishedDate)
+		}
+		if a.Text != w.text {
+			t.Errorf("text of %s:\ngot  %q\nwant %q", w.url, a.Text, w.text)
+		}
+		if a.Page == nil || a.Page.Charset != w.charset {
+			t.Errorf("page of %s: got %+v, want charset %s", w.url, a.Page, w.charset)
+		}
+	}
+
+	disallowed := []string{"https://www.reuters.com/article/paywalled-markets-idUSKBN29P0B2"}
+	if !reflect.DeepEqual(skipped, disallowed) {
+		t.Errorf("got skipped %v, want %v", skipped, disallowed)
+	}
+}
+
+func TestFetchFailedSection(t *testing.T) {
+	// The markets section has no fixture, and cannot be read
+	api := NewAPI([]string{"markets", "world"})
+	api.SetFetcher(testFetcher())
+
+	articles, errs := collect(api)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "section markets") {
+		t.Errorf("got errors %v, want the markets section reported", errs)
+	}
+	if len(articles) != 2 {
+		t.Fatalf("got %d articles, want the 2 articles of the world section", len(articles))
+	}
+	for _, a := range articles {
+		if a.Section != "world" {
+			t.Errorf("got %s in section %s", a.URL, a.Section)
+		}
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	extractor.SetFetcher(testFetcher())
+	defer extractor.SetFetcher(fetcher.New(fetcher.DefaultConfig()))
+
+	text, err := ExtractText(context.Background(), "https://www.reuters.com/article/us-world-summit-idUSKBN29P0A1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "Reporting by") || strings.Contains(text, "Headline") {
+		t.Errorf("text outside the article paragraphs extracted: %q", text)
+	}
+	if !strings.HasPrefix(text, "GENEVA (Reuters)") {
+		t.Errorf("got text %q", text)
+	}
+
+	_, err = ExtractText(context.Background(), "https://www.reuters.com/article/missing")
+	if err == nil {
+		t.Error("no error for a page without fixture")
+	}
+}
+
+func TestIsArticleBody(t *testing.T) {
+	tests := []struct {
+		html string
+		body bool
+		text bool
+	}{
+		{`<div class="ArticleBodyWrapper"></div>`, true, false},
+		{`<div class="ArticleBodyWrapper extra"></div>`, false, false},
+		{`<p class="Paragraph-paragraph-2Bgue ArticleBody-para-TD_9x"></p>`, false, true},
+		{`<p class="Attribution-attribution-Y5JpY"></p>`, false, false},
+		{`<p id="Paragraph"></p>`, false, false},
+	}
+
+	for _, test := range tests {
+		n := parseElement(t, test.html)
+		if got := isArticleBody(n); got != test.body {
+			t.Errorf("isArticleBody(%s) = %t, want %t", test.html, got, test.body)
+		}
+		if got := hasArticleText(n); got != test.text {
+			t.Errorf("hasArticleText(%s) = %t, want %t", test.html, got, test.text)
+		}
+	}
+}
+
+// parseElement returns the element of an HTML fragment.
+func parseElement(t *testing.T, fragment string) *html.Node {
+	doc, err := html.Parse(strings.NewReader("<body>" + fragment + "</body>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var find func(*html.Node) *html.Node
+	find = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && n.Data != "html" && n.Data != "head" && n.Data != "body" {
+			return n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if e := find(c); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+
+	return find(doc)
+}
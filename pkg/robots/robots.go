@@ -0,0 +1,221 @@
+// Package robots parses robots.txt files, following RFC 9309, and tells
+// which paths of a site a crawler may fetch.
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots are the rules of a robots.txt file.
+type Robots struct {
+	groups     []group
+	disallowed bool // Everything is disallowed, see DisallowAll
+}
+
+type group struct {
+	agents     []string // Lower case product tokens, "*" for any crawler
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+type rule struct {
+	allow   bool
+	pattern string // May hold * wildcards, and end with $ to match the end of the path
+}
+
+// AllowAll returns the rules of a site without robots.txt.
+func AllowAll() *Robots {
+	return &Robots{}
+}
+
+// DisallowAll returns the rules of a site whose robots.txt is unreachable.
+func DisallowAll() *Robots {
+	return &Robots{disallowed: true}
+}
+
+// Parse parses the content of a robots.txt file. Invalid lines are ignored.
+func Parse(data []byte) *Robots {
+	r := &Robots{}
+
+	var current *group
+	inRules := false // A user-agent line after rules starts another group
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 4096), len(data)+1)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if current == nil || inRules {
+				r.groups = append(r.groups, group{})
+				current = &r.groups[len(r.groups)-1]
+				inRules = false
+			}
+			current.agents = append(current.agents, productToken(value))
+		case "allow", "disallow":
+			if current == nil {
+				continue // Rules before any user-agent line
+			}
+			inRules = true
+			if value != "" {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: encode(value)})
+			}
+		case "crawl-delay":
+			if current == nil {
+				continue
+			}
+			inRules = true
+			s, err := strconv.ParseFloat(value, 64)
+			if err == nil && s > 0 && current.crawlDelay == 0 {
+				current.crawlDelay = time.Duration(s * float64(time.Second))
+			}
+		}
+	}
+
+	return r
+}
+
+// productToken returns the lower case name of a crawler, without its version
+// and comments: "infogrid" for "infogrid/1.0 (+https://...)".
+func productToken(agent string) string {
+	agent = strings.TrimSpace(agent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	return strings.ToLower(agent)
+}
+
+// encode percent-encodes the non-ASCII bytes of a pattern, as they are in
+// the paths it is matched against.
+func encode(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c >= 0x80 {
+			sb.WriteString("%" + strings.ToUpper(strconv.FormatInt(int64(c), 16)))
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
+
+// groupsOf returns the groups of agent: the groups naming its product
+// token, or else those of any crawler.
+func (r *Robots) groupsOf(agent string) []group {
+	token := productToken(agent)
+
+	var named, wildcard []group
+	for _, g := range r.groups {
+		if g.names(token) {
+			named = append(named, g)
+		} else if g.names("*") {
+			wildcard = append(wildcard, g)
+		}
+	}
+
+	if len(named) > 0 {
+		return named
+	}
+	return wildcard
+}
+
+func (g *group) names(token string) bool {
+	for _, a := range g.agents {
+		if a == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allowed reports whether agent, a User-Agent such as "infogrid/1.0", may
+// fetch path, the path and query of a URL as sent in requests. The longest
+// matching rule applies, Allow winning over Disallow if they are as long.
+// /robots.txt itself is always allowed.
+func (r *Robots) Allowed(agent string, path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowed {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	allowed, longest := true, -1
+	for _, g := range r.groupsOf(agent) {
+		for _, rl := range g.rules {
+			if len(rl.pattern) < longest || !match(rl.pattern, path) {
+				continue
+			}
+			if len(rl.pattern) > longest {
+				allowed = rl.allow
+			} else {
+				allowed = allowed || rl.allow
+			}
+			longest = len(rl.pattern)
+		}
+	}
+
+	return allowed
+}
+
+// CrawlDelay returns the delay asked for between the requests of agent, or
+// 0 if there is none.
+func (r *Robots) CrawlDelay(agent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsOf(agent) {
+		if g.crawlDelay > delay {
+			delay = g.crawlDelay
+		}
+	}
+
+	return delay
+}
+
+// match reports whether path starts with pattern, in which * matches any
+// sequence of characters and a final $ the end of the path.
+func match(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+
+	for i, p := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, p)
+		}
+		j := strings.Index(path, p)
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(p):]
+	}
+
+	return !anchored || path == ""
+}
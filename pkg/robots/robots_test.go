@@ -0,0 +1,140 @@
+package robots
+
+import (
+	"testing"
+	"time"
+)
+
+const robotsTxt = `# Comments and unknown lines are ignored
+Sitemap: https://www.example.com/sitemap.xml
+Disallow: /before-any-group
+
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 2
+
+User-agent: InfoGrid
+User-agent: other
+Disallow: /drafts  # trailing comment
+Allow: /page
+Disallow: /page
+Disallow: /caf%C3%A9
+Disallow: /café-noir
+Crawl-delay: 0.5
+
+user-agent: infogrid
+disallow: /archive/*/old
+allow:
+Crawl-delay: 10
+`
+
+func TestAllowed(t *testing.T) {
+	r := Parse([]byte(robotsTxt))
+
+	tests := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		// The wildcard group
+		{"crawler", "/", true},
+		{"crawler", "", true},
+		{"crawler", "/private", false},
+		{"crawler", "/private/page", false},
+		{"crawler", "/private/public/page", true}, // The longest rule wins
+		{"crawler", "/report.pdf", false},
+		{"crawler", "/report.pdf?page=2", true}, // $ anchors the end
+		{"crawler", "/search?q=news", false},
+		{"crawler", "/search", true},
+		{"crawler", "/before-any-group", true},
+		{"crawler", "/drafts", true},
+
+		// The groups naming the product token, merged, replace the wildcard
+		// group, whatever the case and version of the User-Agent
+		{"infogrid/1.0 (+https://github.com/vitsensei/infogrid)", "/private", true},
+		{"InfoGrid", "/drafts/1", false},
+		{"other", "/drafts/1", false},
+		{"infogrid", "/archive/2020/old", false},
+		{"infogrid", "/archive/2020/new", true},
+		{"infogrid", "/page", true}, // Allow wins over a Disallow as long
+		{"infogrid", "/caf%C3%A9", false},
+		{"infogrid", "/caf%C3%A9-noir", false}, // Patterns are percent-encoded as paths are
+		{"infogridbot", "/private", false},
+
+		// robots.txt itself
+		{"crawler", "/robots.txt", true},
+	}
+
+	for _, test := range tests {
+		if got := r.Allowed(test.agent, test.path); got != test.want {
+			t.Errorf("Allowed(%q, %q) = %t, want %t", test.agent, test.path, got, test.want)
+		}
+	}
+}
+
+func TestAllowAll(t *testing.T) {
+	for _, r := range []*Robots{AllowAll(), Parse(nil), Parse([]byte("User-agent: *\nDisallow:\n"))} {
+		if !r.Allowed("infogrid", "/private") || r.CrawlDelay("infogrid") != 0 {
+			t.Errorf("%+v does not allow everything", r)
+		}
+	}
+}
+
+func TestDisallowAll(t *testing.T) {
+	r := DisallowAll()
+	if r.Allowed("infogrid", "/") || r.Allowed("infogrid", "/page") {
+		t.Error("DisallowAll allows a page")
+	}
+	if !r.Allowed("infogrid", "/robots.txt") {
+		t.Error("DisallowAll disallows robots.txt")
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	r := Parse([]byte(robotsTxt))
+
+	tests := []struct {
+		agent string
+		want  time.Duration
+	}{
+		{"crawler", 2 * time.Second},
+		{"other", 500 * time.Millisecond},
+		{"infogrid/1.0", 10 * time.Second}, // The longest of the groups
+	}
+
+	for _, test := range tests {
+		if got := r.CrawlDelay(test.agent); got != test.want {
+			t.Errorf("CrawlDelay(%q) = %s, want %s", test.agent, got, test.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish/", "/fish", false},
+		{"/*.php", "/index.php?x=1", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/*.php$", "/dir/index.php", true},
+		{"/fish*", "/fish", true},
+		{"/a*b*c", "/a-c-b", false},
+		{"/a*b*c", "/a-b-c", true},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+		{"/*$", "/page", true},
+	}
+
+	for _, test := range tests {
+		if got := match(test.pattern, test.path); got != test.want {
+			t.Errorf("match(%q, %q) = %t, want %t", test.pattern, test.path, got, test.want)
+		}
+	}
+}
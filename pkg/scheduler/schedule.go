@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives the times at which a job runs.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// Every is a Schedule activating at a fixed interval. Jobs with this
+// schedule also run once when the scheduler starts.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// Parse reads a schedule written as:
+//   - a Go duration such as "4h" or "@every 4h";
+//   - a descriptor: "@hourly", "@daily" (or "@midnight"), "@weekly", "@monthly" or "@yearly";
+//   - a 5 field cron expression "minute hour day-of-month month day-of-week",
+//     such as "0 */4 * * *" (every 4 hours) or "30 6 * * 1-5" (6:30 on week days).
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every ")); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule %q: the interval must be positive", spec)
+		}
+		return Every(d), nil
+	}
+
+	switch spec {
+	case "@yearly", "@annually":
+		spec = "0 0 1 1 *"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@hourly":
+		spec = "0 * * * *"
+	}
+
+	return ParseCron(spec)
+}
+
+// Cron is a Schedule defined by a cron expression, evaluated in the time
+// zone of the time given to Next.
+type Cron struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64 // Bit i is set if value i is allowed
+	domRestricted, dowRestricted  bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// ParseCron reads a 5 field cron expression. Each field is "*", a value,
+// a range "a-b", or a comma separated list of them, each optionally
+// followed by a step "/n".
+func ParseCron(spec string) (*Cron, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("schedule %q: expected a duration, a descriptor such as @daily, or 5 cron fields, got %d fields", spec, len(parts))
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+
+	// Sunday can be written 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		spec:          spec,
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: parts[2] != "*",
+		dowRestricted: parts[4] != "*",
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in the %s field", item[i+1:], f.name)
+			}
+			step = n
+			item = item[:i]
+		}
+
+		from, to := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+
+			var err error
+			from, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q in the %s field", bounds[0], f.name)
+			}
+
+			to = from
+			if len(bounds) == 2 {
+				to, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q in the %s field", bounds[1], f.name)
+				}
+			} else if step > 1 {
+				to = f.max // "5/15" means from 5 to the end, every 15
+			}
+		}
+
+		if from < f.min || to > f.max || from > to {
+			return 0, fmt.Errorf("%s in the %s field is out of the range %d-%d", item, f.name, f.min, f.max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// As in most cron implementations, when both the day of month and the day
+// of week are restricted, a day matching either of them is selected.
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := has(c.dom, t.Day())
+	dowMatch := has(c.dow, int(t.Weekday()))
+
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
+
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+
+	// An expression such as "0 0 30 2 *" never matches. Give up after 5 years
+	// rather than looping forever.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !has(c.month, int(t.Month())) {
+			t = later(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		if !c.dayMatches(t) {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+
+		// The next hour is counted in elapsed time: the wall clock may skip
+		// or repeat an hour when daylight saving time starts or ends
+		if !has(c.hour, t.Hour()) {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+
+		if !has(c.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// later returns next, unless it is not after t: time.Date gives an earlier
+// time for a wall clock time skipped by a daylight saving time change, such
+// as a midnight which does not exist. The next hour is returned instead.
+func later(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+func (c *Cron) String() string {
+	return c.spec
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string // String of the schedule, empty if spec is invalid
+	}{
+		{"4h", "@every 4h0m0s"},
+		{"@every 90m", "@every 1h30m0s"},
+		{"@hourly", "0 * * * *"},
+		{"@daily", "0 0 * * *"},
+		{"@midnight", "0 0 * * *"},
+		{"@weekly", "0 0 * * 0"},
+		{"@monthly", "0 0 1 * *"},
+		{"@yearly", "0 0 1 1 *"},
+		{" 30 6 * * 1-5 ", "30 6 * * 1-5"},
+		{"0", ""},
+		{"-1h", ""},
+		{"@every 0s", ""},
+		{"@fortnightly", ""},
+		{"* * * *", ""},
+		{"* * * * * *", ""},
+		{"60 * * * *", ""},
+		{"* 24 * * *", ""},
+		{"* * 0 * *", ""},
+		{"* * * 13 *", ""},
+		{"* * * * 8", ""},
+		{"5-1 * * * *", ""},
+		{"*/0 * * * *", ""},
+		{"a * * * *", ""},
+		{"1-a * * * *", ""},
+		{"1,,2 * * * *", ""},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", test.spec, s)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.spec, err)
+			continue
+		}
+		if got := s.(interface{ String() string }).String(); got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want []string // The next activations, in order
+	}{
+		// Values, ranges, steps and lists
+		{"0 * * * *", "2021-01-20 10:00:00", []string{"2021-01-20 11:00", "2021-01-20 12:00"}},
+		{"15 10 * * *", "2021-01-20 10:15:30", []string{"2021-01-21 10:15"}},
+		{"*/20 * * * *", "2021-01-20 10:41:00", []string{"2021-01-20 11:00", "2021-01-20 11:20", "2021-01-20 11:40"}},
+		{"5/20 * * * *", "2021-01-20 10:00:00", []string{"2021-01-20 10:05", "2021-01-20 10:25", "2021-01-20 10:45", "2021-01-20 11:05"}},
+		{"0 9-17/4 * * *", "2021-01-20 00:00:00", []string{"2021-01-20 09:00", "2021-01-20 13:00", "2021-01-20 17:00", "2021-01-21 09:00"}},
+		{"0 6,12,18-19 * * *", "2021-01-20 12:00:00", []string{"2021-01-20 18:00", "2021-01-20 19:00", "2021-01-21 06:00"}},
+		{"30 6 * * 1-5", "2021-01-22 07:00:00", []string{"2021-01-25 06:30"}}, // From Friday to Monday
+		{"0 0 * * 7", "2021-01-20 00:00:00", []string{"2021-01-24 00:00"}},    // 7 is Sunday
+		{"@weekly", "2021-01-24 00:00:00", []string{"2021-01-31 00:00"}},
+
+		// Month and year rollover
+		{"0 0 1 * *", "2021-01-31 23:59:00", []string{"2021-02-01 00:00", "2021-03-01 00:00"}},
+		{"0 0 31 * *", "2021-01-31 00:00:00", []string{"2021-03-31 00:00", "2021-05-31 00:00"}},
+		{"0 0 29 2 *", "2021-01-01 00:00:00", []string{"2024-02-29 00:00"}},
+		{"0 12 * 1,12 *", "2021-01-31 12:00:00", []string{"2021-12-01 12:00"}},
+		{"@yearly", "2021-06-15 08:00:00", []string{"2022-01-01 00:00"}},
+
+		// The day of month or the day of week when both are restricted,
+		// either of them otherwise
+		{"0 0 13 * 5", "2021-01-01 00:00:00", []string{"2021-01-08 00:00", "2021-01-13 00:00", "2021-01-15 00:00"}},
+		{"0 0 13 * *", "2021-01-01 00:00:00", []string{"2021-01-13 00:00", "2021-02-13 00:00"}},
+		{"0 0 * * 5", "2021-01-01 00:00:00", []string{"2021-01-08 00:00", "2021-01-15 00:00"}},
+		{"0 0 */10 * */3", "2021-01-01 00:00:00", []string{"2021-01-02 00:00", "2021-01-03 00:00", "2021-01-06 00:00", "2021-01-09 00:00", "2021-01-10 00:00", "2021-01-11 00:00"}},
+
+		// Never
+		{"0 0 30 2 *", "2021-01-01 00:00:00", []string{""}},
+		{"0 0 31 4,6,9,11 *", "2021-01-01 00:00:00", []string{""}},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next := parseTime(t, test.from, time.UTC)
+		for _, want := range test.want {
+			next = s.Next(next)
+			if got := format(next); got != want {
+				t.Errorf("%s from %s: got %q, want %q", test.spec, test.from, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		spec string
+		from string
+		want []string // In UTC, so that the repeated local hour is told apart
+	}{
+		// On 2021-03-14, 02:00 EST is followed by 03:00 EDT: the hour in
+		// between does not exist
+		{"0 * * * *", "2021-03-14 00:30:00", []string{"2021-03-14 06:00", "2021-03-14 07:00", "2021-03-14 08:00"}},
+		{"30 2 * * *", "2021-03-13 03:00:00", []string{"2021-03-15 06:30"}},
+		{"0 3 * * *", "2021-03-13 03:00:00", []string{"2021-03-14 07:00"}},
+
+		// On 2021-11-07, 02:00 EDT is followed by 01:00 EST: every real
+		// hour runs once
+		{"0 * * * *", "2021-11-07 00:30:00", []string{"2021-11-07 05:00", "2021-11-07 06:00", "2021-11-07 07:00"}},
+		{"0 0 * * *", "2021-11-06 12:00:00", []string{"2021-11-07 04:00", "2021-11-08 05:00"}},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next := parseTime(t, test.from, loc)
+		for _, want := range test.want {
+			next = s.Next(next)
+			if got := format(next.UTC()); got != want {
+				t.Errorf("%s from %s: got %q UTC, want %q", test.spec, test.from, got, want)
+				break
+			}
+		}
+	}
+}
+
+func parseTime(t *testing.T, s string, loc *time.Location) time.Time {
+	v, err := time.ParseInLocation("2006-01-02 15:04:05", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+// format returns t to the minute, or "" for the zero time.
+func format(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02 15:04")
+}
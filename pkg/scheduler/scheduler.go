@@ -0,0 +1,359 @@
+// Package scheduler runs jobs on cron or interval schedules and records
+// every run in the database.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Triggers of a run.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Func is the work of a job. It fills the counters of run, and returns an
+// error if the run failed. ctx is cancelled if the server shuts down.
+type Func func(ctx context.Context, run *models.JobRun) error
+
+// Store persists the run history. It is implemented by models.ArticleDB.
+type Store interface {
+	InsertJobRun(ctx context.Context, run *models.JobRun) error
+	UpdateJobRun(ctx context.Context, run *models.JobRun) error
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	jitter   time.Duration
+	fn       Func
+
+	running int32 // 1 while a run is in progress, accessed atomically
+
+	mu      sync.Mutex
+	nextRun time.Time
+}
+
+// JobStatus describes a job added to the scheduler.
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Jitter   string    `json:"jitter,omitempty"`
+	Running  bool      `json:"running"`
+	NextRun  time.Time `json:"next_run"`
+}
+
+type Scheduler struct {
+	store  Store
+	logger *log.Logger
+
+	mu      sync.Mutex
+	jobs    map[string]*job // Scheduled jobs, by name
+	oneOff  map[string]*job // Jobs started by Submit, by name
+	stopped bool
+
+	stop   chan struct{} // Closed by Shutdown
+	loops  sync.WaitGroup
+	runs   sync.WaitGroup
+	ctx    context.Context // Context of the runs, cancelled if Shutdown times out
+	cancel context.CancelFunc
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+func New(store Store, logger *log.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		store:  store,
+		logger: logger,
+		jobs:   make(map[string]*job),
+		oneOff: make(map[string]*job),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add registers a job, to be started by Start. Each run is delayed by a
+// random duration up to jitter, so that jobs scheduled at the same time do
+// not all hit the network at once.
+func (s *Scheduler) Add(name string, schedule Schedule, jitter time.Duration, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[name] = &job{name: name, schedule: schedule, jitter: jitter, fn: fn}
+}
+
+// Start runs every job on its schedule until Shutdown is called. Jobs with
+// an Every schedule also run once immediately.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		s.loops.Add(1)
+		go s.loop(j)
+	}
+}
+
+func (s *Scheduler) loop(j *job) {
+	defer s.loops.Done()
+
+	now := time.Now()
+	slot := now
+	if _, ok := j.schedule.(Every); !ok {
+		slot = j.schedule.Next(now)
+	}
+
+	for {
+		if slot.IsZero() {
+			s.logger.Println("[ERROR] Job", j.name, "will never run again with schedule", j.schedule)
+			return
+		}
+
+		at := slot.Add(s.jitter(j.jitter))
+		j.setNextRun(at)
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		// Runs are started in their own goroutine so that the next slot is
+		// not delayed by a long run; run skips it if this one is still going.
+		go s.run(j, TriggerSchedule)
+
+		// After a pause of the machine, missed slots are not caught up.
+		slot = j.schedule.Next(slot)
+		if now := time.Now(); slot.Before(now) {
+			slot = j.schedule.Next(now)
+		}
+	}
+}
+
+func (s *Scheduler) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+
+	return time.Duration(s.rand.Int63n(int64(max)))
+}
+
+// ErrStopped is returned by Trigger and Submit once Shutdown has been called.
+var ErrStopped = errors.New("scheduler: shut down")
+
+// ErrUnknownJob is returned by Trigger for a name not given to Add.
+var ErrUnknownJob = errors.New("scheduler: unknown job")
+
+// Trigger starts a run of the named job now, outside of its schedule, and
+// returns it once it is recorded. The run is skipped, and returned with the
+// status models.JobSkipped, if the job is already running.
+func (s *Scheduler) Trigger(name string) (*models.JobRun, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	return s.startAsync(j, j.fn, TriggerManual)
+}
+
+// Submit starts fn now as a one-off run of the job called name, and returns
+// the run once it is recorded. As for scheduled jobs, the run is skipped if
+// another run with the same name is in progress.
+func (s *Scheduler) Submit(name string, fn Func) (*models.JobRun, error) {
+	s.mu.Lock()
+	j, ok := s.oneOff[name]
+	if !ok {
+		j = &job{name: name}
+		s.oneOff[name] = j
+	}
+	s.mu.Unlock()
+
+	return s.startAsync(j, fn, TriggerManual)
+}
+
+// startAsync starts fn as a run of j in its own goroutine, and returns a
+// copy of the run as recorded, which the caller can read while fn fills the
+// run.
+func (s *Scheduler) startAsync(j *job, fn Func, trigger string) (*models.JobRun, error) {
+	run, started := s.begin(j, trigger)
+	if run == nil {
+		return nil, ErrStopped
+	}
+
+	recorded := *run
+	if started {
+		go s.execute(j, fn, run)
+	}
+
+	return &recorded, nil
+}
+
+// run runs j now, unless it is already running or the scheduler is shut
+// down, and records the run.
+func (s *Scheduler) run(j *job, trigger string) {
+	run, started := s.begin(j, trigger)
+	if started {
+		s.execute(j, j.fn, run)
+	}
+}
+
+// begin records a new run of j. started is false if the run has been
+// skipped, and run is nil if the scheduler is shut down. If started is
+// true, execute must be called.
+func (s *Scheduler) begin(j *job, trigger string) (run *models.JobRun, started bool) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil, false
+	}
+	s.runs.Add(1)
+	s.mu.Unlock()
+
+	run = &models.JobRun{
+		Job:     j.name,
+		Trigger: trigger,
+		Status:  models.JobRunning,
+		Start:   time.Now().UTC(),
+	}
+
+	if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		s.logger.Println("[INFO] Skip job", j.name, "since its previous run is still in progress")
+		run.Status = models.JobSkipped
+		run.End = &run.Start
+		run.Errors = []string{"previous run still in progress"}
+		s.record(run, s.store.InsertJobRun)
+		s.runs.Done()
+		return run, false
+	}
+
+	s.logger.Println("[INFO] Start job", j.name)
+	s.record(run, s.store.InsertJobRun)
+
+	return run, true
+}
+
+func (s *Scheduler) execute(j *job, fn Func, run *models.JobRun) {
+	defer s.runs.Done()
+	defer atomic.StoreInt32(&j.running, 0)
+
+	err := fn(s.ctx, run)
+
+	end := time.Now().UTC()
+	run.End = &end
+	switch {
+	case s.ctx.Err() != nil:
+		run.Status = models.JobCancelled
+	case err != nil:
+		run.Status = models.JobFailed
+	default:
+		run.Status = models.JobSucceeded
+	}
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+	}
+
+	s.logger.Printf("[INFO] Job %s %s after %s: %d articles found, %d new, %d updated, %d deleted, %d failed",
+		j.name, run.Status, end.Sub(run.Start).Round(time.Millisecond), run.Found, run.New, run.Updated, run.Deleted, run.Failed)
+	s.record(run, s.store.UpdateJobRun)
+}
+
+// record saves run with its own context, since the one of the run may be
+// cancelled.
+func (s *Scheduler) record(run *models.JobRun, save func(context.Context, *models.JobRun) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := save(ctx, run)
+	if err != nil {
+		s.logger.Println("[ERROR] Fail to record run of job", run.Job, err)
+	}
+}
+
+// Jobs describes the jobs added to the scheduler, sorted by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := JobStatus{
+			Name:     j.name,
+			Schedule: fmt.Sprint(j.schedule),
+			Running:  atomic.LoadInt32(&j.running) == 1,
+			NextRun:  j.getNextRun(),
+		}
+		if j.jitter > 0 {
+			status.Jitter = j.jitter.String()
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Name < statuses[k].Name
+	})
+
+	return statuses
+}
+
+func (j *job) setNextRun(t time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextRun = t.UTC()
+}
+
+func (j *job) getNextRun() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.nextRun
+}
+
+// Shutdown stops the schedules and waits for the runs in progress, if any,
+// to finish. If ctx is done first, the runs are cancelled, and Shutdown
+// returns ctx.Err() once they have returned.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	idle := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		s.runs.Wait()
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-idle
+		return ctx.Err()
+	}
+}
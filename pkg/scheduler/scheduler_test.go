@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/vitsensei/infogrid/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore keeps a copy of the runs recorded.
+type memStore struct {
+	mu   sync.Mutex
+	runs map[primitive.ObjectID]models.JobRun
+}
+
+func (m *memStore) InsertJobRun(ctx context.Context, run *models.JobRun) error {
+	run.ID = primitive.NewObjectID()
+	return m.UpdateJobRun(ctx, run)
+}
+
+func (m *memStore) UpdateJobRun(ctx context.Context, run *models.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runs[run.ID] = *run
+	return nil
+}
+
+func (m *memStore) run(id primitive.ObjectID) models.JobRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.runs[id]
+}
+
+// Run with -race: the run returned by Submit is read while the job fills its
+// own.
+func TestSubmit(t *testing.T) {
+	store := &memStore{runs: make(map[primitive.ObjectID]models.JobRun)}
+	s := New(store, log.New(ioutil.Discard, "", 0))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	run, err := s.Submit("job", func(ctx context.Context, run *models.JobRun) error {
+		close(started)
+		for i := 0; i < 100; i++ {
+			run.Found++
+			run.Errors = append(run.Errors, "error")
+		}
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	b, err := json.Marshal(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != models.JobRunning || run.ID.IsZero() {
+		t.Errorf("got run %s, want it running and recorded", b)
+	}
+
+	// A second run is skipped while the first one is in progress
+	skipped, err := s.Submit("job", func(ctx context.Context, run *models.JobRun) error { return nil })
+	if err != nil || skipped.Status != models.JobSkipped {
+		t.Errorf("got %+v, %v for a second run, want it skipped", skipped, err)
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.run(run.ID); got.Status != models.JobSucceeded || got.Found != 100 {
+		t.Errorf("got recorded run %+v, want it succeeded with 100 articles found", got)
+	}
+	if run.Found != 0 || run.End != nil {
+		t.Errorf("returned run changed by the job: %+v", run)
+	}
+
+	if _, err := s.Submit("job", nil); err != ErrStopped {
+		t.Errorf("got %v after Shutdown, want ErrStopped", err)
+	}
+}
@@ -0,0 +1,26 @@
+// Package sources creates the news sources listed in config.SourceNames.
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vitsensei/infogrid/pkg/config"
+	"github.com/vitsensei/infogrid/pkg/controller"
+	"github.com/vitsensei/infogrid/pkg/nytimes"
+	"github.com/vitsensei/infogrid/pkg/reuters"
+)
+
+// New creates the source called name with its settings.
+func New(name string, s config.Source) (controller.Source, error) {
+	switch name {
+	case nytimes.Name:
+		if s.APIKey == "" {
+			return nil, errors.New("sources.nytimes.api_key is empty; set NYTIMES_KEY")
+		}
+		return nytimes.NewAPI(s.APIKey, s.Sections), nil
+	case reuters.Name:
+		return reuters.NewAPI(s.Sections), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q; known sources are %v", name, config.SourceNames)
+	}
+}
@@ -0,0 +1,116 @@
+package textrank
+
+import (
+	"github.com/vitsensei/infogrid/pkg/graph"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Keyword is a word of the text ranked by Keywords.
+type Keyword struct {
+	Word  string  `json:"word"` // Lower case and lemmatized
+	Score float64 `json:"score"`
+}
+
+// Only nouns and adjectives are candidate keywords, as in section 3 of
+// https://web.eecs.umich.edu/~mihalcea/papers/mihalcea.emnlp04.pdf
+func isCandidate(tag string) bool {
+	return strings.HasPrefix(tag, "NN") || strings.HasPrefix(tag, "JJ")
+}
+
+// Keywords returns the n highest ranked words of the text, highest first.
+// Words are linked in a graph when they occur within windowSize of each
+// other among the candidate words, and ranked with TextRank.
+func (t *Text) Keywords(n int) []Keyword {
+	var words []string
+	for _, token := range t.doc.Tokens() {
+		if !isCandidate(token.Tag) {
+			continue
+		}
+
+		word := strings.ToLower(token.Text)
+		if lemma, ok := t.lemmaDict[word]; ok {
+			word = lemma
+		}
+		if len(word) < 2 {
+			continue
+		}
+
+		words = append(words, word)
+	}
+
+	// One node per unique word
+	ids := make(map[string]int)
+	var vocabulary []string
+	for _, w := range words {
+		if _, ok := ids[w]; !ok {
+			ids[w] = len(vocabulary)
+			vocabulary = append(vocabulary, w)
+		}
+	}
+
+	var g graph.Graph
+	for id := range vocabulary {
+		g.AddNode(id, 0)
+	}
+
+	for i := range words {
+		for j := i + 1; j < len(words) && j < i+t.windowSize; j++ {
+			a, b := ids[words[i]], ids[words[j]]
+			if a == b {
+				continue
+			}
+			g.Nodes[a].Neighbors[b] = 1
+			g.Nodes[b].Neighbors[a] = 1
+		}
+	}
+
+	scores := t.rankWords(g)
+
+	keywords := make([]Keyword, len(vocabulary))
+	for id, w := range vocabulary {
+		keywords[id] = Keyword{Word: w, Score: scores[id]}
+	}
+
+	sort.SliceStable(keywords, func(i, j int) bool {
+		return keywords[i].Score > keywords[j].Score
+	})
+
+	if n >= 0 && len(keywords) > n {
+		keywords = keywords[:n]
+	}
+
+	return keywords
+}
+
+// rankWords runs TextRank on an unweighted graph, like doRanking does on the
+// graph of the sentences.
+func (t *Text) rankWords(g graph.Graph) []float64 {
+	scores := make([]float64, len(g.Nodes))
+	for i := range scores {
+		scores[i] = 1
+	}
+
+	newScores := make([]float64, len(g.Nodes))
+	for iter := 0; iter < t.maxIterations; iter++ {
+		maxDelta := 0.0
+
+		for i, node := range g.Nodes {
+			score := 0.0
+			for neighborID := range node.Neighbors {
+				score += scores[neighborID] / float64(len(g.Nodes[neighborID].Neighbors))
+			}
+			newScores[i] = score*t.dampingFactor + (1 - t.dampingFactor)
+
+			maxDelta = math.Max(maxDelta, math.Abs(newScores[i]-scores[i]))
+		}
+
+		copy(scores, newScores)
+		if maxDelta < t.threshold {
+			break
+		}
+	}
+
+	return scores
+}
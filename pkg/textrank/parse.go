@@ -5,11 +5,22 @@ import (
 	"os"
 )
 
+const (
+	defaultLemmatizationFile = "./pkg/textrank/lemmatization_list"
+)
+
 func ParseLemmatization() (map[string]string, error) {
-	file, err := os.Open("./pkg/textrank/lemmatization_list")
+	return ParseLemmatizationFile(defaultLemmatizationFile)
+}
+
+// ParseLemmatizationFile reads a lemmatization list made of one
+// "lemma<TAB>token" pair per line.
+func ParseLemmatizationFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	lemDict := make(map[string]string)
 	var newLine string
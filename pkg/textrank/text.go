@@ -70,7 +70,7 @@ type Text struct {
 	doc           *prose.Document   // used for sentences segmentation, might be replaced in the future
 	Sentences     []Sentence        // Represent a sentence in a text
 	graph         graph.Graph       // Represent the connected graph of Sentences
-	windowSize    int               // A window size used for keywords extraction (not yet implemented)
+	windowSize    int               // A window size used for keywords extraction, see Keywords
 	dampingFactor float64           // the value "d" in section 2.2 (https://web.eecs.umich.edu/~mihalcea/papers/mihalcea.emnlp04.pdf)
 	maxIterations int               // Max iteration to calculate sentence's score
 	threshold     float64           // The minimum difference between this score and last score of sentences
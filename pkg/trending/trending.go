@@ -0,0 +1,158 @@
+package trending
+
+import (
+	"github.com/vitsensei/infogrid/pkg/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// Detector flags the buckets of time in which a tag appeared in many more
+// articles than usual. For every bucket evaluated, the count is compared with
+// the counts of the same tag in the buckets of the Baseline before it using
+// a z-score.
+type Detector struct {
+	// Width of the buckets, in whole hours. It should be the interval
+	// between two captures: with narrower buckets, every capture piles its
+	// articles in one bucket and leaves the others empty.
+	Bucket time.Duration
+
+	Baseline  time.Duration // Buckets before the evaluated one forming the baseline
+	Threshold float64       // Minimum z-score of a burst
+	MinCount  int           // Minimum number of articles of a burst, to ignore noise from rare tags
+
+	// Lower bound of the standard deviation. Without it, a tag that never
+	// appeared before (or always appeared the same number of times) has a
+	// standard deviation of 0 and any article would be an infinite burst.
+	MinStdDev float64
+}
+
+type bucket struct {
+	count int
+	urls  []string
+}
+
+func NewDetector() *Detector {
+	return &Detector{
+		Bucket:    time.Hour,
+		Baseline:  7 * 24 * time.Hour,
+		Threshold: 3,
+		MinCount:  3,
+		MinStdDev: 1,
+	}
+}
+
+// bucket returns the width of the buckets, rounded to whole hours.
+func (d *Detector) bucket() time.Duration {
+	if b := d.Bucket.Round(time.Hour); b > 0 {
+		return b
+	}
+
+	return time.Hour
+}
+
+// baselineBuckets returns the number of buckets of the baseline.
+func (d *Detector) baselineBuckets() int {
+	if n := int(d.Baseline / d.bucket()); n > 0 {
+		return n
+	}
+
+	return 1
+}
+
+// Since returns the earliest capture time Detect needs for buckets from `from`.
+func (d *Detector) Since(from time.Time) time.Time {
+	b := d.bucket()
+	return from.UTC().Truncate(b).Add(-time.Duration(d.baselineBuckets()) * b)
+}
+
+// Detect returns an event for each (tag, bucket) burst with from <= bucket <= to,
+// adding up the hourly counts in their bucket. counts must cover at least
+// [d.Since(from), to].
+func (d *Detector) Detect(counts []models.HourlyCount, from time.Time, to time.Time) []models.TrendEvent {
+	b := d.bucket()
+	n := d.baselineBuckets()
+	from = from.UTC().Truncate(b)
+	to = to.UTC().Truncate(b)
+	start := d.Since(from)
+	nBuckets := int(to.Sub(start)/b) + 1
+	if nBuckets <= 0 {
+		return nil
+	}
+
+	// Build a dense series for each tag, filling the buckets without articles with 0.
+	series := make(map[string][]bucket)
+	for _, c := range counts {
+		i := int(c.Hour.UTC().Sub(start) / b)
+		if i < 0 || i >= nBuckets {
+			continue
+		}
+
+		if _, ok := series[c.Tag]; !ok {
+			series[c.Tag] = make([]bucket, nBuckets)
+		}
+		series[c.Tag][i].count += c.Count
+		series[c.Tag][i].urls = append(series[c.Tag][i].urls, c.URLs...)
+	}
+
+	now := time.Now().UTC()
+	var events []models.TrendEvent
+	for tag, buckets := range series {
+		for i := int(from.Sub(start) / b); i < nBuckets; i++ {
+			if buckets[i].count < d.MinCount {
+				continue
+			}
+
+			mean, stdDev := meanAndStdDev(buckets, i-n, i)
+			if stdDev < d.MinStdDev {
+				stdDev = d.MinStdDev
+			}
+
+			z := (float64(buckets[i].count) - mean) / stdDev
+			if z < d.Threshold {
+				continue
+			}
+
+			events = append(events, models.TrendEvent{
+				Tag:         tag,
+				Hour:        start.Add(time.Duration(i) * b),
+				Count:       buckets[i].count,
+				Mean:        mean,
+				StdDev:      stdDev,
+				ZScore:      z,
+				ArticleURLs: buckets[i].urls,
+				DetectedAt:  now,
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Hour.Equal(events[j].Hour) {
+			return events[i].ZScore > events[j].ZScore
+		}
+		return events[i].Hour.After(events[j].Hour)
+	})
+
+	return events
+}
+
+// Mean and population standard deviation of the counts in buckets[from:to].
+func meanAndStdDev(buckets []bucket, from int, to int) (float64, float64) {
+	n := float64(to - from)
+	if n <= 0 {
+		return 0, 0
+	}
+
+	sum := 0.0
+	for _, b := range buckets[from:to] {
+		sum += float64(b.count)
+	}
+	mean := sum / n
+
+	variance := 0.0
+	for _, b := range buckets[from:to] {
+		variance += (float64(b.count) - mean) * (float64(b.count) - mean)
+	}
+
+	return mean, math.Sqrt(variance / n)
+}
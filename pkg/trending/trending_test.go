@@ -0,0 +1,162 @@
+package trending
+
+import (
+	"github.com/vitsensei/infogrid/pkg/models"
+	"math"
+	"testing"
+	"time"
+)
+
+var from = time.Date(2021, 1, 20, 10, 0, 0, 0, time.UTC)
+
+// hour is a count of articles, offset hours after from.
+type hour struct {
+	tag    string
+	offset int
+	count  int
+}
+
+func hourlyCounts(hours []hour) []models.HourlyCount {
+	var counts []models.HourlyCount
+	for _, h := range hours {
+		counts = append(counts, models.HourlyCount{
+			Tag:   h.tag,
+			Hour:  from.Add(time.Duration(h.offset) * time.Hour),
+			Count: h.count,
+		})
+	}
+
+	return counts
+}
+
+func testDetector() *Detector {
+	return &Detector{Bucket: time.Hour, Baseline: 4 * time.Hour, Threshold: 3, MinCount: 3, MinStdDev: 1}
+}
+
+func TestDetect(t *testing.T) {
+	type event struct {
+		tag                  string
+		offset               int
+		count                int
+		mean, stdDev, zScore float64
+	}
+
+	tests := []struct {
+		name   string
+		counts []hour
+		want   []event
+	}{
+		// The standard deviation of 0 is raised to MinStdDev
+		{"new tag", []hour{{"a", 0, 3}}, []event{{"a", 0, 3, 0, 1, 3}}},
+		{"below MinCount", []hour{{"a", 0, 2}}, nil},
+		{"steady", []hour{{"a", -4, 5}, {"a", -3, 5}, {"a", -2, 5}, {"a", -1, 5}, {"a", 0, 5}}, nil},
+		{"steady then burst", []hour{{"a", -4, 5}, {"a", -3, 5}, {"a", -2, 5}, {"a", -1, 5}, {"a", 0, 8}}, []event{{"a", 0, 8, 5, 1, 3}}},
+		{"noisy", []hour{{"a", -4, 0}, {"a", -3, 10}, {"a", -2, 0}, {"a", -1, 10}, {"a", 0, 15}}, nil},
+		{"noisy then burst", []hour{{"a", -4, 0}, {"a", -3, 10}, {"a", -2, 0}, {"a", -1, 10}, {"a", 0, 20}}, []event{{"a", 0, 20, 5, 5, 3}}},
+		{"hours without articles", []hour{{"a", -3, 4}, {"a", 0, 4}}, nil}, // z = 3 / sqrt(3)
+		{"outside the range", []hour{{"a", -5, 50}, {"a", 0, 3}, {"a", 2, 9}}, []event{{"a", 0, 3, 0, 1, 3}}},
+		{"hour counted twice", []hour{{"a", 0, 2}, {"a", 0, 2}}, []event{{"a", 0, 4, 0, 1, 4}}},
+
+		// Newest hours first, then highest z-scores
+		{
+			"order",
+			[]hour{{"a", 0, 3}, {"b", 0, 5}, {"c", 1, 3}, {"b", 1, 9}},
+			[]event{{"b", 1, 9, 1.25, math.Sqrt(4.6875), 7.75 / math.Sqrt(4.6875)}, {"c", 1, 3, 0, 1, 3}, {"b", 0, 5, 0, 1, 5}, {"a", 0, 3, 0, 1, 3}},
+		},
+	}
+
+	for _, test := range tests {
+		events := testDetector().Detect(hourlyCounts(test.counts), from, from.Add(time.Hour))
+		if len(events) != len(test.want) {
+			t.Errorf("%s: got %+v, want %d events", test.name, events, len(test.want))
+			continue
+		}
+
+		for i, want := range test.want {
+			got := events[i]
+			if got.Tag != want.tag || !got.Hour.Equal(from.Add(time.Duration(want.offset)*time.Hour)) || got.Count != want.count ||
+				!near(got.Mean, want.mean) || !near(got.StdDev, want.stdDev) || !near(got.ZScore, want.zScore) {
+				t.Errorf("%s: got %+v, want %+v", test.name, got, want)
+			}
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDetectURLs(t *testing.T) {
+	counts := []models.HourlyCount{
+		{Tag: "a", Hour: from.Add(10 * time.Minute), Count: 2, URLs: []string{"1", "2"}},
+		{Tag: "a", Hour: from, Count: 1, URLs: []string{"3"}},
+	}
+
+	events := testDetector().Detect(counts, from.Add(30*time.Minute), from.Add(30*time.Minute))
+	if len(events) != 1 || len(events[0].ArticleURLs) != 3 || !events[0].Hour.Equal(from) {
+		t.Errorf("got %+v, want one event with the 3 articles", events)
+	}
+}
+
+func TestDetectBuckets(t *testing.T) {
+	// Captures every 4 hours, at a different minute of the bucket each time
+	counts := hourlyCounts([]hour{{"a", -17, 2}, {"a", -11, 2}, {"a", -7, 2}, {"a", -4, 2}, {"a", -2, 3}, {"a", 1, 3}})
+	d := testDetector()
+	d.Bucket = 4 * time.Hour
+	d.Baseline = 16 * time.Hour
+
+	// from is 10:00, in the bucket starting at 08:00
+	events := d.Detect(counts, from, from.Add(time.Hour))
+	if len(events) != 1 {
+		t.Fatalf("got %+v, want one event", events)
+	}
+	got := events[0]
+	if !got.Hour.Equal(from.Add(-2*time.Hour)) || got.Count != 6 || !near(got.Mean, 2) || !near(got.StdDev, 1) || !near(got.ZScore, 4) {
+		t.Errorf("got %+v, want 6 articles at 08:00 with a mean of 2", got)
+	}
+
+	if got, want := d.Since(from), from.Add(-18*time.Hour); !got.Equal(want) {
+		t.Errorf("Since(%v) = %v, want %v", from, got, want)
+	}
+
+	// Buckets narrower than an hour are an hour wide
+	d.Bucket = time.Minute
+	if got, want := d.Since(from), from.Add(-16*time.Hour); !got.Equal(want) {
+		t.Errorf("Since(%v) = %v, want %v", from, got, want)
+	}
+}
+
+func TestDetectEmptyRange(t *testing.T) {
+	d := testDetector()
+	if events := d.Detect(hourlyCounts([]hour{{"a", 0, 10}}), from, d.Since(from).Add(-time.Hour)); events != nil {
+		t.Errorf("got %+v, want none", events)
+	}
+}
+
+func TestSince(t *testing.T) {
+	d := testDetector()
+	if got, want := d.Since(from.Add(42*time.Minute)), from.Add(-4*time.Hour); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMeanAndStdDev(t *testing.T) {
+	buckets := []bucket{{count: 2}, {count: 4}, {count: 4}, {count: 4}, {count: 5}, {count: 5}, {count: 7}, {count: 9}}
+
+	tests := []struct {
+		from, to     int
+		mean, stdDev float64
+	}{
+		{0, 8, 5, 2},
+		{1, 4, 4, 0},
+		{3, 3, 0, 0},
+		{4, 2, 0, 0},
+	}
+
+	for _, test := range tests {
+		mean, stdDev := meanAndStdDev(buckets, test.from, test.to)
+		if mean != test.mean || stdDev != test.stdDev {
+			t.Errorf("meanAndStdDev(%d, %d) = %g, %g, want %g, %g", test.from, test.to, mean, stdDev, test.mean, test.stdDev)
+		}
+	}
+}
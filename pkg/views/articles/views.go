@@ -1,6 +1,7 @@
 package articles
 
 import (
+	"bytes"
 	"html/template"
 	"net/http"
 	"os"
@@ -43,10 +44,19 @@ type View struct {
 	Layout   string
 }
 
+// The template is executed into a buffer first, so that nothing has been
+// written to w when an error is returned.
 func (v *View) Render(w http.ResponseWriter, data interface{}) error {
+	var buf bytes.Buffer
+	err := v.Template.ExecuteTemplate(&buf, v.Layout, data)
+	if err != nil {
+		return err
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf8")
+	_, err = buf.WriteTo(w)
 
-	return v.Template.ExecuteTemplate(w, v.Layout, data)
+	return err
 }
 
 func must(err error) {